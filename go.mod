@@ -4,16 +4,27 @@ go 1.25.1
 
 tool github.com/googlecodelabs/tools/claat
 
+require (
+	// toolexec/analyze は go/analysis の unitchecker を使います。x/tools の要求で
+	// claat が使う goldmark と x/net も上がりますが、どちらも claat のビルドにしか使われません
+	golang.org/x/tools v0.37.0
+	// toolexec/cmd/wrapper が interfacetoany アナライザーを登録します
+	suggestedfix v0.0.0
+)
+
 require (
 	github.com/golang/protobuf v1.4.2 // indirect
 	github.com/googlecodelabs/tools/claat v0.0.0-20240220115335-873fe39d02dc // indirect
 	github.com/stoewer/go-strcase v1.2.0 // indirect
 	github.com/x1ddos/csslex v0.0.0-20160125172232-7894d8ab8bfe // indirect
-	github.com/yuin/goldmark v1.3.7 // indirect
-	golang.org/x/net v0.0.0-20210525063256-abc453219eb5 // indirect
+	github.com/yuin/goldmark v1.4.13 // indirect
+	golang.org/x/net v0.44.0 // indirect
 	golang.org/x/oauth2 v0.0.0-20210514164344-f6687ab2804c // indirect
 	google.golang.org/appengine v1.6.6 // indirect
 	google.golang.org/protobuf v1.25.0 // indirect
 )
 
 ignore docs
+
+// interfacetoany アナライザーはワークショップの suggestedfix の解答を使います
+replace suggestedfix => ./suggestedfix/solution/step3
@@ -0,0 +1,80 @@
+// overlaydrift は GOROOT のファイルをコピーした overlay のファイルが、現在の GOROOT からずれていないかを調べます。
+//
+//	go run ./overlay/cmd/overlaydrift ./overlay/example/overlay.json
+//
+// overlay.json のうち、overlay のファイルの横にメタデータ（time.go.base.json）があるものだけを調べます。
+// 上流のファイルがコピー元から変わっていると、コピー元から GOROOT への変更とパッチの差分を表示して終了コード 1 で終わります。
+// 上流の変更がパッチを当てた部分と重ならなければ、-rebase で上流の変更を取り込み、メタデータを更新できます。
+// -record はメタデータのない置き換えについて、現在の GOROOT のファイルをコピー元として記録します。
+//
+// overlay.json の相対パスはカレントディレクトリを基準にします。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/newmo-oss/gocon25-workshop/overlay/overlaydrift"
+)
+
+func main() {
+	rebase := flag.Bool("rebase", false, "apply upstream changes to the overlay files and update their metadata")
+	record := flag.Bool("record", false, "write metadata for overlay files without it, taking the current GOROOT as the original")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: overlaydrift [-rebase | -record] overlay.json")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *rebase && *record {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := &overlaydrift.Checker{}
+	if *record {
+		recorded, err := c.RecordMissing(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "overlaydrift: %v\n", err)
+			os.Exit(1)
+		}
+		for _, file := range recorded {
+			fmt.Printf("recorded %s\n", overlaydrift.MetaPath(file))
+		}
+		return
+	}
+
+	results, err := c.Check(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "overlaydrift: %v\n", err)
+		os.Exit(1)
+	}
+	failed := false
+	for _, r := range results {
+		if !r.Drifted() {
+			continue
+		}
+		if *rebase {
+			if err := c.Rebase(r); err != nil {
+				fmt.Print(r.Diff())
+				fmt.Fprintf(os.Stderr, "overlaydrift: %v\n", err)
+				failed = true
+				continue
+			}
+			fmt.Printf("rebased %s onto %s\n", r.File, r.GoVersion)
+			continue
+		}
+
+		fmt.Print(r.Diff())
+		if len(r.Conflicts) > 0 {
+			_, err := r.Rebased()
+			fmt.Fprintf(os.Stderr, "overlaydrift: %v; update the patch by hand\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "overlaydrift: %s: %s changed outside the patched region since %s; run with -rebase to apply it\n", r.File, r.Meta.Original, r.Meta.GoVersion)
+		}
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
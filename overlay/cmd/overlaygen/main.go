@@ -0,0 +1,49 @@
+// overlaygen は関数単位の指定から go build -overlay に渡す overlay.json と置き換えたファイルを生成します。
+//
+//	go run ./overlay/cmd/overlaygen -o /tmp/overlay.json ./overlay/example/now.json
+//	go test -overlay /tmp/overlay.json ./overlay/example
+//
+// 元のファイルはカレントディレクトリで go list を実行して探すため、ビルドと同じ GOROOT、
+// モジュールキャッシュ、GOOS と GOARCH のファイルが使われます。
+// 置き換えたファイルは -cache のディレクトリに書き出し、overlay.json には絶対パスで記録します。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/newmo-oss/gocon25-workshop/overlay/overlaygen"
+)
+
+func main() {
+	out := flag.String("o", "overlay.json", "overlay file to write")
+	cache := flag.String("cache", "", "directory for patched files (default: user cache directory)")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: overlaygen [-o overlay.json] [-cache dir] spec.json")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), *out, *cache); err != nil {
+		fmt.Fprintf(os.Stderr, "overlaygen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(specPath, out, cache string) error {
+	spec, err := overlaygen.ReadSpec(specPath)
+	if err != nil {
+		return err
+	}
+	g := &overlaygen.Generator{CacheDir: cache}
+	o, err := g.Generate(spec)
+	if err != nil {
+		return err
+	}
+	return o.Write(out)
+}
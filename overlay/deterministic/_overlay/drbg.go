@@ -0,0 +1,51 @@
+// このファイルは overlay で crypto/internal/fips140/drbg パッケージに zz_deterministic.go として追加され、
+// DETERMINISTIC_CRYPTO_SEED 環境変数で crypto/rand.Reader と crypto/rand.Read が返すバイト列を決めます。
+// 暗号としては安全でないため、テスト以外では使わないでください。
+
+package drbg
+
+import (
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+var deterministic struct {
+	once    sync.Once
+	mu      sync.Mutex
+	enabled bool
+	state   uint64
+}
+
+// deterministicRead は DETERMINISTIC_CRYPTO_SEED が設定されていれば、b をシードから splitmix64 で作ったバイト列で埋めます
+func deterministicRead(b []byte) bool {
+	d := &deterministic
+	d.once.Do(func() {
+		s, ok := syscall.Getenv("DETERMINISTIC_CRYPTO_SEED")
+		if !ok {
+			return
+		}
+		seed, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			panic("crypto/rand: invalid DETERMINISTIC_CRYPTO_SEED " + strconv.Quote(s))
+		}
+		d.enabled, d.state = true, seed
+	})
+	if !d.enabled {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := 0; i < len(b); i += 8 {
+		d.state += 0x9e3779b97f4a7c15
+		z := d.state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		z ^= z >> 31
+		for j := 0; j < 8 && i+j < len(b); j++ {
+			b[i+j] = byte(z >> (8 * j))
+		}
+	}
+	return true
+}
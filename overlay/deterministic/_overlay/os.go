@@ -0,0 +1,28 @@
+// このファイルは overlay で os パッケージに zz_deterministic.go として追加され、
+// DETERMINISTIC_PID と DETERMINISTIC_HOSTNAME 環境変数で Getpid と Hostname の結果を決めます。
+// syscall.Getpid などを直接呼ぶ場合は実際の値のままです。
+
+package os
+
+import (
+	"strconv"
+	"syscall"
+)
+
+// deterministicPid は DETERMINISTIC_PID が設定されていればその値を返します
+func deterministicPid() (int, bool) {
+	s, ok := syscall.Getenv("DETERMINISTIC_PID")
+	if !ok {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(s)
+	if err != nil {
+		panic("os: invalid DETERMINISTIC_PID " + strconv.Quote(s))
+	}
+	return pid, true
+}
+
+// deterministicHostname は DETERMINISTIC_HOSTNAME が設定されていればその値を返します
+func deterministicHostname() (string, bool) {
+	return syscall.Getenv("DETERMINISTIC_HOSTNAME")
+}
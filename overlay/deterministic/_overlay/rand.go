@@ -0,0 +1,28 @@
+// このファイルは overlay で math/rand パッケージに zz_deterministic.go として追加され、
+// DETERMINISTIC_RAND_SEED 環境変数でトップレベルの関数が使う乱数のシードを決めます。
+
+package rand
+
+import (
+	"strconv"
+	"syscall"
+)
+
+// deterministicGlobalRand は DETERMINISTIC_RAND_SEED が設定されていれば、
+// GODEBUG=randautoseed=0 と同じようにそのシードで初期化した生成器を globalRandGenerator に設定します
+func deterministicGlobalRand() {
+	if globalRandGenerator.Load() != nil {
+		return
+	}
+	s, ok := syscall.Getenv("DETERMINISTIC_RAND_SEED")
+	if !ok {
+		return
+	}
+	seed, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		panic("math/rand: invalid DETERMINISTIC_RAND_SEED " + strconv.Quote(s))
+	}
+	r := New(new(lockedSource))
+	r.Seed(int64(seed))
+	globalRandGenerator.CompareAndSwap(nil, r)
+}
@@ -0,0 +1,42 @@
+// このファイルは overlay で math/rand/v2 パッケージに zz_deterministic.go として追加され、
+// DETERMINISTIC_RAND_SEED 環境変数でトップレベルの関数が使う乱数のシードを決めます。
+
+package rand
+
+import (
+	"internal/byteorder"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+var deterministic struct {
+	once sync.Once
+	mu   sync.Mutex
+	// src は DETERMINISTIC_RAND_SEED が設定されていないとき nil です
+	src *ChaCha8
+}
+
+// deterministicUint64 は DETERMINISTIC_RAND_SEED が設定されていれば、そのシードの ChaCha8 から次の値を返します
+func deterministicUint64() (uint64, bool) {
+	d := &deterministic
+	d.once.Do(func() {
+		s, ok := syscall.Getenv("DETERMINISTIC_RAND_SEED")
+		if !ok {
+			return
+		}
+		seed, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			panic("math/rand/v2: invalid DETERMINISTIC_RAND_SEED " + strconv.Quote(s))
+		}
+		var key [32]byte
+		byteorder.LEPutUint64(key[:], seed)
+		d.src = NewChaCha8(key)
+	})
+	if d.src == nil {
+		return 0, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.src.Uint64(), true
+}
@@ -0,0 +1,90 @@
+// このファイルは overlay で runtime パッケージに zz_deterministic.go として追加され、
+// DETERMINISTIC_MAP_SEED 環境変数でマップのハッシュの鍵、シード、反復の開始位置を決まった値にします。
+// runtime.rand を 1 つの列にまとめるため、複数のゴルーチンが同時にマップを作ると順番は揃いません。
+
+package runtime
+
+import (
+	"internal/runtime/atomic"
+	"unsafe"
+)
+
+// mapseed は DETERMINISTIC_MAP_SEED から作る乱数の状態です
+var mapseed struct {
+	// status は 0 が未確認、1 が無効、2 が有効です
+	status atomic.Uint32
+	// boot は bootstrapRand と M ごとの乱数の初期化、maps は rand の代わりに使います。
+	// rand はマップのシードと反復の開始位置に使われるため、スレッドの数や作られる順番で
+	// ずれないように分けています
+	boot, maps atomic.Uint64
+}
+
+// mapseedEnabled は DETERMINISTIC_MAP_SEED が設定されているかどうかを返します。
+// ハッシュの鍵は goenvs より前の alginit で作られるため、getGodebugEarly と同じように
+// 環境変数を直接読みます。最初の呼び出しは schedinit の中で 1 つのスレッドから行われます
+func mapseedEnabled() bool {
+	switch mapseed.status.Load() {
+	case 1:
+		return false
+	case 2:
+		return true
+	}
+	s, ok := mapseedEnv()
+	if !ok {
+		mapseed.status.Store(1)
+		return false
+	}
+	var seed uint64
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			throw("runtime: DETERMINISTIC_MAP_SEED must be a decimal number")
+		}
+		seed = seed*10 + uint64(s[i]-'0')
+	}
+	mapseed.boot.Store(seed)
+	mapseed.maps.Store(seed ^ 0x6d6170736565640a)
+	mapseed.status.Store(2)
+	return true
+}
+
+// mapseedEnv は DETERMINISTIC_MAP_SEED の値を返します。環境変数を直接読めない OS では常に false です
+func mapseedEnv() (string, bool) {
+	const prefix = "DETERMINISTIC_MAP_SEED="
+	switch GOOS {
+	case "aix", "darwin", "ios", "dragonfly", "freebsd", "netbsd", "openbsd", "illumos", "solaris", "linux":
+		for i := int32(0); argv_index(argv, argc+1+i) != nil; i++ {
+			p := argv_index(argv, argc+1+i)
+			s := unsafe.String(p, findnull(p))
+			if len(s) >= len(prefix) && s[:len(prefix)] == prefix {
+				return s[len(prefix):], true
+			}
+		}
+	}
+	return "", false
+}
+
+// mapseedInitM は DETERMINISTIC_MAP_SEED が設定されていれば M の乱数の状態を boot から作り、true を返します。
+// rand は M の状態を使わなくなりますが、cheaprand はスケジューラのためにこの状態を使い続けます
+func mapseedInitM(mp *m) bool {
+	if !mapseedEnabled() {
+		return false
+	}
+	var seed [4]uint64
+	for i := range seed {
+		seed[i] = mapseedNext(&mapseed.boot)
+	}
+	mp.chacha8.Init64(seed)
+	mp.cheaprand = uint32(mapseedNext(&mapseed.boot))
+	mp.cheaprand64 = mapseedNext(&mapseed.boot)
+	return true
+}
+
+// mapseedNext は splitmix64 で次の乱数を返します
+//
+//go:nosplit
+func mapseedNext(state *atomic.Uint64) uint64 {
+	z := state.Add(-0x61c8864680b583eb) // 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
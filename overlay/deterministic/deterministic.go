@@ -0,0 +1,36 @@
+// Package deterministic は不安定なテストを再現するため、時刻と乱数などを決まった値にする overlay をまとめます。
+//
+// 次のコマンドで、使っている Go のバージョンの標準ライブラリから overlay を生成します。
+// spec.json は fakeclock の spec.json を含むため、時計の置き換えも同じ overlay.json に入ります。
+//
+//	go run ./overlay/cmd/overlaygen -o /tmp/deterministic.json ./overlay/deterministic/spec.json
+//	DETERMINISTIC_RAND_SEED=1 DETERMINISTIC_MAP_SEED=1 go test -overlay /tmp/deterministic.json ./...
+//
+// それぞれ次の環境変数が設定されているときだけ置き換え、設定されていなければ元のまま動きます。
+//
+//   - DETERMINISTIC_RAND_SEED: math/rand と math/rand/v2 のグローバルな乱数のシード
+//   - DETERMINISTIC_CRYPTO_SEED: crypto/rand.Reader などが返す乱数のシード
+//   - DETERMINISTIC_PID: os.Getpid が返す値
+//   - DETERMINISTIC_HOSTNAME: os.Hostname が返す値
+//   - DETERMINISTIC_MAP_SEED: マップのハッシュの鍵と反復の順番のシード
+//   - FAKECLOCK: time.Now の時刻とモード（fakeclock パッケージを参照）
+//
+// crypto/rand を置き換えた実行ファイルは安全ではないため、テスト以外では使わないでください。
+// マップの順番は 1 つのゴルーチンで作って反復したマップだけが揃います。
+package deterministic
+
+import "strconv"
+
+// Env は seed から各環境変数を設定した "KEY=value" の一覧を返します。
+// PID とホスト名も seed から決め、時計は FAKECLOCK の virtual モードで 2025-09-27T00:00:00Z から始めます
+func Env(seed uint64) []string {
+	s := strconv.FormatUint(seed, 10)
+	return []string{
+		"DETERMINISTIC_RAND_SEED=" + s,
+		"DETERMINISTIC_CRYPTO_SEED=" + s,
+		"DETERMINISTIC_PID=" + strconv.FormatUint(1000+seed%30000, 10),
+		"DETERMINISTIC_HOSTNAME=deterministic-" + s,
+		"DETERMINISTIC_MAP_SEED=" + s,
+		"FAKECLOCK=2025-09-27T00:00:00Z virtual",
+	}
+}
@@ -0,0 +1,131 @@
+package deterministic_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/overlay/deterministic"
+	"github.com/newmo-oss/gocon25-workshop/overlay/overlaygen"
+)
+
+// program は置き換えたすべての値を出力します
+const program = `package main
+
+import (
+	cryptorand "crypto/rand"
+	"fmt"
+	"math/rand"
+	randv2 "math/rand/v2"
+	"os"
+	"time"
+)
+
+func main() {
+	start := time.Now()
+	time.Sleep(time.Hour)
+	fmt.Println("time", start.Format(time.RFC3339Nano), time.Since(start))
+	fmt.Println("math/rand", rand.Int63(), rand.Intn(100))
+	fmt.Println("math/rand/v2", randv2.Uint64(), randv2.IntN(100))
+	b := make([]byte, 16)
+	cryptorand.Read(b)
+	fmt.Printf("crypto/rand %x %s\n", b, cryptorand.Text())
+	fmt.Println("pid", os.Getpid())
+	host, _ := os.Hostname()
+	fmt.Println("hostname", host)
+
+	small := map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+	large := make(map[int]bool)
+	for i := range 100 {
+		large[i] = true
+	}
+	fmt.Print("map")
+	for k := range small {
+		fmt.Print(" ", k)
+	}
+	for k := range large {
+		fmt.Print(" ", k)
+	}
+	fmt.Println()
+}
+`
+
+func TestOverlay(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping build test in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+
+	spec, err := overlaygen.ReadSpec("spec.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := (&overlaygen.Generator{CacheDir: t.TempDir()}).Generate(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay := filepath.Join(t.TempDir(), "overlay.json")
+	if err := o.Write(overlay); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"go.mod":  "module repro\n",
+		"main.go": program,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bin := filepath.Join(t.TempDir(), "repro")
+	build := exec.Command("go", "build", "-o", bin, "-overlay", overlay, ".")
+	build.Dir = dir
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("go build -overlay: %v\n%s", err, out)
+	}
+
+	run := func(env []string) string {
+		t.Helper()
+		// 1 時間の Sleep は仮想時間で進むため、実際にはすぐに終わります
+		ctx, cancel := context.WithTimeout(t.Context(), time.Minute)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, bin)
+		cmd.Env = append(os.Environ(), env...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", bin, err, out)
+		}
+		return string(out)
+	}
+
+	first := run(deterministic.Env(1))
+	for range 3 {
+		if out := run(deterministic.Env(1)); out != first {
+			t.Fatalf("output differs with the same seed\nfirst:\n%s\nthen:\n%s", first, out)
+		}
+	}
+	for _, want := range []string{
+		"time 2025-09-27T00:00:00Z 1h0m0s\n",
+		"pid 1001\n",
+		"hostname deterministic-1\n",
+	} {
+		if !strings.Contains(first, want) {
+			t.Errorf("output does not contain %q\n%s", want, first)
+		}
+	}
+
+	// シードを変えると時計以外の値はすべて変わります
+	other := strings.Split(run(deterministic.Env(2)), "\n")
+	for i, line := range strings.Split(first, "\n")[1:] {
+		if line != "" && line == other[i+1] {
+			t.Errorf("%q does not change with another seed", line)
+		}
+	}
+}
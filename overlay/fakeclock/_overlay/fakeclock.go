@@ -0,0 +1,16 @@
+// このファイルは overlay で overlay/fakeclock パッケージに zz_overlay.go として追加され、
+// time パッケージに追加した関数を呼べるようにします。
+
+package fakeclock
+
+import (
+	"time"
+	_ "unsafe" // go:linkname
+)
+
+//go:linkname timeAdvance time.fakeclockAdvance
+func timeAdvance(d time.Duration) bool
+
+func init() {
+	advance = timeAdvance
+}
@@ -0,0 +1,32 @@
+// このファイルは overlay で runtime パッケージに zz_fakeclock.go として追加され、
+// playground 向けの faketime の仕組みを実行時に有効にできるようにします。
+// faketime が 0 でないとき nanotime はその値を返し、すべてのゴルーチンが
+// ブロックすると checkdead が次のタイマーの時刻まで faketime を進めます。
+
+package runtime
+
+import _ "unsafe" // go:linkname
+
+// fakeclockStart は単調時計を現在の値で止め、以降は仮想時間で進めます。
+// time パッケージから go:linkname で呼ばれます
+//
+//go:linkname fakeclockStart
+func fakeclockStart() {
+	lock(&sched.lock)
+	if faketime == 0 {
+		faketime = nanotime1()
+	}
+	unlock(&sched.lock)
+}
+
+// fakeclockAdd は仮想時間を d ナノ秒進めます。
+// 期限を過ぎたタイマーは次にスケジューラがタイマーを調べたときに発火します
+//
+//go:linkname fakeclockAdd
+func fakeclockAdd(d int64) {
+	lock(&sched.lock)
+	if faketime != 0 && d > 0 {
+		faketime += d
+	}
+	unlock(&sched.lock)
+}
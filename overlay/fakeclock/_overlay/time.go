@@ -0,0 +1,157 @@
+// このファイルは overlay で time パッケージに zz_fakeclock.go として追加され、
+// Now を FAKECLOCK 環境変数または FAKECLOCK_FILE のファイルで指定した時計にします。
+// どちらも設定されていない場合は元の Now のままです。
+// virtual モードでは runtime の単調時計も仮想時間にし、Sleep やタイマーも同じ時計で動かします。
+
+package time
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+	_ "unsafe" // go:linkname
+)
+
+// fakeClock は置き換えた時計の状態です
+type fakeClock struct {
+	mu sync.Mutex
+	// mode は frozen, offset, step, virtual のいずれかです
+	mode  string
+	start Time
+	// step は step モードで Now を呼ぶたびに進める時間です
+	step  Duration
+	calls int64
+	// base は offset と virtual モードで経過時間を測るための開始時の単調時計の値です
+	base int64
+	// advanced は fakeclockAdvance で進めた時間です
+	advanced Duration
+}
+
+var (
+	fakeclockOnce  sync.Once
+	fakeclockState *fakeClock
+)
+
+// runtimeFakeclockStart と runtimeFakeclockAdd は overlay で runtime に追加される関数です
+//
+//go:linkname runtimeFakeclockStart runtime.fakeclockStart
+func runtimeFakeclockStart()
+
+//go:linkname runtimeFakeclockAdd runtime.fakeclockAdd
+func runtimeFakeclockAdd(d int64)
+
+// init は virtual モードのとき、タイマーが作られる前に runtime の時計を仮想時間に切り替えます
+func init() {
+	fakeclockOnce.Do(fakeclockInit)
+}
+
+// fakeclockInit は環境変数またはファイルから時計の設定を読み込みます。
+// 書式は "2025-09-27T00:00:00Z [frozen|offset|step=1s|virtual]" で、モードを省略すると frozen です。
+func fakeclockInit() {
+	spec, ok := syscall.Getenv("FAKECLOCK")
+	if !ok {
+		path, ok := syscall.Getenv("FAKECLOCK_FILE")
+		if !ok {
+			return
+		}
+		data, err := readFile(path)
+		if err != nil {
+			panic("time: reading FAKECLOCK_FILE: " + err.Error())
+		}
+		spec = string(data)
+	}
+
+	c, err := parseFakeClock(spec)
+	if err != nil {
+		panic("time: invalid fake clock " + quote(spec) + ": " + err.Error())
+	}
+	if c.mode == "virtual" {
+		runtimeFakeclockStart()
+	}
+	c.base = runtimeNano()
+	fakeclockState = c
+}
+
+func parseFakeClock(spec string) (*fakeClock, error) {
+	fields := splitSpace(spec)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, errors.New("want \"<RFC3339 time> [frozen|offset|step=<duration>|virtual]\"")
+	}
+	start, err := Parse(RFC3339Nano, fields[0])
+	if err != nil {
+		return nil, err
+	}
+	c := &fakeClock{mode: "frozen", start: start}
+	if len(fields) == 2 {
+		switch mode := fields[1]; {
+		case mode == "frozen", mode == "offset", mode == "virtual":
+			c.mode = mode
+		case len(mode) > 5 && mode[:5] == "step=":
+			c.mode = "step"
+			if c.step, err = ParseDuration(mode[5:]); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errors.New("unknown mode " + quote(mode))
+		}
+	}
+	return c, nil
+}
+
+// splitSpace は空白で区切ったフィールドを返します。time パッケージは strings をインポートできません
+func splitSpace(s string) []string {
+	var fields []string
+	start := -1
+	for i := 0; i <= len(s); i++ {
+		if i == len(s) || s[i] == ' ' || s[i] == '\t' || s[i] == '\n' || s[i] == '\r' {
+			if start >= 0 {
+				fields = append(fields, s[start:i])
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	return fields
+}
+
+// fakeNow は置き換えた時計の現在時刻を返します。時計が設定されていない場合は false を返します
+func fakeNow() (Time, bool) {
+	fakeclockOnce.Do(fakeclockInit)
+	c := fakeclockState
+	if c == nil {
+		return Time{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.start.Add(c.advanced)
+	switch c.mode {
+	case "offset", "virtual":
+		t = t.Add(Duration(runtimeNano() - c.base))
+	case "step":
+		t = t.Add(Duration(c.calls) * c.step)
+		c.calls++
+	}
+	return t, true
+}
+
+// fakeclockAdvance は時計を d だけ進めます。overlay/fakeclock から go:linkname で呼ばれます。
+// virtual モードでは runtime の時計を進めるため、期限を過ぎたタイマーも発火します。
+//
+//go:linkname fakeclockAdvance
+func fakeclockAdvance(d Duration) bool {
+	fakeclockOnce.Do(fakeclockInit)
+	c := fakeclockState
+	if c == nil {
+		return false
+	}
+	if c.mode == "virtual" {
+		runtimeFakeclockAdd(int64(d))
+		return true
+	}
+	c.mu.Lock()
+	c.advanced += d
+	c.mu.Unlock()
+	return true
+}
@@ -0,0 +1,36 @@
+// Package fakeclock は overlay で置き換えた time パッケージの時計をテストから操作します。
+//
+// 次のように overlay を生成し、FAKECLOCK 環境変数で時計の初期値とモードを指定してビルドします。
+//
+//	go run ./overlay/cmd/overlaygen -o /tmp/fakeclock.json ./overlay/fakeclock/spec.json
+//	FAKECLOCK="2025-09-27T00:00:00Z step=1s" go test -overlay /tmp/fakeclock.json ./...
+//
+// FAKECLOCK の書式は "<RFC3339 の時刻> [frozen|offset|step=<時間>|virtual]" です。
+//
+//   - frozen: time.Now は常に同じ時刻を返します（省略時）
+//   - offset: 指定した時刻から実際の時間の経過に合わせて進みます
+//   - step=1s: time.Now を呼ぶたびに指定した時間だけ進みます
+//   - virtual: runtime の時計も仮想時間にし、すべてのゴルーチンがブロックすると次のタイマーまで進みます
+//
+// virtual モードでは time.Sleep, time.After, time.Tick などのタイマーも仮想時間で動くため、
+// 1 時間のタイムアウトも実際には待たずに発火します。
+//
+// FAKECLOCK の代わりに FAKECLOCK_FILE で同じ書式のファイルを指定することもできます。
+// どちらも設定されていない場合、time.Now は実際の時刻を返します。
+package fakeclock
+
+import "time"
+
+// advance は overlay で追加されるファイルが time パッケージの関数を設定します
+var advance func(d time.Duration) bool
+
+// Enabled は overlay でビルドされていて、時計が FAKECLOCK または FAKECLOCK_FILE で設定されているかどうかを返します
+func Enabled() bool {
+	return advance != nil && advance(0)
+}
+
+// Advance は time.Now が返す時刻を d だけ進めます。virtual モードでは期限を過ぎたタイマーも発火します。
+// 時計が置き換えられていない場合は何もせずに false を返します。
+func Advance(d time.Duration) bool {
+	return advance != nil && advance(d)
+}
@@ -0,0 +1,203 @@
+package fakeclock_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/overlay/fakeclock"
+	"github.com/newmo-oss/gocon25-workshop/overlay/overlaygen"
+)
+
+var start = time.Date(2025, 9, 27, 0, 0, 0, 0, time.UTC)
+
+// mode は FAKECLOCK または FAKECLOCK_FILE で指定されたモードを返します
+func mode(t *testing.T) string {
+	t.Helper()
+	spec := os.Getenv("FAKECLOCK")
+	if spec == "" {
+		data, err := os.ReadFile(os.Getenv("FAKECLOCK_FILE"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec = string(data)
+	}
+	_, mode, _ := strings.Cut(strings.TrimSpace(spec), " ")
+	return mode
+}
+
+// TestClock は TestOverlay から overlay と FAKECLOCK を指定して実行されます
+func TestClock(t *testing.T) {
+	if !fakeclock.Enabled() {
+		t.Skip("time is not overlaid")
+	}
+
+	switch mode := mode(t); mode {
+	case "", "frozen":
+		if a, b := time.Now(), time.Now(); !a.Equal(start) || !b.Equal(start) {
+			t.Errorf("Now() = %v, %v; want %v", a, b, start)
+		}
+		fakeclock.Advance(time.Hour)
+		if now := time.Now(); !now.Equal(start.Add(time.Hour)) {
+			t.Errorf("Now() after Advance(1h) = %v; want %v", now, start.Add(time.Hour))
+		}
+	case "step=1s":
+		a, b := time.Now(), time.Now()
+		if b.Sub(a) != time.Second {
+			t.Errorf("Now() = %v, %v; want 1s step", a, b)
+		}
+		fakeclock.Advance(time.Hour)
+		if c := time.Now(); c.Sub(b) != time.Hour+time.Second {
+			t.Errorf("Now() after Advance(1h) = %v; want %v", c, b.Add(time.Hour+time.Second))
+		}
+	case "offset":
+		a := time.Now()
+		if a.Before(start) || a.After(start.Add(time.Minute)) {
+			t.Errorf("Now() = %v; want shortly after %v", a, start)
+		}
+		fakeclock.Advance(time.Hour)
+		if b := time.Now(); b.Sub(a) < time.Hour || b.Sub(a) > time.Hour+time.Minute {
+			t.Errorf("Now() after Advance(1h) = %v; want about %v", b, a.Add(time.Hour))
+		}
+	case "virtual":
+		a := time.Now()
+		if a.Before(start) || a.After(start.Add(time.Minute)) {
+			t.Errorf("Now() = %v; want shortly after %v", a, start)
+		}
+		timer := time.NewTimer(time.Hour)
+		fakeclock.Advance(time.Hour)
+		<-timer.C
+		if d := time.Since(a); d != time.Hour {
+			t.Errorf("Since() after Advance(1h) = %v; want 1h", d)
+		}
+	default:
+		t.Fatalf("unexpected mode %q", mode)
+	}
+}
+
+// TestVirtual は TestOverlay から virtual モードで実行され、
+// すべてのゴルーチンがタイマーを待っている間は時計が次のタイマーまで進むことを確かめます
+func TestVirtual(t *testing.T) {
+	if !fakeclock.Enabled() || mode(t) != "virtual" {
+		t.Skip("time is not overlaid in virtual mode")
+	}
+
+	begin := time.Now()
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, fmt.Sprintf("%s %v", name, time.Since(begin)))
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Hour)
+	defer cancel()
+	go func() {
+		time.Sleep(10 * time.Minute)
+		record("sleep")
+	}()
+	time.AfterFunc(20*time.Minute, func() { record("afterfunc") })
+	ticker := time.NewTicker(25 * time.Minute)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case <-ticker.C:
+			record("tick")
+		case <-time.After(2 * time.Hour):
+			t.Fatal("context is not canceled in 1h")
+		case <-ctx.Done():
+			record("timeout")
+			done = true
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"sleep 10m0s", "afterfunc 20m0s", "tick 25m0s", "tick 50m0s", "timeout 1h0m0s"}
+	if !slices.Equal(events, want) {
+		t.Errorf("events = %q; want %q", events, want)
+	}
+	if now := time.Now(); !now.Equal(begin.Add(time.Hour)) || time.Until(begin) != -time.Hour {
+		t.Errorf("Now() = %v after 1h timeout from %v", now, begin)
+	}
+}
+
+func TestNotEnabled(t *testing.T) {
+	if fakeclock.Enabled() {
+		t.Skip("time is overlaid")
+	}
+	if fakeclock.Advance(time.Hour) {
+		t.Error("Advance succeeded without the overlay")
+	}
+	if d := time.Since(time.Now()); d < 0 || d > time.Minute {
+		t.Errorf("time does not follow the real clock: %v", d)
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping build test in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+
+	spec, err := overlaygen.ReadSpec("spec.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := (&overlaygen.Generator{CacheDir: t.TempDir()}).Generate(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay := filepath.Join(t.TempDir(), "overlay.json")
+	if err := o.Write(overlay); err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(t.TempDir(), "fakeclock.test")
+	if out, err := exec.Command("go", "test", "-c", "-o", bin, "-overlay", overlay, ".").CombinedOutput(); err != nil {
+		t.Fatalf("go test -c -overlay: %v\n%s", err, out)
+	}
+
+	control := filepath.Join(t.TempDir(), "clock")
+	if err := os.WriteFile(control, []byte("2025-09-27T00:00:00Z\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, env := range []string{
+		"FAKECLOCK=2025-09-27T00:00:00Z",
+		"FAKECLOCK=2025-09-27T00:00:00Z step=1s",
+		"FAKECLOCK=2025-09-27T00:00:00Z offset",
+		"FAKECLOCK=2025-09-27T00:00:00Z virtual",
+		"FAKECLOCK_FILE=" + control,
+	} {
+		cmd := exec.Command(bin, "-test.v", "-test.run", "^TestClock$")
+		cmd.Env = append(os.Environ(), env)
+		out, err := cmd.CombinedOutput()
+		if err != nil || !strings.Contains(string(out), "--- PASS: TestClock") {
+			t.Errorf("%s: %v\n%s", env, err, out)
+		}
+	}
+
+	// 1 時間のタイムアウトが実際には待たずに、何度実行しても同じ結果で終わることを確かめます。
+	// -test.timeout のアラームも仮想時間で進むため、実行する回数分の時間より長くします
+	ctx, cancel := context.WithTimeout(t.Context(), time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, bin, "-test.v", "-test.run", "^TestVirtual$", "-test.count", "3", "-test.timeout", "24h")
+	cmd.Env = append(os.Environ(), "FAKECLOCK=2025-09-27T00:00:00Z virtual")
+	begin := time.Now()
+	out, err := cmd.CombinedOutput()
+	if elapsed := time.Since(begin); err != nil || strings.Count(string(out), "--- PASS: TestVirtual") != 3 || elapsed > 30*time.Second {
+		t.Errorf("virtual mode took %v: %v\n%s", elapsed, err, out)
+	}
+}
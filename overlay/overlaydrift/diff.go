@@ -0,0 +1,152 @@
+package overlaydrift
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Hunk は元のファイルの [Start, End) の行を Lines に置き換える変更です。
+// 行番号は 0 から数え、NewStart は変更後のファイルで Lines が始まる行です
+type Hunk struct {
+	Start, End int
+	NewStart   int
+	Lines      []string
+}
+
+// Conflict は同じ場所を変更した上流の変更とパッチの組です
+type Conflict struct {
+	Upstream, Patch Hunk
+}
+
+// splitLines は改行を含めたまま行に分けます
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diff は a を b にする変更を Myers のアルゴリズムで求めます
+func diff(a, b []string) []Hunk {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, slices.Clone(v))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// 終点から経路をたどり、一致した行の組を集めます
+	var matches [][2]int
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			matches = append(matches, [2]int{x, y})
+		}
+		if d > 0 {
+			x, y = prevX, prevY
+		}
+	}
+	slices.Reverse(matches)
+
+	var hunks []Hunk
+	i, j := 0, 0
+	for _, match := range append(matches, [2]int{n, m}) {
+		if i < match[0] || j < match[1] {
+			hunks = append(hunks, Hunk{Start: i, End: match[0], NewStart: j, Lines: b[j:match[1]]})
+		}
+		i, j = match[0]+1, match[1]+1
+	}
+	return hunks
+}
+
+// overlaps は 2 つの変更が重なるか隣接しているかを返します。
+// 隣接した変更も自動ではまとめず、衝突として扱います
+func overlaps(a, b Hunk) bool {
+	return a.Start <= b.End && b.Start <= a.End
+}
+
+// conflicts は上流の変更とパッチの衝突を返します
+func conflicts(upstream, patch []Hunk) []Conflict {
+	var cs []Conflict
+	for _, u := range upstream {
+		for _, p := range patch {
+			if overlaps(u, p) {
+				cs = append(cs, Conflict{Upstream: u, Patch: p})
+			}
+		}
+	}
+	return cs
+}
+
+// apply は衝突しない変更を base にまとめて適用します
+func apply(base []string, hunks ...[]Hunk) string {
+	all := slices.Concat(hunks...)
+	slices.SortFunc(all, func(a, b Hunk) int { return a.Start - b.Start })
+	var sb strings.Builder
+	i := 0
+	for _, h := range all {
+		for _, line := range base[i:h.Start] {
+			sb.WriteString(line)
+		}
+		for _, line := range h.Lines {
+			sb.WriteString(line)
+		}
+		i = h.End
+	}
+	for _, line := range base[i:] {
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+// formatHunk は変更を unified diff の形式で書き出します
+func formatHunk(sb *strings.Builder, base []string, h Hunk) {
+	fmt.Fprintf(sb, "@@ -%d,%d +%d,%d @@\n", h.Start+1, h.End-h.Start, h.NewStart+1, len(h.Lines))
+	for _, line := range base[h.Start:h.End] {
+		writeLine(sb, "-", line)
+	}
+	for _, line := range h.Lines {
+		writeLine(sb, "+", line)
+	}
+}
+
+func writeLine(sb *strings.Builder, prefix, line string) {
+	sb.WriteString(prefix)
+	sb.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		sb.WriteString("\n\\ No newline at end of file\n")
+	}
+}
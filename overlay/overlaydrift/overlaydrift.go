@@ -0,0 +1,366 @@
+// Package overlaydrift は GOROOT のファイルをコピーして書き換えた overlay のファイルが、
+// 現在の GOROOT のファイルからずれていないかを調べます。
+//
+// Go を更新すると、overlay に置いた古いコピーが新しい標準ライブラリのファイルを置き換え、
+// ビルドできなくなったり、バグ修正が黙って失われたりします。
+// overlay のファイルの横にはコピー元のファイルのハッシュと Go のバージョンを記録したメタデータ
+// （time.go に対する time.go.base.json）を置きます。
+//
+//	{
+//	  "original": "src/time/time.go",
+//	  "goVersion": "go1.25.1",
+//	  "sha256": "..."
+//	}
+//
+// コピー元、現在の GOROOT、overlay の 3 つのファイルを比べ、上流の変更がパッチを当てた部分と
+// 重ならなければ、上流の変更を overlay のファイルに取り込み直せます（リベース）。
+// コピー元のファイルは、現在の GOROOT のファイルのハッシュが一致しない場合、
+// golang.org/toolchain モジュールからそのバージョンのものを取得します。
+package overlaydrift
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/newmo-oss/gocon25-workshop/overlay/overlaygen"
+)
+
+// Meta は overlay のファイルのコピー元を記録したメタデータです
+type Meta struct {
+	// Original はコピー元のファイルの GOROOT からの相対パスです（例: "src/time/time.go"）
+	Original string `json:"original"`
+	// GoVersion はコピー元の Go のバージョンです（例: "go1.25.1"）
+	GoVersion string `json:"goVersion"`
+	// SHA256 はコピー元のファイルの SHA-256 です
+	SHA256 string `json:"sha256"`
+}
+
+// MetaPath は overlay のファイルに対応するメタデータのパスを返します
+func MetaPath(file string) string {
+	return file + ".base.json"
+}
+
+// ReadMeta はメタデータを読み込みます
+func ReadMeta(path string) (*Meta, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Meta
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if m.Original == "" || m.GoVersion == "" || m.SHA256 == "" {
+		return nil, fmt.Errorf("%s: original, goVersion and sha256 are required", path)
+	}
+	return &m, nil
+}
+
+// Write はメタデータを書き出します
+func (m *Meta) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Result は overlay のファイル 1 つを調べた結果です
+type Result struct {
+	// File は overlay のファイル、Target は置き換えられる現在の GOROOT のファイルです
+	File, Target string
+	Meta         *Meta
+	// GoVersion は現在の GOROOT の Go のバージョンです
+	GoVersion string
+	// Upstream はコピー元から現在の GOROOT への変更、Patch はコピー元から overlay のファイルへの変更です
+	Upstream, Patch []Hunk
+	// Conflicts はパッチを当てた部分と重なる上流の変更です
+	Conflicts []Conflict
+
+	base []string
+}
+
+// Drifted は上流のファイルがコピー元から変わったかどうかを返します
+func (r *Result) Drifted() bool {
+	return len(r.Upstream) > 0
+}
+
+// Diff はコピー元から現在の GOROOT への変更と、コピー元から overlay のファイルへの変更を
+// unified diff の形式で返します
+func (r *Result) Diff() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s %s\n+++ %s %s\n", r.Meta.Original, r.Meta.GoVersion, r.Meta.Original, r.GoVersion)
+	for _, h := range r.Upstream {
+		formatHunk(&sb, r.base, h)
+	}
+	fmt.Fprintf(&sb, "--- %s %s\n+++ %s\n", r.Meta.Original, r.Meta.GoVersion, r.File)
+	for _, h := range r.Patch {
+		formatHunk(&sb, r.base, h)
+	}
+	return sb.String()
+}
+
+// Rebased は上流の変更を取り込んだ overlay のファイルの内容を返します。
+// 上流の変更がパッチを当てた部分と重なる場合は自動では取り込めないためエラーを返します。
+func (r *Result) Rebased() ([]byte, error) {
+	if len(r.Conflicts) > 0 {
+		var lines []string
+		for _, c := range r.Conflicts {
+			lines = append(lines, fmt.Sprintf("upstream lines %d-%d overlap patched lines %d-%d", c.Upstream.Start+1, c.Upstream.End, c.Patch.Start+1, c.Patch.End))
+		}
+		return nil, fmt.Errorf("%s: %s changed inside the patched region since %s: %s", r.File, r.Meta.Original, r.Meta.GoVersion, strings.Join(lines, ", "))
+	}
+	return []byte(apply(r.base, r.Upstream, r.Patch)), nil
+}
+
+// Checker は overlay のファイルと GOROOT を比べます
+type Checker struct {
+	// Dir は overlay.json の相対パスの基準になるディレクトリです。空の場合はカレントディレクトリです
+	Dir string
+	// GOROOT と GoVersion は現在の Go です。空の場合は go env で取得します
+	GOROOT, GoVersion string
+	// Toolchain は Go のバージョンからそのツールチェインの GOROOT を返します。
+	// nil の場合は DownloadToolchain を使います
+	Toolchain func(goVersion string) (string, error)
+}
+
+// Check は overlay.json のうち、メタデータのある置き換えを調べます
+func (c *Checker) Check(overlayPath string) ([]*Result, error) {
+	entries, err := c.entries(overlayPath)
+	if err != nil {
+		return nil, err
+	}
+	var results []*Result
+	for _, e := range entries {
+		if _, err := os.Stat(MetaPath(e.file)); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		r, err := c.CheckFile(e.file)
+		if err != nil {
+			return nil, err
+		}
+		if e.target != r.Target {
+			return nil, fmt.Errorf("%s replaces %s but its metadata records %s", e.file, e.target, r.Meta.Original)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// RecordMissing は overlay.json のうち GOROOT のファイルを置き換えていてメタデータのないものについて、
+// 現在の GOROOT のファイルをコピー元としてメタデータを書き出し、そのファイルを返します
+func (c *Checker) RecordMissing(overlayPath string) ([]string, error) {
+	entries, err := c.entries(overlayPath)
+	if err != nil {
+		return nil, err
+	}
+	var recorded []string
+	for _, e := range entries {
+		if _, err := os.Stat(MetaPath(e.file)); !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if rel, err := filepath.Rel(c.GOROOT, e.target); err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+		if err := c.Record(e.file, e.target); err != nil {
+			return nil, err
+		}
+		recorded = append(recorded, e.file)
+	}
+	return recorded, nil
+}
+
+// entry は overlay.json の置き換え 1 つです
+type entry struct {
+	target, file string
+}
+
+// entries は overlay.json を読み込み、${GOROOT} と相対パスを解決します。ファイルの削除は除きます
+func (c *Checker) entries(overlayPath string) ([]entry, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(overlayPath)
+	if err != nil {
+		return nil, err
+	}
+	var o overlaygen.Overlay
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, fmt.Errorf("%s: %w", overlayPath, err)
+	}
+
+	var entries []entry
+	for _, target := range sortedKeys(o.Replace) {
+		file := o.Replace[target]
+		if file == "" {
+			continue
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(c.Dir, file)
+		}
+		entries = append(entries, entry{
+			target: filepath.Clean(strings.ReplaceAll(target, "${GOROOT}", c.GOROOT)),
+			file:   file,
+		})
+	}
+	return entries, nil
+}
+
+// CheckFile はメタデータを使って overlay のファイルを調べます
+func (c *Checker) CheckFile(file string) (*Result, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	m, err := ReadMeta(MetaPath(file))
+	if err != nil {
+		return nil, err
+	}
+	target := filepath.Join(c.GOROOT, filepath.FromSlash(m.Original))
+	current, err := os.ReadFile(target)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	base, err := c.base(m, current)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Result{
+		File:      file,
+		Target:    target,
+		Meta:      m,
+		GoVersion: c.GoVersion,
+		base:      splitLines(string(base)),
+	}
+	r.Patch = diff(r.base, splitLines(string(patched)))
+	if !bytes.Equal(base, current) {
+		r.Upstream = diff(r.base, splitLines(string(current)))
+		r.Conflicts = conflicts(r.Upstream, r.Patch)
+	}
+	return r, nil
+}
+
+// Rebase は上流の変更を overlay のファイルに取り込み、メタデータを現在の GOROOT のものにします
+func (c *Checker) Rebase(r *Result) error {
+	rebased, err := r.Rebased()
+	if err != nil {
+		return err
+	}
+	current, err := os.ReadFile(r.Target)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(r.File, rebased, 0o644); err != nil {
+		return err
+	}
+	m := &Meta{Original: r.Meta.Original, GoVersion: r.GoVersion, SHA256: hash(current)}
+	return m.Write(MetaPath(r.File))
+}
+
+// Record は現在の GOROOT の target をコピー元として file のメタデータを書き出します
+func (c *Checker) Record(file, target string) error {
+	if err := c.init(); err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(c.GOROOT, target)
+	if err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("%s is not in GOROOT %s", target, c.GOROOT)
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return err
+	}
+	m := &Meta{Original: filepath.ToSlash(rel), GoVersion: c.GoVersion, SHA256: hash(data)}
+	return m.Write(MetaPath(file))
+}
+
+func (c *Checker) init() error {
+	if c.GOROOT != "" && c.GoVersion != "" {
+		return nil
+	}
+	out, err := exec.Command("go", "env", "-json", "GOROOT", "GOVERSION").Output()
+	if err != nil {
+		return fmt.Errorf("go env: %w", err)
+	}
+	var env struct{ GOROOT, GOVERSION string }
+	if err := json.Unmarshal(out, &env); err != nil {
+		return err
+	}
+	if c.GOROOT == "" {
+		c.GOROOT = env.GOROOT
+	}
+	if c.GoVersion == "" {
+		c.GoVersion = env.GOVERSION
+	}
+	return nil
+}
+
+// base はハッシュが一致するコピー元のファイルを探します
+func (c *Checker) base(m *Meta, current []byte) ([]byte, error) {
+	if hash(current) == m.SHA256 {
+		return current, nil
+	}
+	toolchain := c.Toolchain
+	if toolchain == nil {
+		toolchain = DownloadToolchain
+	}
+	goroot, err := toolchain(m.GoVersion)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(goroot, filepath.FromSlash(m.Original))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if hash(data) != m.SHA256 {
+		return nil, fmt.Errorf("%s does not match the recorded sha256 %s", path, m.SHA256)
+	}
+	return data, nil
+}
+
+// DownloadToolchain は golang.org/toolchain モジュールから指定したバージョンの Go を
+// モジュールキャッシュにダウンロードし、その GOROOT を返します
+func DownloadToolchain(goVersion string) (string, error) {
+	mod := fmt.Sprintf("golang.org/toolchain@v0.0.1-%s.%s-%s", goVersion, runtime.GOOS, runtime.GOARCH)
+	out, err := exec.Command("go", "mod", "download", "-json", mod).Output()
+	var dl struct{ Dir, Error string }
+	if jsonErr := json.Unmarshal(out, &dl); jsonErr != nil && err == nil {
+		err = jsonErr
+	}
+	switch {
+	case dl.Error != "":
+		return "", fmt.Errorf("go mod download %s: %s", mod, dl.Error)
+	case err != nil:
+		return "", fmt.Errorf("go mod download %s: %w", mod, err)
+	}
+	return dl.Dir, nil
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
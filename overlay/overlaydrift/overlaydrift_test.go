@@ -0,0 +1,180 @@
+package overlaydrift
+
+import (
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	lines := func() []string {
+		s := make([]string, r.IntN(20))
+		for i := range s {
+			s[i] = string(rune('a'+r.IntN(4))) + "\n"
+		}
+		return s
+	}
+	for range 1000 {
+		a, b := lines(), lines()
+		if got, want := apply(a, diff(a, b)), strings.Join(b, ""); got != want {
+			t.Fatalf("apply(a, diff(a, b)) = %q; want %q (a = %q)", got, want, a)
+		}
+	}
+}
+
+const base = `package time
+
+func Now() Time {
+	sec, nsec, mono := now()
+	return Time{sec, nsec, mono}
+}
+
+func Since(t Time) Duration {
+	return Now().Sub(t)
+}
+
+func Until(t Time) Duration {
+	return t.Sub(Now())
+}
+`
+
+// patched は base の Now を置き換えたものです
+var patched = strings.Replace(base, "	sec, nsec, mono := now()\n	return Time{sec, nsec, mono}\n", "	return Date(2025, 9, 27, 0, 0, 0, 0, UTC)\n", 1)
+
+// setup は base を go1.0 として記録した overlay のファイルと、current を置いた GOROOT を作ります
+func setup(t *testing.T, current string) (*Checker, string) {
+	t.Helper()
+	oldRoot, goroot, dir := t.TempDir(), t.TempDir(), t.TempDir()
+	for root, content := range map[string]string{oldRoot: base, goroot: current} {
+		if err := os.MkdirAll(filepath.Join(root, "src", "time"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, "src", "time", "time.go"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := filepath.Join(dir, "time.go")
+	if err := os.WriteFile(file, []byte(patched), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Meta{Original: "src/time/time.go", GoVersion: "go1.0", SHA256: hash([]byte(base))}).Write(MetaPath(file)); err != nil {
+		t.Fatal(err)
+	}
+	overlay := `{"Replace": {"${GOROOT}/src/time/time.go": "time.go"}}`
+	if err := os.WriteFile(filepath.Join(dir, "overlay.json"), []byte(overlay), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Checker{
+		Dir:       dir,
+		GOROOT:    goroot,
+		GoVersion: "go1.1",
+		Toolchain: func(goVersion string) (string, error) {
+			if goVersion != "go1.0" {
+				t.Errorf("Toolchain(%q); want go1.0", goVersion)
+			}
+			return oldRoot, nil
+		},
+	}
+	return c, filepath.Join(dir, "overlay.json")
+}
+
+func check(t *testing.T, c *Checker, overlay string) *Result {
+	t.Helper()
+	results, err := c.Check(overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Check returned %d results; want 1", len(results))
+	}
+	return results[0]
+}
+
+func TestCheck(t *testing.T) {
+	t.Run("unchanged", func(t *testing.T) {
+		c, overlay := setup(t, base)
+		c.Toolchain = nil
+		if r := check(t, c, overlay); r.Drifted() || len(r.Patch) != 1 {
+			t.Errorf("Drifted() = %v, Patch = %v; want no drift and one patched hunk", r.Drifted(), r.Patch)
+		}
+	})
+
+	t.Run("rebase", func(t *testing.T) {
+		current := strings.Replace(base, "return Now().Sub(t)", "return subMono(runtimeNano(), t)", 1)
+		c, overlay := setup(t, current)
+		r := check(t, c, overlay)
+		if !r.Drifted() || len(r.Conflicts) != 0 {
+			t.Fatalf("Drifted() = %v, Conflicts = %v; want drift outside the patch", r.Drifted(), r.Conflicts)
+		}
+		if diff := r.Diff(); !strings.Contains(diff, "+\treturn subMono(runtimeNano(), t)\n") || !strings.Contains(diff, "+\treturn Date(2025, 9, 27, 0, 0, 0, 0, UTC)\n") {
+			t.Errorf("Diff() does not show both changes\n%s", diff)
+		}
+
+		if err := c.Rebase(r); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(r.File)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strings.Replace(patched, "return Now().Sub(t)", "return subMono(runtimeNano(), t)", 1); string(got) != want {
+			t.Errorf("rebased file =\n%s\nwant\n%s", got, want)
+		}
+		m, err := ReadMeta(MetaPath(r.File))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.GoVersion != "go1.1" || m.SHA256 != hash([]byte(current)) {
+			t.Errorf("metadata after rebase = %+v; want go1.1 and the hash of the current file", m)
+		}
+		c.Toolchain = nil
+		if r := check(t, c, overlay); r.Drifted() {
+			t.Error("still drifted after rebase")
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		c, overlay := setup(t, strings.Replace(base, "sec, nsec, mono := now()", "sec, nsec, mono := runtimeNow()", 1))
+		r := check(t, c, overlay)
+		if !r.Drifted() || len(r.Conflicts) != 1 {
+			t.Fatalf("Drifted() = %v, Conflicts = %v; want one conflict", r.Drifted(), r.Conflicts)
+		}
+		if err := c.Rebase(r); err == nil || !strings.Contains(err.Error(), "inside the patched region") {
+			t.Errorf("Rebase() = %v; want conflict error", err)
+		}
+		if got, _ := os.ReadFile(r.File); string(got) != patched {
+			t.Error("overlay file is modified by a failed rebase")
+		}
+	})
+
+	t.Run("unknown base", func(t *testing.T) {
+		c, overlay := setup(t, strings.Replace(base, "Until", "UntilTime", 1))
+		c.Toolchain = func(string) (string, error) { return c.GOROOT, nil }
+		if _, err := c.Check(overlay); err == nil || !strings.Contains(err.Error(), "does not match the recorded sha256") {
+			t.Errorf("Check() = %v; want hash mismatch", err)
+		}
+	})
+}
+
+func TestRecordMissing(t *testing.T) {
+	c, overlay := setup(t, base)
+	file := filepath.Join(c.Dir, "time.go")
+	if err := os.Remove(MetaPath(file)); err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := c.RecordMissing(overlay)
+	if err != nil || len(recorded) != 1 || recorded[0] != file {
+		t.Fatalf("RecordMissing() = %v, %v; want %s", recorded, err, file)
+	}
+	m, err := ReadMeta(MetaPath(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Meta{Original: "src/time/time.go", GoVersion: "go1.1", SHA256: hash([]byte(base))}); *m != want {
+		t.Errorf("metadata = %+v; want %+v", *m, want)
+	}
+}
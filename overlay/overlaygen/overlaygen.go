@@ -0,0 +1,458 @@
+// Package overlaygen は関数単位の指定から -overlay 用のファイルと overlay.json を生成します。
+//
+// 標準パッケージのファイルを丸ごとコピーして書き換えると、Go のバージョンが変わったときに
+// コピーが古くなりビルドできなくなります。このパッケージはビルドに使う GOROOT やモジュールキャッシュから
+// go list で元のファイルを探し、指定した関数の本体だけを AST の位置を使って置き換えます。
+//
+// 仕様の例:
+//
+//	{
+//	  "patches": [
+//	    {
+//	      "package": "time",
+//	      "func": "Now",
+//	      "body": "return Date(2025, 9, 27, 0, 0, 0, 0, UTC)"
+//	    }
+//	  ]
+//	}
+//
+// 置き換えたファイルは本体の後ろに /*line*/ ディレクティブを入れるため、
+// 他の関数の位置（パニックやデバッガーで表示される行番号）は元のファイルと同じになります。
+package overlaygen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Spec は生成する overlay の仕様です
+type Spec struct {
+	Patches []Patch `json:"patches"`
+	// Files はパッケージに追加するファイルです。置き換えた関数から呼ぶ宣言などを追加するときに使います
+	Files []File `json:"files,omitempty"`
+	// Include は一緒に生成する他の仕様ファイルです。ReadSpec はその置き換えとファイルをこの仕様にまとめます
+	Include []string `json:"include,omitempty"`
+}
+
+// Patch は関数1つ分の置き換えです
+type Patch struct {
+	// Package は関数を含むパッケージのインポートパスです
+	Package string `json:"package"`
+	// Func は関数名です。メソッドは "Time.String" や "(*Timer).Stop" のように指定します
+	Func string `json:"func"`
+	// Body は関数の新しい本体です。波括弧は含めません
+	Body string `json:"body"`
+	// Insert を指定すると本体を置き換えずに、元の本体の先頭に Body を挿入します
+	Insert bool `json:"insert,omitempty"`
+	// Imports は Body で使うために追加するパッケージのインポートパスです。既にインポートされていれば何もしません
+	Imports []string `json:"imports,omitempty"`
+}
+
+// File はパッケージのディレクトリに追加するファイルです
+type File struct {
+	// Package は追加先のパッケージのインポートパスです
+	Package string `json:"package"`
+	// Name はパッケージのディレクトリでのファイル名です。既にあるファイルの名前は使えません
+	Name string `json:"name"`
+	// Path は追加するファイルの内容です。ReadSpec は相対パスを仕様ファイルのディレクトリからの絶対パスにします
+	Path string `json:"path"`
+}
+
+// ReadSpec は JSON の仕様ファイルを読み込みます。Include の相対パスは仕様ファイルのディレクトリからのものです
+func ReadSpec(path string) (*Spec, error) {
+	s, err := readSpec(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	added := make(map[File]bool)
+	for _, f := range s.Files {
+		key := File{Package: f.Package, Name: f.Name}
+		if added[key] {
+			return nil, fmt.Errorf("%s: %s is added to %s more than once", path, f.Name, f.Package)
+		}
+		added[key] = true
+	}
+	return s, nil
+}
+
+// readSpec は仕様ファイルを読み込み、Include を再帰的にまとめます。including は読み込み中の仕様ファイルです
+func readSpec(path string, including []string) (*Spec, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(including, abs) {
+		return nil, fmt.Errorf("%s: include cycle", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Spec
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse spec %s: %w", path, err)
+	}
+	for i, p := range s.Patches {
+		if p.Package == "" || p.Func == "" {
+			return nil, fmt.Errorf("%s: patch %d: package and func are required", path, i)
+		}
+	}
+	for i := range s.Files {
+		f := &s.Files[i]
+		if f.Package == "" || f.Path == "" || filepath.Ext(f.Name) != ".go" || filepath.Base(f.Name) != f.Name {
+			return nil, fmt.Errorf("%s: file %d: package, path and a .go file name are required", path, i)
+		}
+		if !filepath.IsAbs(f.Path) {
+			abs, err := filepath.Abs(filepath.Join(filepath.Dir(path), f.Path))
+			if err != nil {
+				return nil, err
+			}
+			f.Path = abs
+		}
+	}
+	for _, inc := range s.Include {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+		is, err := readSpec(inc, append(including, abs))
+		if err != nil {
+			return nil, err
+		}
+		s.Patches = append(s.Patches, is.Patches...)
+		s.Files = append(s.Files, is.Files...)
+	}
+	s.Include = nil
+	return &s, nil
+}
+
+// Overlay は go build -overlay に渡す JSON です
+type Overlay struct {
+	// Replace は元のファイルの絶対パスから置き換えるファイルの絶対パスへの対応です
+	Replace map[string]string `json:"Replace"`
+}
+
+// Write は overlay.json を書き出します
+func (o *Overlay) Write(path string) error {
+	data, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Generator は仕様から置き換えたファイルを作ります
+type Generator struct {
+	// Dir は go list を実行するディレクトリです。モジュールのパッケージを探すときに使います
+	Dir string
+	// CacheDir は置き換えたファイルを書き出すディレクトリです。
+	// 空の場合はユーザーのキャッシュディレクトリの gocon25-overlay/overlaygen を使います
+	CacheDir string
+}
+
+// Generate は仕様の関数を置き換えたファイルをキャッシュディレクトリに書き出し、その overlay を返します。
+// 書き出すファイルの名前は元のファイルと置き換えの内容のハッシュで決まるため、
+// Go のバージョンが変わると別のファイルになります。
+func (g *Generator) Generate(s *Spec) (*Overlay, error) {
+	var pkgs []string
+	for _, p := range s.Patches {
+		pkgs = append(pkgs, p.Package)
+	}
+	for _, f := range s.Files {
+		pkgs = append(pkgs, f.Package)
+	}
+	listed, err := goList(g.Dir, pkgs)
+	if err != nil {
+		return nil, err
+	}
+	files, err := locate(listed, s.Patches)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheDir := g.CacheDir
+	if cacheDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		cacheDir = filepath.Join(dir, "gocon25-overlay", "overlaygen")
+	}
+
+	o := &Overlay{Replace: make(map[string]string)}
+	for _, path := range sortedKeys(files) {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		patched, err := Rewrite(path, src, files[path])
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(patched)
+		out := filepath.Join(cacheDir, fmt.Sprintf("%x", sum[:8]), filepath.Base(path))
+		if err := writeFile(out, patched); err != nil {
+			return nil, err
+		}
+		o.Replace[path] = out
+	}
+
+	for _, f := range s.Files {
+		pkg, ok := listed[f.Package]
+		if !ok {
+			return nil, fmt.Errorf("package %s not found", f.Package)
+		}
+		path := filepath.Join(pkg.Dir, f.Name)
+		if _, err := os.Stat(path); err == nil {
+			return nil, fmt.Errorf("%s already exists in %s", f.Name, f.Package)
+		}
+		if _, err := os.Stat(f.Path); err != nil {
+			return nil, err
+		}
+		o.Replace[path] = f.Path
+	}
+	return o, nil
+}
+
+// locate はパッケージのファイルから関数を探し、関数を含むファイルごとに置き換えをまとめます
+func locate(listed map[string]*listedPackage, patches []Patch) (map[string][]Patch, error) {
+	files := make(map[string][]Patch)
+	for _, p := range patches {
+		pkg, ok := listed[p.Package]
+		if !ok {
+			return nil, fmt.Errorf("package %s not found", p.Package)
+		}
+		path, err := findFunc(pkg, p.Func)
+		if err != nil {
+			return nil, err
+		}
+		files[path] = append(files[path], p)
+	}
+	return files, nil
+}
+
+// listedPackage は go list -json の出力のうち使うフィールドです
+type listedPackage struct {
+	ImportPath string
+	Dir        string
+	GoFiles    []string
+	CgoFiles   []string
+	Error      *struct{ Err string }
+}
+
+func goList(dir string, pkgs []string) (map[string]*listedPackage, error) {
+	cmd := exec.Command("go", append([]string{"list", "-e", "-json=ImportPath,Dir,GoFiles,CgoFiles,Error"}, pkgs...)...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %v\n%s", err, stderr.Bytes())
+	}
+
+	listed := make(map[string]*listedPackage)
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var p listedPackage
+		if err := dec.Decode(&p); err != nil {
+			return nil, err
+		}
+		if p.Error != nil {
+			return nil, fmt.Errorf("go list %s: %s", p.ImportPath, p.Error.Err)
+		}
+		listed[p.ImportPath] = &p
+	}
+	return listed, nil
+}
+
+// findFunc は現在の GOOS, GOARCH でビルドされるファイルから関数を探します
+func findFunc(pkg *listedPackage, name string) (string, error) {
+	var found []string
+	for _, f := range append(pkg.GoFiles, pkg.CgoFiles...) {
+		path := filepath.Join(pkg.Dir, f)
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return "", err
+		}
+		if lookupFunc(file, name) != nil {
+			found = append(found, path)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("%s: function %s not found", pkg.ImportPath, name)
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("%s: function %s found in multiple files: %s", pkg.ImportPath, name, strings.Join(found, ", "))
+}
+
+// FuncName は関数宣言を Patch.Func の形式（"Now", "Time.String"）で返します
+func FuncName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	t := fn.Recv.List[0].Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	switch x := t.(type) {
+	case *ast.IndexExpr:
+		t = x.X
+	case *ast.IndexListExpr:
+		t = x.X
+	}
+	if id, ok := t.(*ast.Ident); ok {
+		return id.Name + "." + fn.Name.Name
+	}
+	return fn.Name.Name
+}
+
+// normalizeFunc は "(*Timer).Stop" や "*Timer.Stop" を "Timer.Stop" にします
+func normalizeFunc(name string) string {
+	return strings.NewReplacer("(", "", ")", "", "*", "").Replace(name)
+}
+
+func lookupFunc(file *ast.File, name string) *ast.FuncDecl {
+	name = normalizeFunc(name)
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil && FuncName(fn) == name {
+			return fn
+		}
+	}
+	return nil
+}
+
+// Rewrite は src の関数の本体を置き換えます。置き換えたもの以外の部分はそのまま残し、
+// 置き換えた本体の後ろに /*line*/ ディレクティブを入れて元のファイルの行番号を保ちます。
+// アセンブリで実装された本体のない関数は置き換えられません。
+func Rewrite(filename string, src []byte, patches []Patch) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	tf := fset.File(file.Pos())
+
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+
+	imported := make(map[string]bool)
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		imported[path] = true
+	}
+	var imports []string
+	for _, p := range patches {
+		for _, path := range p.Imports {
+			if !imported[path] {
+				imported[path] = true
+				imports = append(imports, strconv.Quote(path))
+			}
+		}
+
+		fn := lookupFunc(file, p.Func)
+		if fn == nil {
+			return nil, fmt.Errorf("%s: function %s not found", filename, p.Func)
+		}
+		if err := checkBody(p); err != nil {
+			return nil, err
+		}
+
+		// 挿入や置き換えで行数が変わっても、元の部分は /*line*/ ディレクティブで元の位置に戻します
+		body := "{\n" + strings.Trim(p.Body, "\n") + "\n"
+		if p.Insert {
+			after := fn.Body.Lbrace + 1
+			edits = append(edits, edit{tf.Offset(fn.Body.Lbrace), tf.Offset(after), body + lineDirective(fset, after)})
+		} else {
+			after := fn.Body.Rbrace + 1
+			edits = append(edits, edit{tf.Offset(fn.Body.Lbrace), tf.Offset(after), body + "}" + lineDirective(fset, after)})
+		}
+	}
+	if len(imports) > 0 {
+		// 行番号を変えないように、パッケージ節と同じ行に import 宣言を追加します
+		end := tf.Offset(file.Name.End())
+		edits = append(edits, edit{end, end, "; import (" + strings.Join(imports, "; ") + ")"})
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var b bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		if e.start < last {
+			return nil, fmt.Errorf("%s: overlapping patches", filename)
+		}
+		b.Write(src[last:e.start])
+		b.WriteString(e.text)
+		last = e.end
+	}
+	b.Write(src[last:])
+
+	if _, err := parser.ParseFile(token.NewFileSet(), filename, b.Bytes(), parser.SkipObjectResolution); err != nil {
+		return nil, fmt.Errorf("patched %s: %w", filename, err)
+	}
+	return b.Bytes(), nil
+}
+
+// lineDirective は直後の文字の位置を pos にする /*line*/ ディレクティブを返します
+func lineDirective(fset *token.FileSet, pos token.Pos) string {
+	p := fset.Position(pos)
+	return fmt.Sprintf("/*line %s:%d:%d*/", p.Filename, p.Line, p.Column)
+}
+
+// checkBody は本体が文の並びとして解釈できるかを確かめます
+func checkBody(p Patch) error {
+	src := "package p\nfunc _() {\n" + p.Body + "\n}\n"
+	if _, err := parser.ParseFile(token.NewFileSet(), "", src, parser.SkipObjectResolution); err != nil {
+		return fmt.Errorf("body of %s.%s: %w", p.Package, p.Func, err)
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeFile は一時ファイルに書き込んでから置き換えます。同じ内容のファイルが既にあれば何もしません
+func writeFile(path string, data []byte) error {
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,130 @@
+package overlaygen_test
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/overlay/overlaygen"
+)
+
+const src = `package lib
+
+import "fmt"
+
+func Now() int {
+	return 1
+}
+
+type List[T any] struct{ items []T }
+
+func (l *List[T]) Len() int { return len(l.items) }
+
+func After() {
+	fmt.Println("after")
+}
+`
+
+func TestRewrite(t *testing.T) {
+	out, err := overlaygen.Rewrite("/src/lib/lib.go", []byte(src), []overlaygen.Patch{
+		{Package: "example.com/lib", Func: "Now", Body: "n := rand.IntN(10)\n\nreturn n + 1", Imports: []string{"math/rand/v2", "fmt"}},
+		{Package: "example.com/lib", Func: "(*List).Len", Body: "return 0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "patched.go", out, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("patched file does not parse: %v\n%s", err, out)
+	}
+	var imports []string
+	for _, spec := range f.Imports {
+		imports = append(imports, spec.Path.Value)
+	}
+	if got := strings.Join(imports, " "); got != `"math/rand/v2" "fmt"` {
+		t.Errorf("imports = %s; want math/rand/v2 added once", got)
+	}
+
+	// 置き換えた関数より後ろの宣言は元のファイルと同じ行にあります
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		want := map[string]string{"Now": "patched.go:5", "Len": "/src/lib/lib.go:11", "After": "/src/lib/lib.go:13"}[fn.Name.Name]
+		if pos := fset.Position(fn.Pos()); fmt.Sprintf("%s:%d", pos.Filename, pos.Line) != want {
+			t.Errorf("%s at %s; want %s\n%s", fn.Name.Name, pos, want, out)
+		}
+	}
+	if !strings.Contains(string(out), "func (l *List[T]) Len() int {\nreturn 0\n}") {
+		t.Errorf("method body is not replaced\n%s", out)
+	}
+
+	if _, err := overlaygen.Rewrite("lib.go", []byte(src), []overlaygen.Patch{{Func: "Missing", Body: "return"}}); err == nil {
+		t.Error("Rewrite succeeded for a missing function")
+	}
+	if _, err := overlaygen.Rewrite("lib.go", []byte(src), []overlaygen.Patch{{Func: "Now", Body: "return 1 +"}}); err == nil {
+		t.Error("Rewrite succeeded with a body that does not parse")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping build test in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"go.mod": "module example.com/app\n\ngo 1.25\n",
+		"main.go": `package main
+
+import "time"
+
+func main() { println(time.Now().UTC().Format(time.RFC3339)) }
+`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g := &overlaygen.Generator{Dir: dir, CacheDir: t.TempDir()}
+	o, err := g.Generate(&overlaygen.Spec{Patches: []overlaygen.Patch{
+		{Package: "time", Func: "Now", Body: "return Date(2025, 9, 27, 0, 0, 0, 0, UTC)"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	goroot, err := exec.Command("go", "env", "GOROOT").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := filepath.Join(strings.TrimSpace(string(goroot)), "src", "time", "time.go")
+	patched, ok := o.Replace[orig]
+	if len(o.Replace) != 1 || !ok || !filepath.IsAbs(patched) || !strings.HasPrefix(patched, g.CacheDir) {
+		t.Fatalf("Replace = %v; want %s replaced by a file in the cache directory", o.Replace, orig)
+	}
+
+	overlay := filepath.Join(t.TempDir(), "overlay.json")
+	if err := o.Write(overlay); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "run", "-overlay", overlay, ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil || strings.TrimSpace(string(out)) != "2025-09-27T00:00:00Z" {
+		t.Errorf("go run -overlay = %q, %v; want fixed time", out, err)
+	}
+}
@@ -0,0 +1,366 @@
+// Package analyze は go build の compile ごとに go/analysis のアナライザーを実行します。
+//
+// 設定例:
+//
+//	{
+//	  "analyze": {
+//	    "packages": ["example.com/app/..."],
+//	    "analyzers": ["interfacetoany"],
+//	    "strict": true,
+//	    "cacheDir": "/tmp/analyze-cache"
+//	  }
+//	}
+//
+// go vet はパッケージごとに unitchecker を使うツールを呼び出し、compile と同じ importcfg から
+// 型情報を読み込ませます。このパッケージは compile が成功した後に、その引数と importcfg から
+// 同じ形式の設定ファイル（unitchecker.Config）を作り、ラッパー自身を analyze サブコマンドとして実行します。
+// 指摘はコンパイルエラーと同じ "file:line:col: message" の形式で表示され、
+// strict が true の場合は指摘があると compile を失敗させます。
+//
+// analyzers を省略すると Register で登録したすべてのアナライザーを実行します。
+// 結果とファクトは compile の -buildid に含まれるアクション ID をキーに cacheDir へ保存し、
+// 変更のないパッケージは再解析せずに保存した指摘を表示します。
+// 依存パッケージのファクトも、そのアーカイブのアクション ID から探すため、
+// 複数のプロジェクトで同じ cacheDir を使っても別のバージョンのファクトと混ざりません。
+// cacheDir を省略した場合はユーザーのキャッシュディレクトリを使います。
+package analyze
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/unitchecker"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/atomicfile"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/linkdeps"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+// Config はアナライザーの実行の設定です
+type Config struct {
+	// Packages は解析するパッケージのパターンです
+	Packages []string `json:"packages"`
+	// Analyzers は実行するアナライザーの名前です。省略時は登録したすべてのアナライザーです
+	Analyzers []string `json:"analyzers"`
+	// Strict が true の場合は指摘があると compile を失敗させます
+	Strict bool `json:"strict"`
+	// CacheDir は解析結果のキャッシュを保存するディレクトリです
+	CacheDir string `json:"cacheDir"`
+}
+
+var registry []*analysis.Analyzer
+
+// Register はビルド中に実行できるアナライザーを登録します
+func Register(analyzers ...*analysis.Analyzer) {
+	registry = append(registry, analyzers...)
+}
+
+// Select は names のアナライザーを登録済みのものから選びます。names が空の場合はすべてを返します
+func Select(names []string) ([]*analysis.Analyzer, error) {
+	if len(names) == 0 {
+		return registry, nil
+	}
+	var selected []*analysis.Analyzer
+	for _, name := range names {
+		i := indexOf(name)
+		if i < 0 {
+			return nil, msg.Errorf(msg.AnalyzeUnknown, name)
+		}
+		selected = append(selected, registry[i])
+	}
+	return selected, nil
+}
+
+func indexOf(name string) int {
+	for i, a := range registry {
+		if a.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Main は analyze サブコマンドとして unitchecker の設定ファイルを解析します。
+// unitchecker.Run は指摘を標準エラー出力に書き、指摘があれば終了コード1で終了します。
+//
+//	wrapper analyze [-analyzers a,b] unit.cfg
+func Main(args []string) int {
+	var names []string
+	if len(args) == 3 && args[0] == "-analyzers" {
+		names = strings.Split(args[1], ",")
+		args = args[2:]
+	}
+	if len(args) != 1 || !strings.HasSuffix(args[0], ".cfg") {
+		fmt.Fprintln(os.Stderr, msg.Sprintf(msg.UsageAnalyze))
+		return 2
+	}
+
+	analyzers, err := Select(names)
+	if err == nil {
+		err = analysis.Validate(analyzers)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, msg.Sprintf(msg.CommandFailed, "analyze", err))
+		return 1
+	}
+	unitchecker.Run(args[0], analyzers)
+	return 0 // unitchecker.Run は os.Exit するため到達しません
+}
+
+// Result は1パッケージ分の解析結果で、キャッシュに保存されます
+type Result struct {
+	// ExitCode は analyze サブコマンドの終了コードで、指摘があると1になります
+	ExitCode int `json:"exitCode"`
+	// Output はコンパイラと同じ形式の指摘です
+	Output string `json:"output"`
+}
+
+// Hook は compile の後に対象パッケージを解析します
+func Hook(c *Config) hook.Hook {
+	return hook.Hook{
+		Name: "analyze",
+		After: func(inv *hook.Invocation) error {
+			if inv.Tool != "compile" || !hook.MatchAny(c.Packages, inv.Package()) || len(inv.GoFiles()) == 0 {
+				return nil
+			}
+
+			r, err := c.run(inv)
+			if err != nil {
+				return err
+			}
+			if _, err := inv.Stderr.Write([]byte(r.Output)); err != nil {
+				return err
+			}
+			if c.Strict && r.ExitCode != 0 {
+				return msg.Errorf(msg.AnalyzeStrict, inv.ImportPath)
+			}
+			return nil
+		},
+	}
+}
+
+// run はキャッシュがあればそれを返し、なければ analyze サブコマンドを実行して結果を保存します
+func (c *Config) run(inv *hook.Invocation) (*Result, error) {
+	analyzers, err := Select(c.Analyzers)
+	if err != nil {
+		return nil, err
+	}
+	cacheDir := c.CacheDir
+	if cacheDir == "" {
+		if cacheDir, err = os.UserCacheDir(); err != nil {
+			return nil, err
+		}
+		cacheDir = filepath.Join(cacheDir, "gocon25-toolexec", "analyze")
+	}
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	keyOf, err := cacheKeys(analyzers)
+	if err != nil {
+		return nil, err
+	}
+	buildID, ok := inv.Flag("buildid")
+	if !ok {
+		return nil, fmt.Errorf("compile: -buildid not found")
+	}
+	actionID, _, _ := strings.Cut(buildID, "/")
+	entry := filepath.Join(cacheDir, keyOf(actionID))
+	if r, err := readResult(entry + ".json"); err == nil {
+		return r, nil
+	}
+
+	unit, err := unitConfig(inv, cacheDir, keyOf)
+	if err != nil {
+		return nil, err
+	}
+	// 同時に実行されたビルドが途中まで書いたファイルを読まないように、一時ファイルに書いてから名前を変えます
+	facts, err := createTemp(entry + ".*.vetx")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(facts)
+	unit.VetxOutput = facts
+
+	data, err := json.Marshal(unit)
+	if err != nil {
+		return nil, err
+	}
+	cfgPath, err := createTemp(entry + ".*.cfg")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(cfgPath)
+	if err := os.WriteFile(cfgPath, data, 0o644); err != nil {
+		return nil, err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(analyzers))
+	for i, a := range analyzers {
+		names[i] = a.Name
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(exe, "analyze", "-analyzers", strings.Join(names, ","), cfgPath)
+	cmd.Stdout = &stderr
+	cmd.Stderr = &stderr
+	r := &Result{}
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, err
+		}
+		r.ExitCode = exitErr.ExitCode()
+	}
+	r.Output = stderr.String()
+
+	// 結果より先にファクトを置き、結果があればファクトもあるようにします
+	if err := os.Rename(facts, entry+".vetx"); err != nil {
+		return nil, err
+	}
+	data, err = json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := atomicfile.WriteFile(entry+".json", data); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// unitConfig は compile の引数と importcfg から go vet と同じ形式の設定を作ります
+// 依存パッケージのファクトは、importcfg のアーカイブに記録されたアクション ID のキーで探します
+func unitConfig(inv *hook.Invocation, cacheDir string, keyOf func(actionID string) string) (*unitchecker.Config, error) {
+	cfg, err := inv.ImportCfg()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	// テストのパッケージでは TOOLEXEC_IMPORTPATH が "pkg [pkg.test]" になるため -p を使います
+	pkgPath, ok := inv.Flag("p")
+	if !ok {
+		pkgPath = inv.ImportPath
+	}
+	goVersion, _ := inv.Flag("lang")
+
+	unit := &unitchecker.Config{
+		ID:                        inv.ImportPath,
+		Compiler:                  "gc",
+		Dir:                       dir,
+		ImportPath:                pkgPath,
+		GoVersion:                 goVersion,
+		GoFiles:                   inv.GoFiles(),
+		ImportMap:                 make(map[string]string),
+		PackageFile:               cfg.PackageFile,
+		Standard:                  make(map[string]bool),
+		PackageVetx:               make(map[string]string),
+		SucceedOnTypecheckFailure: true,
+	}
+	for path, file := range cfg.PackageFile {
+		unit.ImportMap[path] = path
+		unit.Standard[path] = linkdeps.IsStd(path)
+		// 解析済みの依存パッケージのファクトを読み込ませます
+		if id := archiveActionID(file); id != "" {
+			if facts := filepath.Join(cacheDir, keyOf(id)+".vetx"); fileExists(facts) {
+				unit.PackageVetx[path] = facts
+			}
+		}
+	}
+	for from, to := range cfg.ImportMap {
+		unit.ImportMap[from] = to
+	}
+	return unit, nil
+}
+
+// cacheKeys は compile のアクション ID からキャッシュのキーを作る関数を返します。
+// キーにはアクション ID のほかに、アナライザーとラッパーの実行ファイルを含めます。
+// アクション ID はソースと依存パッケージの内容から go コマンドが計算したもので、
+// 同じパッケージでもバージョンやビルドの設定が異なれば別のキーになります。
+func cacheKeys(analyzers []*analysis.Analyzer) (func(actionID string) string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	st, err := os.Stat(exe)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(analyzers))
+	for i, a := range analyzers {
+		names[i] = a.Name
+	}
+	sort.Strings(names)
+
+	return func(actionID string) string {
+		h := sha256.New()
+		fmt.Fprintf(h, "action %s\nanalyzers %s\nexe %s %d %d\n", actionID, strings.Join(names, ","), exe, st.Size(), st.ModTime().UnixNano())
+		return fmt.Sprintf("%x", h.Sum(nil))
+	}, nil
+}
+
+// archiveActionID は compile が出力したアーカイブの先頭にある
+// `build id "<アクション ID>/<コンテンツ ID>"` からアクション ID を返します。見つからない場合は空です
+func archiveActionID(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	buf := make([]byte, 1024)
+	n, _ := io.ReadFull(f, buf)
+	_, rest, ok := bytes.Cut(buf[:n], []byte("\nbuild id \""))
+	if !ok {
+		return ""
+	}
+	id, _, ok := bytes.Cut(rest, []byte("\""))
+	if !ok {
+		return ""
+	}
+	actionID, _, _ := bytes.Cut(id, []byte("/"))
+	return string(actionID)
+}
+
+func readResult(path string) (*Result, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Result
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// createTemp は pattern の一時ファイルを作り、閉じてからその名前を返します
+func createTemp(pattern string) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(pattern), filepath.Base(pattern))
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,99 @@
+package analyze_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/analyze"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+)
+
+func TestHook(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	cacheDir := t.TempDir()
+	config := func(strict bool) []string {
+		data, _ := json.Marshal(map[string]any{"analyze": analyze.Config{
+			Packages:  []string{"example.com/app/..."},
+			Analyzers: []string{"interfacetoany"},
+			Strict:    strict,
+			CacheDir:  cacheDir,
+		}})
+		return []string{"TOOLEXEC_CONFIG=" + buildtest.WriteConfig(t, string(data))}
+	}
+
+	dir := buildtest.WriteModule(t, map[string]string{
+		"box/box.go": `package box
+
+type Box struct{ V interface{} }
+`,
+		"clean/clean.go": "package clean\n\nfunc F(v any) any { return v }\n",
+	})
+
+	const want = "box.go:3:20: interface{} can be replaced with any"
+	out, err := buildtest.GoBuild(t, dir, wrapper, config(false), "./...")
+	if err != nil {
+		t.Fatalf("go build failed without strict mode: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, want) {
+		t.Errorf("diagnostic is not shown\n%s", out)
+	}
+
+	out, err = buildtest.GoBuild(t, dir, wrapper, config(true), "./...")
+	if err == nil {
+		t.Fatalf("go build succeeded in strict mode\n%s", out)
+	}
+	if !strings.Contains(out, want) || strings.Contains(out, "clean.go") {
+		t.Errorf("unexpected output\n%s", out)
+	}
+
+	// ファクトは結果と同じキーで保存され、パッケージのパスごとのファイルは作られません
+	for _, entry := range must(filepath.Glob(filepath.Join(cacheDir, "*.json"))) {
+		if _, err := os.Stat(strings.TrimSuffix(entry, ".json") + ".vetx"); err != nil {
+			t.Errorf("facts are not stored with the result: %v", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "facts")); err == nil {
+		t.Error("facts are stored by package path")
+	}
+	if tmp := must(filepath.Glob(filepath.Join(cacheDir, "*.*.*"))); len(tmp) > 0 {
+		t.Errorf("temporary files are left: %v", tmp)
+	}
+
+	// キャッシュした結果を書き換えて、再解析されずにキャッシュが使われることを確かめます
+	entries, err := filepath.Glob(filepath.Join(cacheDir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r analyze.Result
+		if err := json.Unmarshal(data, &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.ExitCode == 0 {
+			continue
+		}
+		r.Output = strings.Replace(r.Output, "can be replaced", "(cached) can be replaced", 1)
+		data, _ = json.Marshal(r)
+		if err := os.WriteFile(entry, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out, _ = buildtest.GoBuild(t, dir, wrapper, config(true), "./...")
+	if !strings.Contains(out, "(cached)") {
+		t.Errorf("cached result is not used\n%s", out)
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -0,0 +1,131 @@
+// Package bce はコンパイラが取り除けなかった境界チェックを集計します。
+//
+// 設定例:
+//
+//	{
+//	  "bce": {
+//	    "packages": ["example.com/app/codec/..."],
+//	    "dir": "/tmp/bce-report",
+//	    "profile": "/tmp/cpu.pprof"
+//	  }
+//	}
+//
+// 対象パッケージの compile に -d=ssa/check_bce/debug=1 を追加し、
+// 残った境界チェックを dir/packages 以下へパッケージごとの JSON として保存します。
+// link の後に関数ごと、ループごとに集計した dir/report.json と dir/report.txt を書き出します。
+// CPU プロファイルを指定すると、境界チェックのある行のサンプルの重みで順位を付けます。
+package bce
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/srcpos"
+)
+
+// Config は境界チェックレポートの設定です
+type Config struct {
+	// Packages はレポートの対象にするパッケージのパターンです
+	Packages []string `json:"packages"`
+	// Dir はレポートを書き出すディレクトリです
+	Dir string `json:"dir"`
+	// Profile は順位付けに使う CPU プロファイルです（省略可）
+	Profile string `json:"profile"`
+}
+
+// Check はコンパイル後も残った境界チェック1件分です
+type Check struct {
+	// Pos は "file.go:line:col" 形式の位置です
+	Pos  string `json:"pos"`
+	Line int    `json:"line"`
+	// Function は境界チェックを含む関数です
+	Function string `json:"function"`
+	// Loop は境界チェックを含む最も内側のループの位置です。ループの外側の場合は空です
+	Loop string `json:"loop,omitempty"`
+	// Kind は IsInBounds（インデックス）または IsSliceInBounds（スライス式）です
+	Kind string `json:"kind"`
+	// Weight は CPU プロファイルでこの行にかかった時間です
+	Weight int64 `json:"weight,omitempty"`
+}
+
+// ./bce.go:6:16: Found IsInBounds
+var checkRe = regexp.MustCompile(`^(.+?):(\d+):(\d+): Found (Is\w*InBounds)$`)
+
+// Parse はコンパイラの -d=ssa/check_bce/debug=1 の出力を解釈します。
+// files はコンパイルしたソースファイルで、位置から関数とループを求めるために使います。
+func Parse(r io.Reader, files []string) ([]Check, error) {
+	idx := srcpos.NewIndex(files)
+
+	var checks []Check
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		m := checkRe.FindStringSubmatch(s.Text())
+		if m == nil {
+			continue
+		}
+		line, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		checks = append(checks, Check{
+			Pos:      filepath.Base(m[1]) + ":" + m[2] + ":" + m[3],
+			Line:     line,
+			Function: idx.Func(m[1], line),
+			Loop:     idx.Loop(m[1], line, col),
+			Kind:     m[4],
+		})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return checks, nil
+}
+
+// Hook は対象パッケージの compile で境界チェックを集め、link の後にレポートを書き出します
+func Hook(c *Config) hook.Hook {
+	var captured *bytes.Buffer
+
+	return hook.Hook{
+		Name: "bce",
+		Before: func(inv *hook.Invocation) error {
+			if c.Dir == "" || inv.Tool != "compile" || !hook.MatchAny(c.Packages, inv.Package()) {
+				return nil
+			}
+			inv.InsertArgs("-d=ssa/check_bce/debug=1")
+			captured = inv.CaptureStdout()
+			return nil
+		},
+		After: func(inv *hook.Invocation) error {
+			if c.Dir == "" {
+				return nil
+			}
+
+			switch {
+			case captured != nil:
+				checks, err := Parse(bytes.NewReader(captured.Bytes()), inv.GoFiles())
+				if err != nil {
+					return err
+				}
+				return WritePackage(c.Dir, Package{ImportPath: inv.ImportPath, Checks: checks})
+			case inv.Tool == "link":
+				r, err := Collect(c.Dir)
+				if err != nil {
+					return err
+				}
+				// プロファイルは最初のビルドの後に取得するため、まだない場合は順位付けせずに書き出します
+				if _, err := os.Stat(c.Profile); c.Profile != "" && err == nil {
+					if err := r.Rank(c.Profile); err != nil {
+						return err
+					}
+				}
+				return r.WriteFiles(c.Dir)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,131 @@
+package bce_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/bce"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+)
+
+func TestHook(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	reportDir := t.TempDir()
+	config := buildtest.WriteConfig(t, `{"bce": {"packages": ["example.com/app/codec"], "dir": "`+filepath.ToSlash(reportDir)+`"}}`)
+	dir := buildtest.WriteModule(t, map[string]string{
+		"codec/codec.go": `package codec
+
+func Dot(a, b []int) int {
+	s := 0
+	for i := range a {
+		s += a[i] * b[i]
+	}
+	return s
+}
+
+func Sub(a []byte, i, j int) []byte { return a[i:j] }
+`,
+	})
+
+	out, err := buildtest.GoBuild(t, dir, wrapper, []string{"TOOLEXEC_CONFIG=" + config}, "./...")
+	if err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+	if strings.Contains(out, "Found IsInBounds") {
+		t.Errorf("compiler diagnostics are shown to the user\n%s", out)
+	}
+
+	r, err := bce.Collect(reportDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bce.Check{
+		// a[i] は range で範囲が分かるため、b[i] の境界チェックだけが残ります
+		{Pos: "codec.go:6:16", Line: 6, Function: "Dot", Loop: "codec.go:5:2", Kind: "IsInBounds"},
+		{Pos: "codec.go:11:47", Line: 11, Function: "Sub", Kind: "IsSliceInBounds"},
+	}
+	if len(r.Packages) != 1 || fmt.Sprint(r.Packages[0].Checks) != fmt.Sprint(want) {
+		t.Fatalf("unexpected checks: %+v", r.Packages)
+	}
+	if len(r.Loops) != 1 || r.Loops[0].Function != "Dot" || r.Loops[0].Checks != 1 {
+		t.Errorf("unexpected loop summary: %+v", r.Loops)
+	}
+}
+
+//go:noinline
+func dot(a, b []int) int {
+	s := 0
+	for i := range a {
+		s += a[i] * b[i] // dotLine
+	}
+	return s
+}
+
+func TestRank(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping CPU profiling in short mode")
+	}
+
+	src, err := os.ReadFile("bce_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := bytes.Count(src[:bytes.Index(src, []byte("// dotLine"))], []byte("\n")) + 1
+
+	profilePath := filepath.Join(t.TempDir(), "cpu.pprof")
+	f, err := os.Create(profilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		t.Fatal(err)
+	}
+	a, b := make([]int, 1<<16), make([]int, 1<<16)
+	for start := time.Now(); time.Since(start) < 500*time.Millisecond; {
+		runtime.KeepAlive(dot(a, b))
+	}
+	pprof.StopCPUProfile()
+	f.Close()
+
+	// コンパイラの出力の代わりに、dot の境界チェックを直接レポートにします
+	const pkg = "github.com/newmo-oss/gocon25-workshop/toolexec/bce_test"
+	output := fmt.Sprintf("./bce_test.go:%d:16: Found IsInBounds\n", line)
+	checks, err := bce.Parse(strings.NewReader(output), []string{"bce_test.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := bce.WritePackage(dir, bce.Package{ImportPath: pkg, Checks: checks}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := bce.Collect(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Rank(profilePath); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.SampleType != "cpu/nanoseconds" {
+		t.Errorf("SampleType = %q; want cpu/nanoseconds", r.SampleType)
+	}
+	if len(r.Functions) != 1 || r.Functions[0].Function != "dot" || r.Functions[0].Weight == 0 {
+		t.Fatalf("bounds check in dot is not ranked: %+v", r.Functions)
+	}
+
+	var table bytes.Buffer
+	if err := r.WriteTable(&table); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(table.String(), pkg+".dot") {
+		t.Errorf("table does not contain dot\n%s", table.String())
+	}
+}
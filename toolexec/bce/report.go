@@ -0,0 +1,226 @@
+package bce
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/atomicfile"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/profile"
+)
+
+// Package はパッケージ1つ分の境界チェックです
+type Package struct {
+	ImportPath string  `json:"importPath"`
+	Checks     []Check `json:"checks"`
+}
+
+// Summary は関数またはループごとに集計した境界チェックです
+type Summary struct {
+	Package  string `json:"package"`
+	Function string `json:"function"`
+	// Loop はループごとの集計の場合のループの位置です
+	Loop   string `json:"loop,omitempty"`
+	Checks int    `json:"checks"`
+	Weight int64  `json:"weight,omitempty"`
+}
+
+// Report はビルド全体の境界チェックをまとめたレポートです
+type Report struct {
+	// SampleType は Weight の単位です（例: "cpu/nanoseconds"）。プロファイルがない場合は空です
+	SampleType string    `json:"sampleType,omitempty"`
+	Packages   []Package `json:"packages"`
+	Functions  []Summary `json:"functions"`
+	Loops      []Summary `json:"loops"`
+}
+
+func packagesDir(dir string) string {
+	return filepath.Join(dir, "packages")
+}
+
+// WritePackage はパッケージごとの境界チェックを dir/packages に保存します。
+// 並行して実行される link が Collect で読み込むため、一時ファイルに書いてから置き換えます。
+func WritePackage(dir string, pkg Package) error {
+	if err := os.MkdirAll(packagesDir(dir), 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(packagesDir(dir), url.PathEscape(pkg.ImportPath)+".json")
+	return atomicfile.WriteJSON(path, pkg)
+}
+
+// Collect は dir/packages に保存された境界チェックを集計します
+func Collect(dir string) (*Report, error) {
+	paths, err := filepath.Glob(filepath.Join(packagesDir(dir), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Report{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var pkg Package
+		if err := json.Unmarshal(data, &pkg); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		r.Packages = append(r.Packages, pkg)
+	}
+	sort.Slice(r.Packages, func(i, j int) bool {
+		return r.Packages[i].ImportPath < r.Packages[j].ImportPath
+	})
+	r.summarize()
+	return r, nil
+}
+
+// Rank は CPU プロファイルのサンプルのうち、葉のフレームが境界チェックのある行だったものの
+// 値を合計して Weight にします。同じ行にある境界チェックには同じ重みが付きます。
+func (r *Report) Rank(profilePath string) error {
+	f, err := os.Open(profilePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	p, err := profile.Parse(f)
+	if err != nil {
+		return err
+	}
+	if len(p.SampleType) > 0 {
+		r.SampleType = p.SampleType[len(p.SampleType)-1]
+	}
+
+	type key struct {
+		function string
+		line     int
+	}
+	weights := make(map[key]int64)
+	for _, s := range p.Samples {
+		if len(s.Stack) == 0 {
+			continue
+		}
+		leaf := s.Stack[0]
+		weights[key{trimTypeArgs(leaf.Function), leaf.Line}] += s.Value
+	}
+
+	for i := range r.Packages {
+		pkg := &r.Packages[i]
+		for j := range pkg.Checks {
+			c := &pkg.Checks[j]
+			c.Weight = weights[key{pkg.ImportPath + "." + c.Function, c.Line}]
+		}
+	}
+	r.summarize()
+	return nil
+}
+
+// trimTypeArgs はプロファイルのジェネリック関数の名前 "pkg.F[...]" から型引数を取り除きます
+func trimTypeArgs(name string) string {
+	return strings.ReplaceAll(name, "[...]", "")
+}
+
+// summarize は関数ごととループごとの集計を重みと件数の多い順に作り直します
+func (r *Report) summarize() {
+	funcs := make(map[Summary]*Summary)
+	loops := make(map[Summary]*Summary)
+	add := func(m map[Summary]*Summary, k Summary, c Check) {
+		s, ok := m[k]
+		if !ok {
+			s = &Summary{Package: k.Package, Function: k.Function, Loop: k.Loop}
+			m[k] = s
+		}
+		s.Checks++
+		s.Weight += c.Weight
+	}
+
+	for _, pkg := range r.Packages {
+		for _, c := range pkg.Checks {
+			add(funcs, Summary{Package: pkg.ImportPath, Function: c.Function}, c)
+			if c.Loop != "" {
+				add(loops, Summary{Package: pkg.ImportPath, Function: c.Function, Loop: c.Loop}, c)
+			}
+		}
+	}
+
+	r.Functions, r.Loops = sortSummaries(funcs), sortSummaries(loops)
+}
+
+func sortSummaries(m map[Summary]*Summary) []Summary {
+	list := make([]Summary, 0, len(m))
+	for _, s := range m {
+		list = append(list, *s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Weight != b.Weight {
+			return a.Weight > b.Weight
+		}
+		if a.Checks != b.Checks {
+			return a.Checks > b.Checks
+		}
+		return a.Package+"."+a.Function+a.Loop < b.Package+"."+b.Function+b.Loop
+	})
+	return list
+}
+
+// WriteFiles はレポートを dir/report.json と dir/report.txt に書き出します
+func (r *Report) WriteFiles(dir string) error {
+	if err := atomicfile.WriteJSON(filepath.Join(dir, "report.json"), r); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(dir, "report.txt"))
+	if err != nil {
+		return err
+	}
+	if err := r.WriteTable(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteTable は関数ごと、ループごとの集計を表として書き出します
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "FUNCTION\tCHECKS\tWEIGHT")
+	for _, s := range r.Functions {
+		fmt.Fprintf(tw, "%s.%s\t%d\t%s\n", s.Package, s.Function, s.Checks, r.formatWeight(s.Weight))
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "LOOP\tFUNCTION\tCHECKS\tWEIGHT")
+	for _, s := range r.Loops {
+		fmt.Fprintf(tw, "%s\t%s.%s\t%d\t%s\n", s.Loop, s.Package, s.Function, s.Checks, r.formatWeight(s.Weight))
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "POS\tKIND\tFUNCTION\tWEIGHT")
+	for _, pkg := range r.Packages {
+		for _, c := range pkg.Checks {
+			fmt.Fprintf(tw, "%s/%s\t%s\t%s\t%s\n", pkg.ImportPath, c.Pos, c.Kind, c.Function, r.formatWeight(c.Weight))
+		}
+	}
+
+	return tw.Flush()
+}
+
+func (r *Report) formatWeight(w int64) string {
+	switch {
+	case r.SampleType == "":
+		return "-"
+	case strings.HasSuffix(r.SampleType, "/nanoseconds"):
+		return time.Duration(w).String()
+	default:
+		return fmt.Sprint(w)
+	}
+}
@@ -0,0 +1,312 @@
+// Package binsize はリンクされたバイナリのサイズをパッケージとモジュールごとに集計します。
+//
+// 設定例:
+//
+//	{
+//	  "binsize": {
+//	    "dir": "/tmp/binsize",
+//	    "threshold": 5
+//	  }
+//	}
+//
+// link が成功した後に出力された ELF ファイルのシンボルテーブルを読み、
+// .text, .rodata, .data のバイト数をシンボル名からパッケージに割り当てます。
+// 結果はメインパッケージごとのスナップショットとして dir に保存し、
+// 次のビルドでは前回から threshold パーセントより大きく増えたパッケージを表示します。
+// Mach-O や PE など ELF 以外の出力は警告を表示して解析しません。
+package binsize
+
+import (
+	"debug/buildinfo"
+	"debug/elf"
+	"debug/gosym"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Class はセクションの種類です
+type Class string
+
+const (
+	Text   Class = "text"
+	Rodata Class = "rodata"
+	Data   Class = "data"
+)
+
+// sectionClass はセクション名から種類を求めます。
+// .bss のようにファイル上にサイズを持たないセクションは集計しません。
+var sectionClass = map[string]Class{
+	".text":        Text,
+	".rodata":      Rodata,
+	".go.func":     Rodata,
+	".typelink":    Rodata,
+	".itablink":    Rodata,
+	".noptrdata":   Data,
+	".data":        Data,
+	".go.module":   Data,
+	".go.fipsinfo": Data,
+}
+
+// Package はパッケージ1つ分のサイズです
+type Package struct {
+	Path   string `json:"path"`
+	Module string `json:"module,omitempty"`
+	Text   uint64 `json:"text"`
+	Rodata uint64 `json:"rodata"`
+	Data   uint64 `json:"data"`
+}
+
+// Total は text, rodata, data の合計です
+func (p Package) Total() uint64 {
+	return p.Text + p.Rodata + p.Data
+}
+
+// Module はモジュール1つ分のサイズです
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version,omitempty"`
+	Total   uint64 `json:"total"`
+}
+
+// Snapshot はバイナリ1つ分のサイズの内訳です
+type Snapshot struct {
+	// FileSize はデバッグ情報を含むバイナリのファイルサイズです
+	FileSize uint64 `json:"fileSize"`
+	// Sections はセクションごとのサイズです
+	Sections map[string]uint64 `json:"sections"`
+	// TypeDescriptors は型情報（.go.type または type: シンボル）のサイズです
+	TypeDescriptors uint64 `json:"typeDescriptors"`
+	// Pclntab は関数と行番号の対応表（.gopclntab）のサイズです
+	Pclntab  uint64    `json:"pclntab"`
+	Packages []Package `json:"packages"`
+	Modules  []Module  `json:"modules"`
+}
+
+// ErrNotELF は解析するファイルが ELF 形式でないことを表します
+var ErrNotELF = errors.New("not an ELF file")
+
+// Analyze は ELF 形式のバイナリを解析します。ELF 形式でない場合は ErrNotELF を返します。
+// シンボルテーブルが取り除かれている場合（-ldflags=-s）は .gopclntab から関数の範囲を求め、
+// text だけをパッケージに割り当てます。
+func Analyze(path string) (*Snapshot, error) {
+	if ok, err := isELF(path); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("%s: %w", path, ErrNotELF)
+	}
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{FileSize: uint64(st.Size()), Sections: make(map[string]uint64)}
+	for _, sec := range f.Sections {
+		if sec.Type == elf.SHT_NOBITS || sec.Size == 0 {
+			continue
+		}
+		s.Sections[sec.Name] += sec.Size
+	}
+	s.Pclntab = s.Sections[".gopclntab"]
+	s.TypeDescriptors = s.Sections[".go.type"]
+
+	pkgs := make(map[string]*Package)
+	add := func(name string, class Class, size uint64) {
+		path := PackageOf(name)
+		p, ok := pkgs[path]
+		if !ok {
+			p = &Package{Path: path}
+			pkgs[path] = p
+		}
+		switch class {
+		case Text:
+			p.Text += size
+		case Rodata:
+			p.Rodata += size
+		case Data:
+			p.Data += size
+		}
+	}
+
+	syms, err := f.Symbols()
+	switch {
+	case err == nil:
+		for _, sym := range syms {
+			if sym.Size == 0 || int(sym.Section) >= len(f.Sections) || sym.Section == elf.SHN_UNDEF {
+				continue
+			}
+			sec := f.Sections[sym.Section]
+			class, ok := sectionClass[sec.Name]
+			if !ok {
+				continue
+			}
+			// 古いツールチェーンでは型情報は .rodata の type. または type: シンボルです
+			if isTypeSymbol(sym.Name) && class == Rodata {
+				if s.Sections[".go.type"] == 0 {
+					s.TypeDescriptors += sym.Size
+				}
+				continue
+			}
+			add(sym.Name, class, sym.Size)
+		}
+	case err == elf.ErrNoSymbols:
+		funcs, err := pclntabFuncs(f)
+		if err != nil {
+			return nil, err
+		}
+		for _, fn := range funcs {
+			add(fn.Name, Text, fn.End-fn.Entry)
+		}
+	default:
+		return nil, err
+	}
+
+	mods := moduleResolver(path)
+	modSizes := make(map[string]*Module)
+	for _, p := range pkgs {
+		mod := mods(p.Path)
+		p.Module = mod.Path
+		s.Packages = append(s.Packages, *p)
+
+		m, ok := modSizes[mod.Path]
+		if !ok {
+			m = &Module{Path: mod.Path, Version: mod.Version}
+			modSizes[mod.Path] = m
+		}
+		m.Total += p.Total()
+	}
+	for _, m := range modSizes {
+		s.Modules = append(s.Modules, *m)
+	}
+
+	sort.Slice(s.Packages, func(i, j int) bool {
+		if s.Packages[i].Total() != s.Packages[j].Total() {
+			return s.Packages[i].Total() > s.Packages[j].Total()
+		}
+		return s.Packages[i].Path < s.Packages[j].Path
+	})
+	sort.Slice(s.Modules, func(i, j int) bool {
+		if s.Modules[i].Total != s.Modules[j].Total {
+			return s.Modules[i].Total > s.Modules[j].Total
+		}
+		return s.Modules[i].Path < s.Modules[j].Path
+	})
+	return s, nil
+}
+
+func isTypeSymbol(name string) bool {
+	return strings.HasPrefix(name, "type:") || strings.HasPrefix(name, "type.")
+}
+
+// PackageOf は Go のシンボル名からパッケージのインポートパスを求めます。
+//
+//	github.com/x/y.(*T).M          -> github.com/x/y
+//	slices.Sort[go.shape.[]uint8]  -> slices
+//	go:string.*                    -> (go:)
+//	type:.eq.main.T                -> (type:)
+func PackageOf(sym string) string {
+	switch {
+	case strings.HasPrefix(sym, "go:"), strings.HasPrefix(sym, "go."):
+		return "(go:)"
+	case isTypeSymbol(sym):
+		return "(type:)"
+	case strings.HasPrefix(sym, "$"):
+		return "(constants)"
+	}
+
+	// 型引数の中の "/" や "." は無視します
+	name := sym
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	slash := strings.LastIndexByte(name, '/')
+	dot := strings.IndexByte(name[slash+1:], '.')
+	if dot < 0 {
+		return "(C)"
+	}
+	return name[:slash+1+dot]
+}
+
+// pclntabFuncs はシンボルテーブルのないバイナリから関数の一覧を読み出します
+func pclntabFuncs(f *elf.File) ([]gosym.Func, error) {
+	pclntab := f.Section(".gopclntab")
+	text := f.Section(".text")
+	if pclntab == nil || text == nil {
+		return nil, fmt.Errorf("no symbol table and no .gopclntab")
+	}
+	data, err := pclntab.Data()
+	if err != nil {
+		return nil, err
+	}
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(data, text.Addr))
+	if err != nil {
+		return nil, err
+	}
+	return table.Funcs, nil
+}
+
+// moduleResolver はバイナリに埋め込まれたビルド情報から、パッケージの属するモジュールを求める関数を返します
+func moduleResolver(path string) func(pkg string) Module {
+	var (
+		mods []Module
+		main = Module{Path: "(main)"}
+	)
+	if info, err := buildinfo.ReadFile(path); err == nil {
+		if info.Main.Path != "" {
+			main = Module{Path: info.Main.Path, Version: info.Main.Version}
+			mods = append(mods, main)
+		}
+		for _, dep := range info.Deps {
+			// パッケージは置き換え前のモジュールパスでインポートされます
+			version := dep.Version
+			if dep.Replace != nil {
+				version = dep.Replace.Version
+			}
+			mods = append(mods, Module{Path: dep.Path, Version: version})
+		}
+	}
+	// 長いモジュールパスを優先して一致させます
+	sort.Slice(mods, func(i, j int) bool { return len(mods[i].Path) > len(mods[j].Path) })
+
+	return func(pkg string) Module {
+		if strings.HasPrefix(pkg, "(") {
+			return Module{Path: "(runtime)"}
+		}
+		for _, m := range mods {
+			if pkg == m.Path || strings.HasPrefix(pkg, m.Path+"/") {
+				return m
+			}
+		}
+		// メインパッケージのシンボルはインポートパスではなく main という名前になります
+		if pkg == "main" || pkg == "command-line-arguments" {
+			return main
+		}
+		if first, _, _ := strings.Cut(pkg, "/"); !strings.Contains(first, ".") {
+			return Module{Path: "std"}
+		}
+		return Module{Path: "(unknown)"}
+	}
+}
+
+// isELF はファイルの先頭が ELF のマジックナンバーかどうかを返します
+func isELF(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(elf.ELFMAG))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false, nil
+	}
+	return string(magic) == elf.ELFMAG, nil
+}
@@ -0,0 +1,92 @@
+package binsize_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/binsize"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+)
+
+func TestPackageOf(t *testing.T) {
+	for sym, want := range map[string]string{
+		"main.main":                          "main",
+		"github.com/x/y.(*T).M":              "github.com/x/y",
+		"github.com/x/y.F.func1":             "github.com/x/y",
+		"slices.Sort[go.shape.[]uint8]":      "slices",
+		"sync.(*Map[go.shape.string,a/b.T])": "sync",
+		"go:string.*":                        "(go:)",
+		"type:.eq.main.T":                    "(type:)",
+		"_rt0_amd64_linux":                   "(C)",
+	} {
+		if got := binsize.PackageOf(sym); got != want {
+			t.Errorf("PackageOf(%q) = %q; want %q", sym, got, want)
+		}
+	}
+}
+
+func TestHook(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	snapshots := t.TempDir()
+	env := []string{"TOOLEXEC_CONFIG=" + buildtest.WriteConfig(t, `{"binsize": {"dir": "`+filepath.ToSlash(snapshots)+`", "threshold": 5}}`)}
+
+	dir := buildtest.WriteModule(t, map[string]string{
+		"main.go": "package main\n\nfunc main() { println(table[0]) }\n\nvar table = [...]int{1}\n",
+	})
+	if out, err := buildtest.GoBuild(t, dir, wrapper, env, "-o", "app", "."); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+
+	s, err := binsize.ReadSnapshot(filepath.Join(snapshots, "example.com%2Fapp.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Pclntab == 0 || s.TypeDescriptors == 0 {
+		t.Errorf("overhead is not reported: pclntab=%d type descriptors=%d", s.Pclntab, s.TypeDescriptors)
+	}
+	var main, runtime *binsize.Package
+	for i, p := range s.Packages {
+		switch p.Path {
+		case "main":
+			main = &s.Packages[i]
+		case "runtime":
+			runtime = &s.Packages[i]
+		}
+	}
+	if main == nil || main.Module != "example.com/app" || main.Text == 0 {
+		t.Errorf("main package is not attributed to the main module: %+v", main)
+	}
+	if runtime == nil || runtime.Module != "std" || runtime.Text == 0 || runtime.Data == 0 {
+		t.Errorf("runtime package is not attributed to std: %+v", runtime)
+	}
+
+	// main パッケージに大きなデータを追加すると、次のビルドで増加が表示されます
+	main2 := "package main\n\nfunc main() { println(table[0]) }\n\nvar table = [...]int{" + strings.Repeat("1, ", 4096) + "}\n"
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(main2), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := buildtest.GoBuild(t, dir, wrapper, env, "-o", "app", ".")
+	if err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "binary size of example.com/app grew by ") || !strings.Contains(out, " in 1 package(s)") {
+		t.Fatalf("growth is not reported\n%s", out)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] != "main" && strings.Contains(line, "%)") {
+			t.Errorf("unexpected growth: %s", line)
+		}
+	}
+
+	// ELF 以外の出力では警告を表示してリンクを失敗させません
+	out, err = buildtest.GoBuild(t, dir, wrapper, append(env, "GOOS=windows", "GOARCH=amd64"), "-o", "app.exe", ".")
+	if err != nil {
+		t.Fatalf("go build for windows failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, ".exe is not an ELF file; skipping") {
+		t.Errorf("non-ELF output is not reported\n%s", out)
+	}
+}
@@ -0,0 +1,173 @@
+package binsize
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+// Config はバイナリサイズの集計の設定です
+type Config struct {
+	// Dir はスナップショットを保存するディレクトリです
+	Dir string `json:"dir"`
+	// Threshold は前回から何パーセントより大きく増えたパッケージを表示するかです
+	Threshold float64 `json:"threshold"`
+}
+
+// Growth は前回のスナップショットから増えたパッケージです
+type Growth struct {
+	Path   string
+	Module string
+	Old    uint64
+	New    uint64
+}
+
+// Percent は増加率です。前回存在しなかったパッケージでは 0 を返します
+func (g Growth) Percent() float64 {
+	if g.Old == 0 {
+		return 0
+	}
+	return float64(g.New-g.Old) / float64(g.Old) * 100
+}
+
+// Compare は threshold パーセントより大きく増えたパッケージと、新しく増えたパッケージを返します
+func Compare(old, new *Snapshot, threshold float64) []Growth {
+	oldSizes := make(map[string]uint64)
+	for _, p := range old.Packages {
+		oldSizes[p.Path] = p.Total()
+	}
+
+	var growths []Growth
+	for _, p := range new.Packages {
+		o, n := oldSizes[p.Path], p.Total()
+		if n <= o {
+			continue
+		}
+		g := Growth{Path: p.Path, Module: p.Module, Old: o, New: n}
+		if o == 0 || g.Percent() > threshold {
+			growths = append(growths, g)
+		}
+	}
+	sort.Slice(growths, func(i, j int) bool {
+		return growths[i].New-growths[i].Old > growths[j].New-growths[j].Old
+	})
+	return growths
+}
+
+// WriteGrowths は増えたパッケージを表として書き出します
+func WriteGrowths(w io.Writer, growths []Growth) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tMODULE\tOLD\tNEW\tGROWTH")
+	for _, g := range growths {
+		growth := "new"
+		if g.Old > 0 {
+			growth = fmt.Sprintf("+%d (+%.1f%%)", g.New-g.Old, g.Percent())
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", g.Path, g.Module, g.Old, g.New, growth)
+	}
+	return tw.Flush()
+}
+
+// WriteTable はスナップショットの内訳を表として書き出します
+func (s *Snapshot) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "file\t%d\t\n", s.FileSize)
+	fmt.Fprintf(tw, "type descriptors\t%d\t\n", s.TypeDescriptors)
+	fmt.Fprintf(tw, "pclntab\t%d\t\n", s.Pclntab)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+
+	tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODULE\tVERSION\tTOTAL")
+	for _, m := range s.Modules {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", m.Path, m.Version, m.Total)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "PACKAGE\tTEXT\tRODATA\tDATA\tTOTAL")
+	for _, p := range s.Packages {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", p.Path, p.Text, p.Rodata, p.Data, p.Total())
+	}
+	return tw.Flush()
+}
+
+// snapshotPath はメインパッケージごとのスナップショットのパスです
+func snapshotPath(dir, importPath string) string {
+	return filepath.Join(dir, url.PathEscape(importPath)+".json")
+}
+
+// ReadSnapshot はスナップショットを読み込みます
+func ReadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// WriteSnapshot はスナップショットを保存します
+func WriteSnapshot(path string, s *Snapshot) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Hook は link の後にバイナリを解析し、前回のスナップショットとの差分を表示します
+func Hook(c *Config) hook.Hook {
+	return hook.Hook{
+		Name: "binsize",
+		After: func(inv *hook.Invocation) error {
+			if c.Dir == "" || inv.Tool != "link" {
+				return nil
+			}
+			out, ok := inv.Flag("o")
+			if !ok {
+				return nil
+			}
+
+			s, err := Analyze(out)
+			if errors.Is(err, ErrNotELF) {
+				fmt.Fprintf(inv.Stderr, "[TOOLEXEC] %s\n", msg.Sprintf(msg.BinSizeNotELF, out))
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("analyze %s: %w", out, err)
+			}
+
+			if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+				return err
+			}
+			path := snapshotPath(c.Dir, inv.ImportPath)
+			if old, err := ReadSnapshot(path); err == nil {
+				if growths := Compare(old, s, c.Threshold); len(growths) > 0 {
+					var grew uint64
+					for _, g := range growths {
+						grew += g.New - g.Old
+					}
+					fmt.Fprintf(inv.Stderr, "[TOOLEXEC] %s\n", msg.Sprintf(msg.BinSizeGrew, inv.ImportPath, grew, len(growths)))
+					if err := WriteGrowths(inv.Stderr, growths); err != nil {
+						return err
+					}
+				}
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+			return WriteSnapshot(path, s)
+		},
+	}
+}
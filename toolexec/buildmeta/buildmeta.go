@@ -0,0 +1,242 @@
+// Package buildmeta は link に -X を追加して、ビルド情報を変数に埋め込みます。
+//
+// 設定例:
+//
+//	{
+//	  "buildmeta": {
+//	    "vars": {
+//	      "main.buildTime": "{{.Time}}",
+//	      "main.buildVersion": "{{.Version}}+{{.ShortRevision}}{{if .Dirty}}.dirty{{end}}"
+//	    },
+//	    "time": ["SOURCE_DATE_EPOCH", "commit"]
+//	  }
+//	}
+//
+// vars はシンボル名と値のテンプレート（text/template）の組です。テンプレートでは Info のフィールドと、
+// 環境変数を参照する env 関数（{{env "CI_JOB_ID"}}）が使えます。
+// 値が空になった変数と -ldflags で -X が指定されている変数には -X を追加しないため、
+// それぞれソースコードに書かれた初期値と -ldflags の値のままになります。
+//
+// time はビルド時刻を求める方法を優先順に並べたものです。省略時は SOURCE_DATE_EPOCH, commit の順です。
+//
+//	SOURCE_DATE_EPOCH  環境変数 SOURCE_DATE_EPOCH の UNIX 時間
+//	commit             HEAD のコミットの committer の時刻
+//	now                link を実行した時刻（再現可能なビルドにはなりません）
+//
+// リビジョンは link の作業ディレクトリである go コマンドを実行したディレクトリから .git を探して読みます。
+// 変更の有無は go コマンドがモジュール情報に含めた vcs.modified を優先し、ない場合は作業ツリーを index と比べます。
+// .git がない場合は vcs.revision と vcs.modified を使います。
+// go コマンドはモジュール情報に VCS の情報を含めるため（-buildvcs）、リビジョンが変わると再リンクされますが、
+// SOURCE_DATE_EPOCH や env で参照する環境変数を変えただけでは再リンクされないことに注意してください。
+package buildmeta
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/linkdeps"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+// Config はビルド情報の埋め込みの設定です
+type Config struct {
+	// Vars は "パッケージ.変数名" と値のテンプレートの組です
+	Vars map[string]string `json:"vars"`
+	// Time はビルド時刻を求める方法を優先順に並べたものです
+	Time []string `json:"time"`
+}
+
+// Info はテンプレートから参照できるビルド情報です
+type Info struct {
+	// Revision は HEAD のコミットのハッシュです
+	Revision string
+	// ShortRevision は Revision の先頭12文字です
+	ShortRevision string
+	// Dirty は追跡しているファイルにコミットされていない変更があるかどうかです
+	Dirty bool
+	// Time は RFC 3339 形式のビルド時刻です。求められない場合は空です
+	Time string
+	// Unix は UNIX 時間のビルド時刻です。求められない場合は0です
+	Unix int64
+	// Module はメインモジュールのパスです
+	Module string
+	// Version はメインモジュールのバージョンです。
+	// go コマンドが VCS のタグから求めたもので、タグがない場合は (devel) です。
+	Version string
+}
+
+var defaultTimeSources = []string{"SOURCE_DATE_EPOCH", "commit"}
+
+// Load は dir のリポジトリと link に渡されたモジュール情報からビルド情報を求めます
+func Load(dir, modinfo string, timeSources []string) (*Info, error) {
+	info := &Info{}
+
+	bi, err := linkdeps.ParseModInfo(modinfo)
+	if err != nil {
+		return nil, err
+	}
+	info.Module, info.Version = bi.Main.Path, bi.Main.Version
+	// go コマンドが -buildvcs で含めた VCS の情報です
+	vcs := make(map[string]string)
+	for _, s := range bi.Settings {
+		vcs[s.Key] = s.Value
+	}
+
+	var commitTime time.Time
+	repo, err := FindRepo(dir)
+	if err != nil {
+		return nil, err
+	}
+	if repo != nil {
+		if info.Revision, err = repo.Head(); err != nil {
+			return nil, err
+		}
+		if modified, ok := vcs["vcs.modified"]; ok {
+			// go コマンドは git status で求めるため、index に追加しただけでコミットしていない変更も含みます
+			info.Dirty = modified == "true"
+		} else if info.Dirty, err = repo.Dirty(); err != nil {
+			// -buildvcs=false などで VCS の情報がなく、index も読めない場合はビルドを失敗させずに変更なしとみなします
+			info.Dirty = false
+		}
+		if t, ok, err := repo.CommitTime(info.Revision); err != nil {
+			return nil, err
+		} else if ok {
+			commitTime = t
+		}
+	} else {
+		info.Revision = vcs["vcs.revision"]
+		info.Dirty = vcs["vcs.modified"] == "true"
+	}
+	if commitTime.IsZero() && vcs["vcs.time"] != "" && vcs["vcs.revision"] == info.Revision {
+		if t, err := time.Parse(time.RFC3339, vcs["vcs.time"]); err == nil {
+			commitTime = t
+		}
+	}
+
+	info.ShortRevision = info.Revision
+	if len(info.ShortRevision) > 12 {
+		info.ShortRevision = info.ShortRevision[:12]
+	}
+
+	if len(timeSources) == 0 {
+		timeSources = defaultTimeSources
+	}
+	for _, src := range timeSources {
+		var t time.Time
+		switch src {
+		case "SOURCE_DATE_EPOCH":
+			if v := os.Getenv("SOURCE_DATE_EPOCH"); v != "" {
+				sec, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					return nil, msg.Errorf(msg.BuildmetaInvalidEpoch, err)
+				}
+				t = time.Unix(sec, 0)
+			}
+		case "commit":
+			t = commitTime
+		case "now":
+			t = time.Now()
+		default:
+			return nil, msg.Errorf(msg.BuildmetaUnknownTime, src)
+		}
+		if !t.IsZero() {
+			info.Time = t.UTC().Format(time.RFC3339)
+			info.Unix = t.Unix()
+			break
+		}
+	}
+
+	return info, nil
+}
+
+// Flags は vars のテンプレートを info で展開し、link に追加する -X フラグを返します
+func Flags(vars map[string]string, info *Info) ([]string, error) {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	funcs := template.FuncMap{"env": os.Getenv}
+	var flags []string
+	for _, name := range names {
+		tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(vars[name])
+		if err != nil {
+			return nil, err
+		}
+		var value bytes.Buffer
+		if err := tmpl.Execute(&value, info); err != nil {
+			return nil, err
+		}
+		if value.Len() == 0 {
+			continue
+		}
+		flags = append(flags, "-X", name+"="+value.String())
+	}
+	return flags, nil
+}
+
+// Hook は link に -X フラグを追加します
+func Hook(c *Config) hook.Hook {
+	return hook.Hook{
+		Name: "buildmeta",
+		Before: func(inv *hook.Invocation) error {
+			if len(c.Vars) == 0 || inv.Tool != "link" {
+				return nil
+			}
+
+			cfg, err := inv.ImportCfg()
+			if err != nil {
+				return err
+			}
+			dir, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			info, err := Load(dir, cfg.ModInfo, c.Time)
+			if err != nil {
+				return err
+			}
+			// -ldflags で明示的に指定された変数はそちらを優先します
+			vars := make(map[string]string, len(c.Vars))
+			for name, tmpl := range c.Vars {
+				if !hasDefinition(inv.Args, name) {
+					vars[name] = tmpl
+				}
+			}
+			flags, err := Flags(vars, info)
+			if err != nil {
+				return err
+			}
+			inv.InsertArgs(flags...)
+			return nil
+		},
+	}
+}
+
+// hasDefinition は args に name の -X があるかどうかを返します
+func hasDefinition(args []string, name string) bool {
+	for i, arg := range args {
+		var def string
+		switch {
+		case (arg == "-X" || arg == "--X") && i+1 < len(args):
+			def = args[i+1]
+		case strings.HasPrefix(arg, "-X="):
+			def = arg[len("-X="):]
+		case strings.HasPrefix(arg, "--X="):
+			def = arg[len("--X="):]
+		default:
+			continue
+		}
+		if strings.HasPrefix(def, name+"=") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package buildmeta_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/buildmeta"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+)
+
+const mainGo = `package main
+
+var (
+	buildTime    = "unknown"
+	buildVersion = "dev"
+)
+
+func main() { println(buildTime, buildVersion) }
+`
+
+func TestHook(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not found")
+	}
+	config := buildtest.WriteConfig(t, `{"buildmeta": {"vars": {
+		"main.buildTime": "{{.Time}}",
+		"main.buildVersion": "{{.ShortRevision}}{{if .Dirty}}-dirty{{end}}"
+	}}}`)
+
+	dir := buildtest.WriteModule(t, map[string]string{"main.go": mainGo})
+	git := gitCommand(t, dir)
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	rev := git("rev-parse", "HEAD")[:12]
+
+	run := func(env []string, args ...string) string {
+		t.Helper()
+		env = append(env, "TOOLEXEC_CONFIG="+config)
+		if out, err := buildtest.GoBuild(t, dir, wrapper, env, append([]string{"-o", "app"}, args...)...); err != nil {
+			t.Fatalf("go build failed: %v\n%s", err, out)
+		}
+		out, err := exec.Command(filepath.Join(dir, "app")).CombinedOutput()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	// コミットの時刻がビルド時刻になります
+	if got, want := run(nil), "2025-09-27T01:00:00Z "+rev; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	// SOURCE_DATE_EPOCH はコミットの時刻より優先されます。変更があると -dirty が付きます
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(mainGo+"\n// changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := run([]string{"SOURCE_DATE_EPOCH=1700000000"}), "2023-11-14T22:13:20Z "+rev+"-dirty"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	// -ldflags で指定した値はそのまま使われます
+	if got, want := run(nil, "-ldflags=-X main.buildVersion=v1.2.3"), "2025-09-27T01:00:00Z v1.2.3"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	// index に追加しただけでコミットしていない変更も -dirty になります。
+	// index は変わっても link の入力は変わらないため、-a で再リンクさせます
+	git("add", "main.go")
+	if got, want := run(nil, "-a"), "2025-09-27T01:00:00Z "+rev+"-dirty"; got != want {
+		t.Errorf("staged change: got %q; want %q", got, want)
+	}
+}
+
+// gitCommand は dir で git を実行して出力を返す関数を返します
+func gitCommand(t *testing.T, dir string) func(args ...string) string {
+	return func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=gopher", "GIT_AUTHOR_EMAIL=gopher@example.com",
+			"GIT_COMMITTER_NAME=gopher", "GIT_COMMITTER_EMAIL=gopher@example.com",
+			"GIT_COMMITTER_DATE=2025-09-27T10:00:00+09:00",
+			"GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull,
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+}
+
+func TestDirty(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not found")
+	}
+
+	// newRepo は a.txt, dir/b.txt, other/c.txt をコミットしたリポジトリを作り、setup の git コマンドを実行します
+	newRepo := func(t *testing.T, initArgs []string, setup ...[]string) (string, func(args ...string) string) {
+		dir := t.TempDir()
+		for name, content := range map[string]string{"a.txt": "a\n", "dir/b.txt": "b\n", "other/c.txt": "c\n"} {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		git := gitCommand(t, dir)
+		git(append([]string{"init", "-q"}, initArgs...)...)
+		git("add", ".")
+		git("commit", "-q", "-m", "initial")
+		for _, args := range setup {
+			git(args...)
+		}
+		return dir, git
+	}
+	dirty := func(t *testing.T, dir string) bool {
+		t.Helper()
+		repo, err := buildmeta.FindRepo(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := repo.Dirty()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	// touch は内容を変えずに更新時刻だけを変え、内容のハッシュを比べさせます
+	touch := func(t *testing.T, path string) {
+		t.Helper()
+		later := time.Now().Add(time.Hour)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	modify := func(t *testing.T, path string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte("c\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		initArgs []string
+		setup    [][]string
+	}{
+		{name: "v2"},
+		{name: "v4", setup: [][]string{{"update-index", "--index-version", "4"}}},
+		{name: "sha256", initArgs: []string{"--object-format=sha256"}},
+		// other は作業ツリーから取り除かれ、index ではディレクトリのエントリになります
+		{name: "sparse", setup: [][]string{{"sparse-checkout", "set", "--cone", "--sparse-index", "dir"}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, _ := newRepo(t, tt.initArgs, tt.setup...)
+			if dirty(t, dir) {
+				t.Fatal("clean repository is dirty")
+			}
+			touch(t, filepath.Join(dir, "dir", "b.txt"))
+			if dirty(t, dir) {
+				t.Fatal("repository is dirty after touching a file")
+			}
+			modify(t, filepath.Join(dir, "dir", "b.txt"))
+			if !dirty(t, dir) {
+				t.Fatal("modified file is not detected")
+			}
+		})
+	}
+
+	t.Run("submodule", func(t *testing.T) {
+		sub, _ := newRepo(t, nil)
+		dir, git := newRepo(t, nil)
+		git("-c", "protocol.file.allow=always", "submodule", "add", "-q", sub, "sub")
+		git("commit", "-q", "-m", "add submodule")
+		if dirty(t, dir) {
+			t.Fatal("repository with a submodule is dirty")
+		}
+
+		gitCommand(t, filepath.Join(dir, "sub"))("commit", "-q", "--allow-empty", "-m", "advance")
+		if !dirty(t, dir) {
+			t.Fatal("submodule at another commit is not detected")
+		}
+	})
+
+	t.Run("split index", func(t *testing.T) {
+		dir, git := newRepo(t, nil, []string{"update-index", "--split-index"})
+		rev := git("rev-parse", "HEAD")
+
+		// index を読めなくても、変更の有無はモジュール情報の vcs.modified から求めます
+		const pad = "0123456789abcdef"
+		modinfo := pad + "path\texample.com/app\nmod\texample.com/app\t(devel)\t\nbuild\tvcs.revision=" + rev + "\nbuild\tvcs.modified=false\n" + pad
+		info, err := buildmeta.Load(dir, modinfo, []string{"now"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Revision != rev || info.Dirty {
+			t.Errorf("Load() = revision %s, dirty %v; want %s and clean from vcs.modified", info.Revision, info.Dirty, rev)
+		}
+	})
+}
@@ -0,0 +1,368 @@
+package buildmeta
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Repo は作業ツリーとその .git ディレクトリです
+type Repo struct {
+	// Root は作業ツリーの最上位のディレクトリです
+	Root string
+	// GitDir は .git ディレクトリです。worktree の場合は .git ファイルが指すディレクトリです
+	GitDir string
+	// CommonDir は refs や objects のあるディレクトリです。worktree 以外では GitDir と同じです
+	CommonDir string
+}
+
+// FindRepo は dir から親ディレクトリへ .git を探します。見つからない場合は nil を返します
+func FindRepo(dir string) (*Repo, error) {
+	for {
+		gitPath := filepath.Join(dir, ".git")
+		st, err := os.Stat(gitPath)
+		switch {
+		case err == nil && st.IsDir():
+			return &Repo{Root: dir, GitDir: gitPath, CommonDir: gitPath}, nil
+		case err == nil:
+			// git worktree では .git は "gitdir: <path>" と書かれたファイルです
+			data, err := os.ReadFile(gitPath)
+			if err != nil {
+				return nil, err
+			}
+			gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+			if !ok {
+				return nil, fmt.Errorf("invalid .git file: %s", gitPath)
+			}
+			if !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(dir, gitDir)
+			}
+			r := &Repo{Root: dir, GitDir: gitDir, CommonDir: gitDir}
+			if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+				r.CommonDir = filepath.Join(gitDir, strings.TrimSpace(string(data)))
+			}
+			return r, nil
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// Head は HEAD が指すコミットのハッシュを返します。コミットがまだない場合は空です
+func (r *Repo) Head() (string, error) {
+	data, err := os.ReadFile(filepath.Join(r.GitDir, "HEAD"))
+	if err != nil {
+		return "", err
+	}
+	head := strings.TrimSpace(string(data))
+	ref, ok := strings.CutPrefix(head, "ref: ")
+	if !ok {
+		// detached HEAD
+		return head, nil
+	}
+	return r.resolveRef(ref)
+}
+
+func (r *Repo) resolveRef(ref string) (string, error) {
+	for _, dir := range []string{r.GitDir, r.CommonDir} {
+		if data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(ref))); err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
+	}
+
+	f, err := os.Open(filepath.Join(r.CommonDir, "packed-refs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// <hash> <ref> の行が並び、# で始まる行と ^ で始まる注釈付きタグの行は読み飛ばします
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		hash, name, ok := strings.Cut(s.Text(), " ")
+		if ok && name == ref {
+			return hash, nil
+		}
+	}
+	return "", s.Err()
+}
+
+// CommitTime はコミットの committer の時刻を返します。
+// ルーズオブジェクトだけを読むため、パックファイルに入ったコミットの場合は ok が false になります。
+func (r *Repo) CommitTime(hash string) (t time.Time, ok bool, err error) {
+	if len(hash) < 3 {
+		return time.Time{}, false, nil
+	}
+	f, err := os.Open(filepath.Join(r.CommonDir, "objects", hash[:2], hash[2:]))
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer f.Close()
+
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	// commit <size>\x00tree ...\nparent ...\nauthor ...\ncommitter Name <email> 1700000000 +0900\n
+	_, body, _ := bytes.Cut(data, []byte{0})
+	for _, line := range strings.Split(string(body), "\n") {
+		if line == "" {
+			break
+		}
+		rest, ok := strings.CutPrefix(line, "committer ")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 2 {
+			break
+		}
+		sec, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("commit %s: invalid committer time: %w", hash, err)
+		}
+		return time.Unix(sec, 0).UTC(), true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("commit %s: no committer", hash)
+}
+
+// errUnsupportedIndex は読めない形式の index であることを表します
+var errUnsupportedIndex = errors.New("unsupported git index")
+
+// Dirty は追跡しているファイルが index から変更されているかどうかを返します。
+// git status と同じく、まず index に記録されたサイズと更新時刻を比べ、
+// 更新時刻だけが異なる場合は内容のハッシュを比べます。追跡していないファイルと、
+// スパースチェックアウトで作業ツリーにないファイルは無視します。
+// サブモジュールは HEAD が index に記録されたコミットと異なる場合だけ変更ありとみなします。
+// HEAD のツリーとは比べないため、index に追加してコミットしていない変更は含みません。
+func (r *Repo) Dirty() (bool, error) {
+	entries, err := r.readIndex()
+	if err != nil {
+		return false, err
+	}
+	newHash := r.objectHash()
+	for _, e := range entries {
+		if e.skipWorktree {
+			continue
+		}
+		path := filepath.Join(r.Root, filepath.FromSlash(e.name))
+		if e.mode == modeGitlink {
+			if dirty, err := submoduleDirty(path, e.hash); err != nil || dirty {
+				return dirty, err
+			}
+			continue
+		}
+		st, err := os.Lstat(path)
+		if err != nil {
+			return true, nil
+		}
+		if uint32(st.Size()) != e.size {
+			return true, nil
+		}
+		mtime := st.ModTime()
+		if uint32(mtime.Unix()) == e.mtimeSec && uint32(mtime.Nanosecond()) == e.mtimeNsec {
+			continue
+		}
+		if !st.Mode().IsRegular() {
+			// シンボリックリンクなどは内容を比べずに変更ありとみなします
+			return true, nil
+		}
+		sum, err := blobHash(path, st.Size(), newHash())
+		if err != nil {
+			return false, err
+		}
+		if sum != e.hash {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// submoduleDirty はサブモジュールの HEAD が hash と異なるかどうかを返します。
+// 初期化されていないサブモジュールは git status と同じく変更なしとみなします
+func submoduleDirty(dir, hash string) (bool, error) {
+	if _, err := os.Lstat(filepath.Join(dir, ".git")); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	sub, err := FindRepo(dir)
+	if err != nil {
+		return false, err
+	}
+	head, err := sub.Head()
+	if err != nil {
+		return false, err
+	}
+	return head != hash, nil
+}
+
+// objectHash はリポジトリのオブジェクトの形式（extensions.objectFormat）のハッシュ関数を返します
+func (r *Repo) objectHash() func() hash.Hash {
+	data, err := os.ReadFile(filepath.Join(r.CommonDir, "config"))
+	if err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			key, value, ok := strings.Cut(line, "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "objectformat") && strings.TrimSpace(value) == "sha256" {
+				return sha256.New
+			}
+		}
+	}
+	return sha1.New
+}
+
+// modeGitlink はサブモジュールのコミットを表す index のエントリのモードです
+const modeGitlink = 0o160000
+
+type indexEntry struct {
+	mtimeSec, mtimeNsec uint32
+	mode                uint32
+	size                uint32
+	hash                string
+	name                string
+	// skipWorktree はスパースチェックアウトで作業ツリーに置かれないエントリです
+	skipWorktree bool
+}
+
+// readIndex は .git/index のバージョン2から4を読みます。
+// 分割された index（core.splitIndex）は共有された index を読まないため errUnsupportedIndex を返します
+func (r *Repo) readIndex() ([]indexEntry, error) {
+	data, err := os.ReadFile(filepath.Join(r.GitDir, "index"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[:4]) != "DIRC" {
+		return nil, fmt.Errorf("invalid git index")
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("%w: version %d", errUnsupportedIndex, version)
+	}
+	n := binary.BigEndian.Uint32(data[8:12])
+	hashSize := r.objectHash()().Size()
+
+	entries := make([]indexEntry, 0, n)
+	off := 12
+	var prev string
+	for range n {
+		// ctime(8) mtime(8) dev ino mode uid gid size(各4) ハッシュ flags(2)
+		fixed := 40 + hashSize + 2
+		if off+fixed+2 > len(data) {
+			return nil, fmt.Errorf("truncated git index")
+		}
+		e := data[off:]
+		entry := indexEntry{
+			mtimeSec:  binary.BigEndian.Uint32(e[8:12]),
+			mtimeNsec: binary.BigEndian.Uint32(e[12:16]),
+			mode:      binary.BigEndian.Uint32(e[24:28]),
+			size:      binary.BigEndian.Uint32(e[36:40]),
+			hash:      hex.EncodeToString(e[40 : 40+hashSize]),
+		}
+		flags := binary.BigEndian.Uint16(e[fixed-2 : fixed])
+		nameStart := fixed
+		if flags&0x4000 != 0 {
+			// バージョン3以降の拡張フラグ
+			entry.skipWorktree = binary.BigEndian.Uint16(e[fixed:fixed+2])&0x4000 != 0
+			nameStart += 2
+		}
+
+		if version == 4 {
+			// 直前のエントリの名前の末尾から取り除くバイト数と、続く名前が NUL 終端で書かれています
+			strip, l := indexVarint(e[nameStart:])
+			if l <= 0 || strip > uint64(len(prev)) {
+				return nil, fmt.Errorf("invalid git index")
+			}
+			suffix := e[nameStart+l:]
+			nameLen := bytes.IndexByte(suffix, 0)
+			if nameLen < 0 {
+				return nil, fmt.Errorf("truncated git index")
+			}
+			entry.name = prev[:len(prev)-int(strip)] + string(suffix[:nameLen])
+			off += nameStart + l + nameLen + 1
+		} else {
+			nameLen := bytes.IndexByte(e[nameStart:], 0)
+			if nameLen < 0 {
+				return nil, fmt.Errorf("truncated git index")
+			}
+			entry.name = string(e[nameStart : nameStart+nameLen])
+			// エントリは NUL を1つ以上含めて8バイト境界まで埋められています
+			off += (nameStart + nameLen + 8) &^ 7
+		}
+		entries = append(entries, entry)
+		prev = entry.name
+	}
+
+	// 拡張は 4 バイトの署名と長さが続き、最後に index 全体のハッシュがあります
+	for off+8 <= len(data)-hashSize {
+		if string(data[off:off+4]) == "link" {
+			return nil, fmt.Errorf("%w: split index", errUnsupportedIndex)
+		}
+		off += 8 + int(binary.BigEndian.Uint32(data[off+4:off+8]))
+	}
+	return entries, nil
+}
+
+// indexVarint は index のバージョン4で使われる可変長の整数を読み、値と読んだバイト数を返します
+func indexVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	c := b[0]
+	v := uint64(c & 0x7f)
+	i := 1
+	for c&0x80 != 0 {
+		if i >= len(b) {
+			return 0, 0
+		}
+		c = b[i]
+		i++
+		v = (v+1)<<7 | uint64(c&0x7f)
+	}
+	return v, i
+}
+
+// blobHash はファイルを git の blob として h でハッシュします
+func blobHash(path string, size int64, h hash.Hash) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(h, "blob %d\x00", size)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,183 @@
+// buildwatch は wrapper が送るビルドイベントを受け取り、パッケージごとの状況と失敗、集計を表示します。
+//
+//	buildwatch go build -toolexec="$PWD/wrapper" ./...
+//	buildwatch -listen /tmp/build.sock
+//	buildwatch -file events.jsonl
+//
+// コマンドを指定すると Unix ソケットを作ってそのパスを TOOLEXEC_EVENTS に設定してコマンドを実行し、
+// 終了するまで状況を表示します。-listen では指定したソケットで割り込みされるまで待ち受け、
+// -file では記録されたイベントのファイルから集計だけを表示します。
+//
+// 標準出力が端末の場合は実行中のパッケージの表を描き直し、それ以外の場合は終了した呼び出しを1行ずつ表示します。
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/event"
+)
+
+func main() {
+	listen := flag.String("listen", "", "Unix socket to listen on until interrupted")
+	file := flag.String("file", "", "events file to summarize")
+	rows := flag.Int("rows", 20, "maximum rows of the live table")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: buildwatch [-rows n] command [args...]\n       buildwatch [-rows n] -listen path\n       buildwatch -file events.jsonl")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	os.Exit(run(*listen, *file, *rows, flag.Args()))
+}
+
+func run(listen, file string, rows int, args []string) int {
+	board := event.NewBoard()
+
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "buildwatch: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		if err := event.Read(f, func(e event.Event) { board.Apply(e) }); err != nil {
+			fmt.Fprintf(os.Stderr, "buildwatch: %v\n", err)
+			return 1
+		}
+		return summarize(board)
+	}
+
+	if listen == "" && len(args) == 0 {
+		flag.Usage()
+		return 2
+	}
+	if listen == "" {
+		dir, err := os.MkdirTemp("", "buildwatch")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "buildwatch: %v\n", err)
+			return 1
+		}
+		defer os.RemoveAll(dir)
+		listen = filepath.Join(dir, "events.sock")
+	}
+	ln, err := net.Listen("unix", listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "buildwatch: %v\n", err)
+		return 1
+	}
+
+	events := make(chan event.Event)
+	var conns sync.WaitGroup
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func() {
+				defer conns.Done()
+				defer conn.Close()
+				event.Read(conn, func(e event.Event) { events <- e })
+			}()
+		}
+	}()
+
+	// コマンドが終了するか割り込みされたら、残りのイベントを受け取ってから終了します
+	done := make(chan struct{})
+	var (
+		cmdOutput bytes.Buffer
+		cmdErr    error
+	)
+	if len(args) > 0 {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Env = append(os.Environ(), event.Env+"=unix:"+listen)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = &cmdOutput
+		cmd.Stderr = &cmdOutput
+		if err := cmd.Start(); err != nil {
+			fmt.Fprintf(os.Stderr, "buildwatch: %v\n", err)
+			return 1
+		}
+		go func() {
+			cmdErr = cmd.Wait()
+			close(done)
+		}()
+	} else {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		go func() {
+			<-sig
+			close(done)
+		}()
+	}
+	go func() {
+		<-done
+		ln.Close()
+		conns.Wait()
+		close(events)
+	}()
+
+	live := isTerminal(os.Stdout)
+	tick := time.NewTicker(200 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				if live {
+					redraw(board, rows)
+				}
+				code := summarize(board)
+				// ツールの呼び出しの失敗として表示していない go コマンド自体のエラーです
+				if cmdErr != nil && len(board.Failed()) == 0 {
+					os.Stdout.Write(cmdOutput.Bytes())
+				}
+				var exitErr *exec.ExitError
+				if errors.As(cmdErr, &exitErr) {
+					return exitErr.ExitCode()
+				} else if cmdErr != nil {
+					return 1
+				}
+				return code
+			}
+			if s := board.Apply(e); s != nil && !live {
+				fmt.Printf("%-4s %s %s %.2fs\n", s.State, s.Tool, s.Package, s.Elapsed)
+			}
+		case <-tick.C:
+			if live {
+				redraw(board, rows)
+			}
+		}
+	}
+}
+
+// redraw は画面を消して表を描き直します
+func redraw(board *event.Board, rows int) {
+	fmt.Print("\x1b[H\x1b[2J")
+	board.Render(os.Stdout, time.Now(), rows)
+}
+
+func summarize(board *event.Board) int {
+	fmt.Println()
+	board.Summary(os.Stdout)
+	if len(board.Failed()) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/analyze"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/bce"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/binsize"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/escape"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/reach"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/record"
+)
+
+// commands は toolexec としてではなく直接実行されたときのサブコマンドです
+var commands = map[string]func(args []string) int{
+	"escape": escapeCommand,
+	"bce":    bceCommand,
+	"size":   sizeCommand,
+	"replay": replayCommand,
+	"reach":  reachCommand,
+	// analyze は compile の後に analyze フックから呼ばれます
+	"analyze": analyze.Main,
+}
+
+// escapeCommand はエスケープ解析レポートを操作します
+//
+//	wrapper escape report <dir>         dir/packages から report.json と report.html を作り直します
+//	wrapper escape diff <old> <new>     2つの report.json を比較します
+func escapeCommand(args []string) int {
+	if len(args) == 2 && args[0] == "report" {
+		r, err := escape.Collect(args[1])
+		if err == nil {
+			err = r.WriteFiles(args[1])
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, msg.Sprintf(msg.CommandFailed, "escape report", err))
+			return 1
+		}
+		return 0
+	}
+
+	if len(args) == 3 && args[0] == "diff" {
+		old, err := escape.ReadReport(args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, msg.Sprintf(msg.CommandFailed, "escape diff", err))
+			return 1
+		}
+		new, err := escape.ReadReport(args[2])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, msg.Sprintf(msg.CommandFailed, "escape diff", err))
+			return 1
+		}
+
+		lines := escape.Diff(old, new)
+		for _, l := range lines {
+			fmt.Println(l)
+		}
+		if len(lines) > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintln(os.Stderr, msg.Sprintf(msg.UsageEscape))
+	return 2
+}
+
+// bceCommand は境界チェックのレポートを作り直して表を表示します
+//
+//	wrapper bce report [-profile cpu.pprof] <dir>
+func bceCommand(args []string) int {
+	fs := flag.NewFlagSet("bce report", flag.ContinueOnError)
+	profile := fs.String("profile", "", "CPU profile used to rank bounds checks")
+	if len(args) == 0 || args[0] != "report" || fs.Parse(args[1:]) != nil || fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, msg.Sprintf(msg.UsageBCE))
+		return 2
+	}
+	dir := fs.Arg(0)
+
+	r, err := bce.Collect(dir)
+	if err == nil && *profile != "" {
+		err = r.Rank(*profile)
+	}
+	if err == nil {
+		err = r.WriteFiles(dir)
+	}
+	if err == nil {
+		err = r.WriteTable(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, msg.Sprintf(msg.CommandFailed, "bce report", err))
+		return 1
+	}
+	return 0
+}
+
+// sizeCommand はバイナリのサイズの内訳を表示します
+//
+//	wrapper size <binary>
+func sizeCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, msg.Sprintf(msg.UsageSize))
+		return 2
+	}
+
+	s, err := binsize.Analyze(args[0])
+	if err == nil {
+		err = s.WriteTable(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, msg.Sprintf(msg.CommandFailed, "size", err))
+		return 1
+	}
+	return 0
+}
+
+// replayCommand は record で記録したツールの呼び出しを go コマンドなしで再実行します
+//
+//	wrapper replay [-pkg pattern] [-tool compile] [-tooldir dir] [-extra flags] [-root dir] [-script] <log.jsonl>
+func replayCommand(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	pkg := fs.String("pkg", "", "comma-separated package patterns to replay (default all)")
+	tool := fs.String("tool", "", "comma-separated tools to replay (default all)")
+	toolDir := fs.String("tooldir", "", "directory of tools used instead of the recorded ones")
+	extra := fs.String("extra", "", "space-separated flags added to each replayed tool")
+	root := fs.String("root", "", "directory to extract archived inputs into (default temporary)")
+	script := fs.Bool("script", false, "print a shell script instead of running the tools")
+	if fs.Parse(args) != nil || fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, msg.Sprintf(msg.UsageReplay))
+		return 2
+	}
+
+	entries, err := record.ReadLog(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, msg.Sprintf(msg.CommandFailed, "replay", err))
+		return 1
+	}
+	opts := &record.Options{
+		Packages:  splitList(*pkg),
+		Tools:     splitList(*tool),
+		ToolDir:   *toolDir,
+		ExtraArgs: strings.Fields(*extra),
+		Root:      *root,
+	}
+	if *script && opts.Root == "" {
+		// スクリプトから参照できるように、展開したディレクトリを残します
+		if opts.Root, err = os.MkdirTemp("", "replay"); err != nil {
+			fmt.Fprintln(os.Stderr, msg.Sprintf(msg.CommandFailed, "replay", err))
+			return 1
+		}
+	}
+
+	cmds, _, cleanup, err := record.Prepare(record.Select(entries, opts), opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, msg.Sprintf(msg.CommandFailed, "replay", err))
+		return 1
+	}
+	defer cleanup()
+
+	if *script {
+		if err := record.WriteScript(os.Stdout, cmds); err != nil {
+			fmt.Fprintln(os.Stderr, msg.Sprintf(msg.CommandFailed, "replay", err))
+			return 1
+		}
+		return 0
+	}
+
+	code := 0
+	for _, r := range record.Run(cmds, os.Stdout, os.Stderr) {
+		status := msg.Sprintf(msg.ReplayOK)
+		switch {
+		case r.ExitCode != 0:
+			status = msg.Sprintf(msg.ReplayExitStatus, r.ExitCode, r.Command.Entry.ExitCode)
+			code = 1
+		case r.Command.Entry.Output == "":
+		case r.Same:
+			status += msg.Sprintf(msg.ReplaySame)
+		default:
+			status += msg.Sprintf(msg.ReplayDiffers)
+		}
+		fmt.Printf("%s %s: %s\n", r.Command.Entry.Tool, r.Command.Entry.ImportPath, status)
+	}
+	return code
+}
+
+// reachCommand は reach フックが書き出したグラフから、シンボルやパッケージがリンクされた理由を表示します
+//
+//	wrapper reach why <name.reach.json> <symbol or package>...
+func reachCommand(args []string) int {
+	if len(args) < 3 || args[0] != "why" {
+		fmt.Fprintln(os.Stderr, msg.Sprintf(msg.UsageReach))
+		return 2
+	}
+
+	g, err := reach.ReadGraph(args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, msg.Sprintf(msg.CommandFailed, "reach", err))
+		return 1
+	}
+	code := 0
+	for _, target := range args[2:] {
+		path := g.Why(target)
+		if path == nil {
+			code = 1
+		}
+		fmt.Println(reach.FormatPath(target, path))
+	}
+	return code
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
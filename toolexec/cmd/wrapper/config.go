@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/analyze"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/bce"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/binsize"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/buildmeta"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/compilecache"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/debugopt"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/escape"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/extraflags"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/fault"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/importpolicy"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/license"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/reach"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/record"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/reproducible"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/sbom"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/supervise"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/testbuild"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/trace"
+)
+
+// config は TOOLEXEC_CONFIG で指定される設定ファイルの内容です
+type config struct {
+	ImportPolicy importpolicy.Policy `json:"importPolicy"`
+	ExtraFlags   extraflags.Config   `json:"extraFlags"`
+	Escape       escape.Config       `json:"escape"`
+	Bce          bce.Config          `json:"bce"`
+	BinSize      binsize.Config      `json:"binsize"`
+	SBOM         sbom.Config         `json:"sbom"`
+	BuildMeta    buildmeta.Config    `json:"buildmeta"`
+	Analyze      analyze.Config      `json:"analyze"`
+	CompileCache compilecache.Config `json:"compileCache"`
+	Reproducible reproducible.Config `json:"reproducible"`
+	Record       record.Config       `json:"record"`
+	Trace        trace.Config        `json:"trace"`
+	Fault        fault.Config        `json:"fault"`
+	Debug        debugopt.Config     `json:"debug"`
+	Supervise    supervise.Config    `json:"supervise"`
+	Reach        reach.Config        `json:"reach"`
+	License      license.Config      `json:"license"`
+	TestBuild    testbuild.Config    `json:"testbuild"`
+}
+
+// loadConfig は設定ファイルを読み込み、その内容から作ったツールの識別子と一緒に返します。
+// 設定ファイルが指定されていない場合は何もしない設定になります。
+func loadConfig() (*config, string, error) {
+	var cfg config
+
+	path := os.Getenv("TOOLEXEC_CONFIG")
+	if path == "" {
+		return &cfg, "", nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("read config: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, "", fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	return &cfg, fmt.Sprintf("%x", sha256.Sum256(data))[:16], nil
+}
@@ -0,0 +1,112 @@
+// wrapper は設定ファイルに従ってビルドに処理を差し込む toolexec プログラムです。
+//
+//	go build -o wrapper ./toolexec/cmd/wrapper
+//	TOOLEXEC_CONFIG=$PWD/toolexec.json go build -toolexec="$PWD/wrapper" ./...
+//
+// 設定ファイルは TOOLEXEC_CONFIG 環境変数で指定した JSON ファイルです。
+// toolexec としてではなく直接実行した場合は、レポートの操作などのサブコマンドとして動作します。
+//
+//	wrapper escape diff old/report.json new/report.json
+//
+// メッセージの言語はロケールから選びます。-toolexec="$PWD/wrapper -lang=ja" のように指定することもできます。
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/analyze"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/bce"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/binsize"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/buildmeta"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/compilecache"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/debugopt"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/escape"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/event"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/extraflags"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/fault"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/importpolicy"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/license"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/reach"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/record"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/reproducible"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/sbom"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/supervise"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/testbuild"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/trace"
+	"suggestedfix"
+)
+
+func init() {
+	// ビルド中に実行するアナライザーはここで登録します
+	analyze.Register(suggestedfix.Analyzer)
+}
+
+func main() {
+	args, err := msg.ParseFlag(os.Args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	os.Args = args
+
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			os.Exit(cmd(os.Args[2:]))
+		}
+	}
+
+	cfg, id, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[TOOLEXEC] %v\n", err)
+		os.Exit(1)
+	}
+
+	// 障害を差し込むかどうかでコンパイル結果が変わるため、ビルドキャッシュを分けます
+	if len(cfg.Fault.Faults) > 0 && fault.Enabled() {
+		id += "+fault"
+	}
+	// TOOLEXEC_DEBUG で指定したパッケージも同様です
+	debugPackages := os.Getenv(debugopt.Env)
+	if debugPackages != "" {
+		sum := sha256.Sum256([]byte(debugPackages))
+		id += fmt.Sprintf("+debug=%x", sum[:8])
+	}
+	// go コマンドはコンパイラの出力もキャッシュして再表示するため、フックのメッセージの言語でも分けます
+	if lang := msg.Lang(); lang != msg.Default {
+		id += "+lang=" + lang
+	}
+
+	r := &hook.Runner{
+		ID: id,
+		Hooks: []hook.Hook{
+			// 他のフックの時間と出力も含めるため、最初に登録します
+			event.Hook(),
+			// Finish は登録順に呼ばれるため、trace と fault が Finish で書き換えたソースを削除する前に記録します。
+			// record は Finish だけを使うため、他のフックが Before で書き換えた引数も記録されます
+			record.Hook(&cfg.Record),
+			importpolicy.Hook(&cfg.ImportPolicy),
+			extraflags.Hook(&cfg.ExtraFlags),
+			debugopt.Hook(&cfg.Debug, debugPackages),
+			trace.Hook(&cfg.Trace),
+			escape.Hook(&cfg.Escape),
+			bce.Hook(&cfg.Bce),
+			binsize.Hook(&cfg.BinSize),
+			license.Hook(&cfg.License),
+			sbom.Hook(&cfg.SBOM),
+			reach.Hook(&cfg.Reach),
+			buildmeta.Hook(&cfg.BuildMeta),
+			// buildmeta が追加した -X もリリースビルドの判定に使います
+			fault.Hook(&cfg.Fault),
+			analyze.Hook(&cfg.Analyze),
+			compilecache.Hook(&cfg.CompileCache),
+			reproducible.Hook(&cfg.Reproducible),
+			testbuild.Hook(&cfg.TestBuild),
+			supervise.Hook(&cfg.Supervise),
+		},
+	}
+	r.Main()
+}
@@ -0,0 +1,177 @@
+// Package compilecache は compile の結果を内容アドレスでキャッシュします。
+//
+// 設定例:
+//
+//	{
+//	  "compileCache": {
+//	    "dir": "/mnt/shared/compile-cache",
+//	    "packages": ["example.com/app/..."],
+//	    "verify": false
+//	  }
+//	}
+//
+// go のビルドキャッシュはユーザーごとにあり、-trimpath を付けない場合はソースの絶対パスもキーに含むため、
+// チェックアウト先の異なる CI ワーカーの間ではほとんど共有されません。
+// このパッケージは compile の入力を正規化したハッシュ（Config.Key）をキーに出力したアーカイブを dir に保存し、
+// 同じキーの compile ではコンパイラを実行せずに保存したアーカイブを使います。
+// dir はリモートストレージの代わりで、共有ディレクトリを指定すると複数のマシンで共有できます。
+//
+// オブジェクトファイルには -trimpath で書き換えた後のソースのパスが記録されるため、
+// チェックアウト先が異なる環境で共有するには go build -trimpath を使ってください。
+// packages を省略するとすべてのパッケージ（標準ライブラリを含む）をキャッシュします。
+//
+// verify が true（または TOOLEXEC_CACHE_VERIFY=1）の場合はキャッシュがあってもコンパイルし、
+// 保存したアーカイブと一致しなければビルドを失敗させます。
+package compilecache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/atomicfile"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+// Config はコンパイルキャッシュの設定です
+type Config struct {
+	// Dir はキャッシュを保存するディレクトリです
+	Dir string `json:"dir"`
+	// Packages はキャッシュするパッケージのパターンです。省略時はすべてのパッケージです
+	Packages []string `json:"packages"`
+	// Verify が true の場合はキャッシュがあってもコンパイルして結果を比べます
+	Verify bool `json:"verify"`
+}
+
+// Entry はキャッシュしたコンパイル結果の付加情報です
+type Entry struct {
+	// BuildID は保存したアーカイブに埋め込まれているビルドIDです。
+	// 取り出すときに今回の -buildid に置き換えます。
+	BuildID string `json:"buildID"`
+	Stdout  []byte `json:"stdout,omitempty"`
+	Stderr  []byte `json:"stderr,omitempty"`
+}
+
+// Hook は compile をキャッシュから取り出すか、実行した結果をキャッシュに保存します
+func Hook(c *Config) hook.Hook {
+	return hook.Hook{
+		Name: "compilecache",
+		Wrap: func(inv *hook.Invocation, run func() error) error {
+			if c.Dir == "" || inv.Tool != "compile" || (len(c.Packages) > 0 && !hook.MatchAny(c.Packages, inv.Package())) {
+				return run()
+			}
+			output, ok := inv.Flag("o")
+			if !ok {
+				return run()
+			}
+			buildID, _ := inv.Flag("buildid")
+
+			key, ok, err := c.Key(inv)
+			if err != nil {
+				return fmt.Errorf("compilecache: %w", err)
+			}
+			if !ok {
+				return run()
+			}
+			entry := filepath.Join(c.Dir, key[:2], key)
+
+			cached, meta, err := c.load(entry)
+			if err != nil {
+				return fmt.Errorf("compilecache: %w", err)
+			}
+			verify := c.Verify || os.Getenv("TOOLEXEC_CACHE_VERIFY") == "1"
+
+			if cached != nil && !verify {
+				archive := bytes.ReplaceAll(cached, []byte(meta.BuildID), []byte(buildID))
+				if err := os.WriteFile(output, archive, 0o644); err != nil {
+					return fmt.Errorf("compilecache: %w", err)
+				}
+				inv.Stdout.Write(meta.Stdout)
+				inv.Stderr.Write(meta.Stderr)
+				return nil
+			}
+
+			// コンパイラの出力もキャッシュに保存し、キャッシュから取り出したときに再現します
+			var stdout, stderr bytes.Buffer
+			origStdout, origStderr := inv.Stdout, inv.Stderr
+			inv.Stdout = io.MultiWriter(origStdout, &stdout)
+			inv.Stderr = io.MultiWriter(origStderr, &stderr)
+			err = run()
+			inv.Stdout, inv.Stderr = origStdout, origStderr
+			if err != nil {
+				return err
+			}
+
+			archive, err := os.ReadFile(output)
+			if err != nil {
+				return fmt.Errorf("compilecache: %w", err)
+			}
+			if cached != nil {
+				return Verify(inv.ImportPath, key, bytes.ReplaceAll(cached, []byte(meta.BuildID), []byte(buildID)), archive)
+			}
+			return c.store(entry, archive, &Entry{BuildID: buildID, Stdout: stdout.Bytes(), Stderr: stderr.Bytes()})
+		},
+	}
+}
+
+// Verify はキャッシュしたアーカイブとコンパイルし直したアーカイブを比べます
+func Verify(importPath, key string, cached, compiled []byte) error {
+	if bytes.Equal(cached, compiled) {
+		return nil
+	}
+	n := min(len(cached), len(compiled))
+	offset := n
+	for i := range n {
+		if cached[i] != compiled[i] {
+			offset = i
+			break
+		}
+	}
+	return msg.Errorf(msg.CompileCacheMismatch, importPath, offset, len(cached), len(compiled), key)
+}
+
+// load はキャッシュからアーカイブと付加情報を読み込みます。キャッシュがない場合は nil を返します
+func (c *Config) load(entry string) ([]byte, *Entry, error) {
+	data, err := os.ReadFile(entry + ".json")
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var meta Entry
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, nil, err
+	}
+	archive, err := os.ReadFile(entry + ".a")
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return archive, &meta, nil
+}
+
+// store はアーカイブ、付加情報の順に保存します。load は付加情報があるものだけを読むため、
+// 並行して同じキーを保存しても途中の状態が読まれることはありません。
+func (c *Config) store(entry string, archive []byte, meta *Entry) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(entry), 0o755); err != nil {
+		return fmt.Errorf("compilecache: %w", err)
+	}
+	if err := atomicfile.WriteFile(entry+".a", archive); err != nil {
+		return fmt.Errorf("compilecache: %w", err)
+	}
+	if err := atomicfile.WriteFile(entry+".json", data); err != nil {
+		return fmt.Errorf("compilecache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package compilecache_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+)
+
+func TestHook(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	cacheDir := t.TempDir()
+	config := func(verify bool) string {
+		v := "false"
+		if verify {
+			v = "true"
+		}
+		return buildtest.WriteConfig(t, `{"compileCache": {"dir": "`+filepath.ToSlash(cacheDir)+`", "packages": ["example.com/app/..."], "verify": `+v+`}}`)
+	}
+	files := func() map[string]string {
+		return map[string]string{
+			"main.go":         "package main\n\nimport \"example.com/app/greet\"\n\nfunc main() { println(greet.Hello()) }\n",
+			"greet/greet.go":  "package greet\n\nimport _ \"embed\"\n\n//go:embed hello.txt\nvar hello string\n\nfunc Hello() string { return hello }\n",
+			"greet/hello.txt": "hello",
+		}
+	}
+
+	// チェックアウト先の異なる2つの CI ワーカーを、別々のディレクトリとビルドキャッシュで再現します
+	build := func(dir, config string) string {
+		t.Helper()
+		env := []string{"TOOLEXEC_CONFIG=" + config, "GOCACHE=" + t.TempDir()}
+		out, err := buildtest.GoBuild(t, dir, wrapper, env, "-trimpath", "-o", "app", ".")
+		if err != nil {
+			t.Fatalf("go build failed: %v\n%s", err, out)
+		}
+		got, err := exec.Command(filepath.Join(dir, "app")).CombinedOutput()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(got))
+	}
+	entries := func() []string {
+		t.Helper()
+		entries, err := filepath.Glob(filepath.Join(cacheDir, "*", "*.a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+
+	if got := build(buildtest.WriteModule(t, files()), config(false)); got != "hello" {
+		t.Fatalf("got %q", got)
+	}
+	if n := len(entries()); n != 2 {
+		t.Fatalf("%d packages are cached; want 2", n)
+	}
+
+	// 別のチェックアウトではキャッシュが使われ、新しいエントリは増えません
+	other := buildtest.WriteModule(t, files())
+	if got := build(other, config(false)); got != "hello" {
+		t.Fatalf("got %q", got)
+	}
+	if n := len(entries()); n != 2 {
+		t.Errorf("cache is not shared between checkouts: %d entries", n)
+	}
+	build(other, config(true))
+
+	// キャッシュが壊れていると検証モードで失敗します
+	for _, entry := range entries() {
+		data, err := os.ReadFile(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)-1] ^= 0xff
+		if err := os.WriteFile(entry, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env := []string{"TOOLEXEC_CONFIG=" + config(true), "GOCACHE=" + t.TempDir()}
+	out, err := buildtest.GoBuild(t, other, wrapper, env, "-trimpath", "-o", "app", ".")
+	if err == nil || !strings.Contains(out, "differs from compiler output") {
+		t.Errorf("verification does not detect a corrupted cache: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,274 @@
+package compilecache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/atomicfile"
+)
+
+// valueFlags は compile のフラグのうち、次の引数を値として受け取るものです
+var valueFlags = map[string]bool{
+	"-o": true, "-p": true, "-trimpath": true, "-buildid": true,
+	"-importcfg": true, "-embedcfg": true, "-symabis": true, "-asmhdr": true,
+	"-goversion": true, "-D": true, "-I": true, "-pgoprofile": true,
+	"-linkobj": true, "-coveragecfg": true,
+}
+
+// envVars はコンパイル結果に影響する環境変数です。go コマンドが compile の環境に設定します
+var envVars = []string{
+	"GOOS", "GOARCH", "GOEXPERIMENT", "GOFIPS140",
+	"GO386", "GOAMD64", "GOARM", "GOARM64", "GOMIPS", "GOMIPS64", "GOPPC64", "GORISCV64", "GOWASM",
+}
+
+// flag は "-name value" または "-name=value" を分解したフラグです
+type flag struct {
+	name, value string
+	hasValue    bool
+}
+
+func parseFlags(args []string) []flag {
+	var flags []flag
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if name, value, ok := strings.Cut(arg, "="); ok && strings.HasPrefix(arg, "-") {
+			flags = append(flags, flag{name: name, value: value, hasValue: true})
+			continue
+		}
+		if valueFlags[arg] && i+1 < len(args) {
+			flags = append(flags, flag{name: arg, value: args[i+1], hasValue: true})
+			i++
+			continue
+		}
+		flags = append(flags, flag{name: arg})
+	}
+	return flags
+}
+
+// Key は compile の入力を正規化してハッシュしたキャッシュのキーを返します。
+// キーにはツールのバージョン、フラグ、ソースの内容と -trimpath で書き換えた後のパス、
+// importcfg の依存パッケージのアーカイブのハッシュを含めます。
+// $WORK 以下の一時ファイルのパスや -buildid など、ビルドのたびに変わる値は含めません。
+// go_asm.h を出力する（-asmhdr）など、キャッシュできない呼び出しでは ok が false になります。
+func (c *Config) Key(inv *hook.Invocation) (key string, ok bool, err error) {
+	h := sha256.New()
+
+	version, err := exec.Command(inv.ToolPath, "-V=full").Output()
+	if err != nil {
+		return "", false, fmt.Errorf("%s -V=full: %w", inv.Tool, err)
+	}
+	fmt.Fprintf(h, "tool %s\n", bytes.TrimSpace(version))
+	for _, name := range envVars {
+		fmt.Fprintf(h, "env %s=%s\n", name, os.Getenv(name))
+	}
+
+	var trim []rewrite
+	flags := parseFlags(inv.Args[:inv.InputIndex()])
+	for _, f := range flags {
+		if f.name == "-trimpath" {
+			trim = parseTrimpath(f.value)
+		}
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", false, err
+	}
+	recorded := func(path string) string {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		return trimPath(path, trim)
+	}
+
+	for _, f := range flags {
+		switch f.name {
+		case "-asmhdr", "-linkobj":
+			// -o 以外の出力ファイルはキャッシュしません
+			return "", false, nil
+		case "-o", "-buildid", "-trimpath":
+			// 出力先とビルドIDはビルドごとに変わり、-trimpath はパスの書き換えとして反映します
+		case "-c":
+			// バックエンドの並列数は出力に影響しないため、CPU 数の違う CI ワーカーでも共有できるように除外します
+		case "-importcfg":
+			if err := c.hashImportCfg(h, f.value); err != nil {
+				return "", false, err
+			}
+		case "-embedcfg":
+			if err := hashEmbedCfg(h, f.value, recorded); err != nil {
+				return "", false, err
+			}
+		case "-symabis", "-pgoprofile", "-coveragecfg":
+			if err := hashFile(h, f.name, f.value); err != nil {
+				return "", false, err
+			}
+		case "-D", "-I":
+			fmt.Fprintf(h, "flag %s=%s\n", f.name, recorded(f.value))
+		default:
+			if f.hasValue {
+				fmt.Fprintf(h, "flag %s=%s\n", f.name, f.value)
+			} else {
+				fmt.Fprintf(h, "flag %s\n", f.name)
+			}
+		}
+	}
+
+	for _, file := range inv.Inputs() {
+		if err := hashFile(h, "input "+recorded(file), file); err != nil {
+			return "", false, err
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), true, nil
+}
+
+// hashImportCfg は importcfg の各依存パッケージを、パスではなくアーカイブの内容で表します
+func (c *Config) hashImportCfg(w io.Writer, path string) error {
+	cfg, err := hook.ReadImportCfg(path)
+	if err != nil {
+		return err
+	}
+	for _, from := range sortedKeys(cfg.ImportMap) {
+		fmt.Fprintf(w, "importmap %s=%s\n", from, cfg.ImportMap[from])
+	}
+	for _, pkg := range sortedKeys(cfg.PackageFile) {
+		sum, err := c.archiveHash(cfg.PackageFile[pkg])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "packagefile %s=%s\n", pkg, sum)
+	}
+	return nil
+}
+
+// hashEmbedCfg は //go:embed のパターンと、埋め込むファイルの内容をハッシュします
+func hashEmbedCfg(w io.Writer, path string, recorded func(string) string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var cfg struct {
+		Patterns map[string][]string
+		Files    map[string]string
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("parse embedcfg: %w", err)
+	}
+	for _, pattern := range sortedKeys(cfg.Patterns) {
+		fmt.Fprintf(w, "embed pattern %s=%s\n", pattern, strings.Join(cfg.Patterns[pattern], ","))
+	}
+	for _, name := range sortedKeys(cfg.Files) {
+		if err := hashFile(w, "embed file "+name, cfg.Files[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hashFile(w io.Writer, label, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s %x\n", label, h.Sum(nil))
+	return err
+}
+
+// archiveHash はアーカイブからビルドIDを取り除いた内容のハッシュを返します。
+// go のビルドキャッシュ内のファイルは書き換えられないため、パス、サイズ、更新時刻をキーに結果を保存します。
+func (c *Config) archiveHash(path string) (string, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	memo := filepath.Join(c.Dir, "archives", fmt.Sprintf("%x", sha256.Sum256(fmt.Appendf(nil, "%s %d %d", path, st.Size(), st.ModTime().UnixNano()))))
+	if sum, err := os.ReadFile(memo); err == nil {
+		return string(sum), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if id := BuildID(data); id != "" {
+		data = bytes.ReplaceAll(data, []byte(id), make([]byte, len(id)))
+	}
+	sum := fmt.Sprintf("%x", sha256.Sum256(data))
+	if err := os.MkdirAll(filepath.Dir(memo), 0o755); err != nil {
+		return "", err
+	}
+	if err := atomicfile.WriteFile(memo, []byte(sum)); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// BuildID はアーカイブの __.PKGDEF に書かれたビルドIDを返します
+//
+//	go object linux amd64 go1.25.1 X:...
+//	build id "actionID/contentID"
+func BuildID(archive []byte) string {
+	const prefix = "\nbuild id \""
+	i := bytes.Index(archive, []byte(prefix))
+	if i < 0 {
+		return ""
+	}
+	rest := archive[i+len(prefix):]
+	j := bytes.IndexByte(rest, '"')
+	if j < 0 {
+		return ""
+	}
+	return string(rest[:j])
+}
+
+// rewrite は -trimpath の "from=>to" 1つ分です
+type rewrite struct{ from, to string }
+
+func parseTrimpath(value string) []rewrite {
+	var rules []rewrite
+	for _, r := range strings.Split(value, ";") {
+		if from, to, ok := strings.Cut(r, "=>"); ok {
+			rules = append(rules, rewrite{from, to})
+		} else if r != "" {
+			rules = append(rules, rewrite{r, ""})
+		}
+	}
+	return rules
+}
+
+// trimPath はコンパイラと同じように -trimpath の規則でパスを書き換えます。
+// オブジェクトファイルにはこの書き換え後のパスが記録されます。
+func trimPath(path string, rules []rewrite) string {
+	for _, r := range rules {
+		rest, ok := strings.CutPrefix(path, r.from)
+		if !ok || (rest != "" && rest[0] != '/' && rest[0] != filepath.Separator) {
+			continue
+		}
+		if r.to == "" {
+			return strings.TrimLeft(rest, `/\`)
+		}
+		return r.to + filepath.ToSlash(rest)
+	}
+	return path
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,155 @@
+// Package debugopt は指定したパッケージだけ最適化とインライン化を無効にしてコンパイルします。
+//
+// 設定例:
+//
+//	{
+//	  "debug": {
+//	    "packages": ["example.com/app/internal/parser"]
+//	  }
+//	}
+//
+// Delve でデバッグするときに -gcflags=all=-N -l を使うとプログラム全体が遅くなるため、
+// デバッグするパッケージだけに -N -l を付け、それ以外は最適化したままにします。
+// 設定ファイルを変えずに TOOLEXEC_DEBUG=example.com/app/internal/parser,... でも指定できます。
+//
+//	TOOLEXEC_DEBUG=example.com/app/internal/parser dlv debug --build-flags=-toolexec="$PWD/wrapper" .
+//
+// -l を付けたパッケージの関数は他のパッケージでインライン化されなくなりますが、
+// ジェネリックな関数は呼び出し側のパッケージでインスタンス化されるため、最適化されたパッケージの中にインライン化されることがあります。
+// その場合はブレークポイントが止まらない理由が分かるように、インライン化された呼び出し箇所を表示します。
+package debugopt
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/escape"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+// Env は設定ファイルの代わりにデバッグするパッケージを指定する環境変数です
+const Env = "TOOLEXEC_DEBUG"
+
+// Config はデバッグ用のビルドの設定です
+type Config struct {
+	// Packages は最適化とインライン化を無効にするパッケージのパターンです
+	Packages []string `json:"packages"`
+}
+
+// Inlined は最適化されたパッケージにインライン化された、デバッグ対象のパッケージの関数の呼び出しです
+type Inlined struct {
+	// Pos は "file.go:line:col" 形式の呼び出し箇所です
+	Pos string
+	// Caller は呼び出し箇所を含む関数です
+	Caller string
+	// Callee はインライン化された関数です（例: lib.Max[go.shape.int]）
+	Callee string
+	// Package は Callee のパッケージのインポートパスです
+	Package string
+}
+
+// Hook はデバッグ対象のパッケージの compile に -N -l を追加し、
+// それをインポートする他のパッケージではデバッグ対象の関数がインライン化された箇所を表示します
+func Hook(c *Config, env string) hook.Hook {
+	patterns := append(c.Packages, splitList(env)...)
+	var captured *bytes.Buffer
+	var selected map[string]string
+
+	return hook.Hook{
+		Name: "debugopt",
+		Before: func(inv *hook.Invocation) error {
+			if len(patterns) == 0 || inv.Tool != "compile" {
+				return nil
+			}
+			if hook.MatchAny(patterns, inv.Package()) {
+				inv.InsertArgs("-N", "-l")
+				return nil
+			}
+
+			cfg, err := inv.ImportCfg()
+			if err != nil {
+				return err
+			}
+			selected = make(map[string]string)
+			// 自分のパッケージと同じ名前のパッケージは診断から区別できません
+			own, _ := inv.Flag("p")
+			for pkg := range cfg.PackageFile {
+				if packageName(pkg) == packageName(own) {
+					continue
+				}
+				if hook.MatchAny(patterns, pkg) {
+					selected[packageName(pkg)] = pkg
+				}
+			}
+			if len(selected) == 0 {
+				return nil
+			}
+			// インライン化の診断はユーザーに見せずに取り込みます
+			inv.InsertArgs("-m")
+			captured = inv.CaptureStdout()
+			return nil
+		},
+		After: func(inv *hook.Invocation) error {
+			if captured == nil {
+				return nil
+			}
+			records, err := escape.Parse(bytes.NewReader(captured.Bytes()), inv.GoFiles())
+			if err != nil {
+				return err
+			}
+			for _, in := range Find(records, selected) {
+				fmt.Fprintf(inv.Stderr, "[TOOLEXEC] debugopt: %s\n", msg.Sprintf(msg.DebugoptInlined, in.Pos, in.Callee, in.Package, in.Caller))
+			}
+			return nil
+		},
+	}
+}
+
+// Find はコンパイラの診断から、selected（パッケージ名からインポートパスへの対応）の関数がインライン化された呼び出しを探します。
+// インスタンス化した関数の中など、このパッケージのソースの外の位置は含めません。
+func Find(records []escape.Record, selected map[string]string) []Inlined {
+	var found []Inlined
+	seen := make(map[string]bool)
+	for _, rec := range records {
+		if rec.Kind != escape.KindCall || rec.Function == "" {
+			continue
+		}
+		name, _, ok := strings.Cut(rec.Subject, ".")
+		if !ok {
+			continue
+		}
+		pkg, ok := selected[name]
+		if !ok || seen[rec.Pos+rec.Subject] {
+			continue
+		}
+		seen[rec.Pos+rec.Subject] = true
+		found = append(found, Inlined{Pos: rec.Pos, Caller: rec.Function, Callee: rec.Subject, Package: pkg})
+	}
+	return found
+}
+
+var majorVersionRe = regexp.MustCompile(`^v[0-9]+$`)
+
+// packageName はインポートパスから診断に表示されるパッケージ名を推測します。
+// example.com/x/v2 のようにメジャーバージョンで終わる場合はその前の要素を使い、
+// gopkg.in/yaml.v3 の ".v3" や go-yaml の "go-" のような慣習的な接辞を取り除きます。
+func packageName(importPath string) string {
+	name := path.Base(importPath)
+	if majorVersionRe.MatchString(name) && path.Dir(importPath) != "." {
+		name = path.Base(path.Dir(importPath))
+	}
+	name, _, _ = strings.Cut(name, ".")
+	name = strings.TrimPrefix(name, "go-")
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,75 @@
+package debugopt_test
+
+import (
+	"debug/elf"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/debugopt"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+)
+
+func TestHook(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	dir := buildtest.WriteModule(t, map[string]string{
+		"lib/lib.go": `package lib
+
+func F() int { return 1 }
+
+func Max[T int | float64](a, b T) T {
+	if a > b {
+		return a
+	}
+	return b
+}
+`,
+		"other/other.go": "package other\n\nfunc G() int { return 2 }\n",
+		"main.go": `package main
+
+import (
+	"example.com/app/lib"
+	"example.com/app/other"
+)
+
+func main() { println(lib.F(), other.G(), lib.Max(1, 2)) }
+`,
+	})
+
+	out, err := buildtest.GoBuild(t, dir, wrapper, []string{debugopt.Env + "=example.com/app/lib"}, "-o", "app", ".")
+	if err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+	// ジェネリックな関数だけが最適化された main にインライン化されます
+	want := "[TOOLEXEC] debugopt: main.go:8:50: lib.Max[go.shape.int] from example.com/app/lib is inlined into main, which is optimized"
+	if !strings.Contains(out, want) || strings.Contains(out, "lib.F") {
+		t.Errorf("unexpected report\n%s", out)
+	}
+
+	// インライン化されて呼び出されない関数はリンクされません
+	syms := symbols(t, filepath.Join(dir, "app"))
+	if !syms["example.com/app/lib.F"] {
+		t.Error("lib.F is inlined")
+	}
+	if syms["example.com/app/other.G"] {
+		t.Error("other.G is not inlined; other packages should stay optimized")
+	}
+}
+
+func symbols(t *testing.T, path string) map[string]bool {
+	t.Helper()
+	f, err := elf.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	syms, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, s := range syms {
+		names[s.Name] = true
+	}
+	return names
+}
@@ -0,0 +1,160 @@
+// Package escape はコンパイラの -m=2 の出力からエスケープ解析とインライン化の結果を集計します。
+//
+// 設定例:
+//
+//	{
+//	  "escape": {
+//	    "packages": ["example.com/app/..."],
+//	    "dir": "/tmp/escape-report"
+//	  }
+//	}
+//
+// 対象パッケージの compile に -m=2 を追加し、その出力はユーザーに表示せずに
+// dir/packages 以下へパッケージごとの JSON として保存します。
+// link の後に dir/report.json と dir/report.html をまとめて書き出します。
+package escape
+
+import (
+	"bufio"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/srcpos"
+)
+
+// Kind は診断の種類です
+type Kind string
+
+const (
+	// KindEscape は値がヒープにエスケープするかどうかの診断です
+	KindEscape Kind = "escape"
+	// KindInline は関数がインライン化可能かどうかの診断です
+	KindInline Kind = "inline"
+	// KindCall は呼び出し箇所でインライン化されたことを表す診断です
+	KindCall Kind = "call"
+)
+
+// Record はコンパイラの診断1件分です
+type Record struct {
+	// Pos は "file.go:line:col" 形式の位置です
+	Pos string `json:"pos"`
+	// Function は診断の位置を含む関数です
+	Function string `json:"function"`
+	Kind     Kind   `json:"kind"`
+	// Subject は対象の式、変数、または関数です
+	Subject string `json:"subject"`
+	// Escapes は値がヒープにエスケープするかどうかです（KindEscape）
+	Escapes bool `json:"escapes,omitempty"`
+	// Inlined はインライン化されたか、インライン化可能かどうかです（KindInline, KindCall）
+	Inlined bool `json:"inlined,omitempty"`
+	// Reason はエスケープの経路、インライン化のコスト、またはインライン化できない理由です
+	Reason string `json:"reason,omitempty"`
+}
+
+var (
+	// ./esc.go:10:2: moved to heap: t
+	diagRe = regexp.MustCompile(`^(.+?):(\d+):(\d+): (.*)$`)
+
+	canInlineRe    = regexp.MustCompile(`^can inline (\S+) with (cost \d+)`)
+	cannotInlineRe = regexp.MustCompile(`^cannot inline (\S+): (.*)$`)
+	inliningCallRe = regexp.MustCompile(`^inlining call to (\S+)`)
+	// 経路の説明の見出し: "t escapes to heap in NewT:", "parameter v leaks to {heap} for Print with derefs=0:"
+	explainRe = regexp.MustCompile(`^(?:.+ escapes to heap in \S+|parameter \S+ leaks to .+):$`)
+)
+
+// Parse はコンパイラの -m=2 の出力を解釈します。
+// files はコンパイルしたソースファイルで、診断の位置から関数名を求めるために使います。
+func Parse(r io.Reader, files []string) ([]Record, error) {
+	funcs := srcpos.NewIndex(files)
+
+	var records []Record
+	// 経路の説明は位置ごとにまとめて、その後に続く結論の行の理由にします
+	explain := make(map[string][]string)
+	var current string
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		m := diagRe.FindStringSubmatch(s.Text())
+		if m == nil {
+			continue
+		}
+		file, line, col, msg := m[1], m[2], m[3], m[4]
+		pos := filepath.Base(file) + ":" + line + ":" + col
+		key := file + ":" + line + ":" + col
+
+		if strings.HasPrefix(msg, " ") {
+			if current == key {
+				explain[key] = append(explain[key], strings.TrimSpace(msg))
+			}
+			continue
+		}
+		current = ""
+
+		n, _ := strconv.Atoi(line)
+		rec := Record{Pos: pos, Function: funcs.Func(file, n)}
+		switch {
+		case explainRe.MatchString(msg):
+			current = key
+			continue
+		case canInlineRe.MatchString(msg):
+			m := canInlineRe.FindStringSubmatch(msg)
+			rec.Kind, rec.Subject, rec.Inlined, rec.Reason = KindInline, m[1], true, m[2]
+		case cannotInlineRe.MatchString(msg):
+			m := cannotInlineRe.FindStringSubmatch(msg)
+			rec.Kind, rec.Subject, rec.Reason = KindInline, m[1], m[2]
+		case inliningCallRe.MatchString(msg):
+			rec.Kind, rec.Subject, rec.Inlined = KindCall, inliningCallRe.FindStringSubmatch(msg)[1], true
+		case strings.HasPrefix(msg, "moved to heap: "):
+			rec.Kind, rec.Subject, rec.Escapes = KindEscape, strings.TrimPrefix(msg, "moved to heap: "), true
+			rec.Reason = reason(explain[key], "moved to heap")
+		case strings.HasSuffix(msg, " escapes to heap"):
+			rec.Kind, rec.Subject, rec.Escapes = KindEscape, strings.TrimSuffix(msg, " escapes to heap"), true
+			rec.Reason = reason(explain[key], "escapes to heap")
+		case strings.HasPrefix(msg, "leaking param content: "):
+			rec.Kind, rec.Subject = KindEscape, strings.TrimPrefix(msg, "leaking param content: ")
+			rec.Reason = "leaking param content"
+		case strings.HasPrefix(msg, "leaking param: "):
+			subject, to, ok := strings.Cut(strings.TrimPrefix(msg, "leaking param: "), " to ")
+			rec.Kind, rec.Subject = KindEscape, subject
+			if ok {
+				// 戻り値へのリークはヒープへのエスケープではありません
+				rec.Reason = "leaking param to " + to
+			} else {
+				rec.Escapes = true
+				rec.Reason = reason(explain[key], "leaking param")
+			}
+		case strings.HasSuffix(msg, " does not escape"):
+			rec.Kind, rec.Subject = KindEscape, strings.TrimSuffix(msg, " does not escape")
+		default:
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// reason はエスケープの経路の説明から "from ... (reason)" の行を取り出します
+func reason(lines []string, fallback string) string {
+	var froms []string
+	for _, l := range lines {
+		if from, ok := strings.CutPrefix(l, "from "); ok {
+			// 位置は行番号が変わると差分に現れてしまうため取り除きます
+			if i := strings.LastIndex(from, " at "); i >= 0 {
+				from = from[:i]
+			}
+			froms = append(froms, from)
+		}
+	}
+	if len(froms) == 0 {
+		return fallback
+	}
+	return strings.Join(froms, "; ")
+}
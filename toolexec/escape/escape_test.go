@@ -0,0 +1,120 @@
+package escape_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/escape"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+)
+
+const source = `package esc
+
+type T struct{ n int }
+
+func Add(a, b int) int { return a + b }
+
+func NewT(n int) *T {
+	t := T{n: n}
+	return &t
+}
+
+func Sum(xs []int) int {
+	s := 0
+	for _, x := range xs {
+		s = Add(s, x)
+	}
+	return s
+}
+
+func Big(n int) []int {
+	defer func() { recover() }()
+	return make([]int, n)
+}
+`
+
+func TestHook(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	reportDir := t.TempDir()
+	config := buildtest.WriteConfig(t, `{"escape": {"packages": ["example.com/app/..."], "dir": "`+filepath.ToSlash(reportDir)+`"}}`)
+	dir := buildtest.WriteModule(t, map[string]string{"esc/esc.go": source})
+
+	out, err := buildtest.GoBuild(t, dir, wrapper, []string{"TOOLEXEC_CONFIG=" + config}, "./...")
+	if err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+	if strings.Contains(out, "can inline") {
+		t.Errorf("compiler diagnostics are shown to the user\n%s", out)
+	}
+
+	r, err := escape.Collect(reportDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Packages) != 1 || r.Packages[0].ImportPath != "example.com/app/esc" {
+		t.Fatalf("unexpected packages: %+v", r.Packages)
+	}
+
+	records := r.Packages[0].Records
+	for _, want := range []escape.Record{
+		{Pos: "esc.go:5:6", Function: "Add", Kind: escape.KindInline, Subject: "Add", Inlined: true, Reason: "cost 4"},
+		{Pos: "esc.go:15:10", Function: "Sum", Kind: escape.KindCall, Subject: "Add", Inlined: true},
+		{Pos: "esc.go:12:10", Function: "Sum", Kind: escape.KindEscape, Subject: "xs"},
+		{Pos: "esc.go:20:6", Function: "Big", Kind: escape.KindInline, Subject: "Big", Reason: "unhandled op DEFER"},
+	} {
+		if !slices.Contains(records, want) {
+			t.Errorf("record %+v not found in %+v", want, records)
+		}
+	}
+
+	i := slices.IndexFunc(records, func(rec escape.Record) bool {
+		return rec.Function == "NewT" && rec.Subject == "t" && rec.Escapes
+	})
+	if i < 0 {
+		t.Fatalf("escape of t in NewT not found in %+v", records)
+	}
+	if !strings.Contains(records[i].Reason, "(address-of)") {
+		t.Errorf("reason of escape = %q; want address-of flow", records[i].Reason)
+	}
+
+	if err := r.WriteFiles(reportDir); err != nil {
+		t.Fatal(err)
+	}
+	html, err := os.ReadFile(filepath.Join(reportDir, "report.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), "<h2>example.com/app/esc</h2>") {
+		t.Errorf("report.html does not contain the package section")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := &escape.Report{Packages: []escape.Package{{
+		ImportPath: "example.com/app/esc",
+		Records: []escape.Record{
+			{Pos: "esc.go:8:2", Function: "NewT", Kind: escape.KindEscape, Subject: "t", Escapes: true},
+			{Pos: "esc.go:5:6", Function: "Add", Kind: escape.KindInline, Subject: "Add", Inlined: true},
+		},
+	}}}
+	new := &escape.Report{Packages: []escape.Package{{
+		ImportPath: "example.com/app/esc",
+		Records: []escape.Record{
+			// 行番号だけが変わった診断は差分になりません
+			{Pos: "esc.go:9:2", Function: "NewT", Kind: escape.KindEscape, Subject: "t", Escapes: true},
+			{Pos: "esc.go:5:6", Function: "Add", Kind: escape.KindInline, Subject: "Add", Reason: "function too complex"},
+		},
+	}}}
+
+	got := escape.Diff(old, new)
+	want := []string{
+		"- example.com/app/esc Add: Add can inline",
+		"+ example.com/app/esc Add: Add cannot inline: function too complex",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Diff() = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+package escape
+
+import (
+	"bytes"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+)
+
+// Config はエスケープ解析レポートの設定です
+type Config struct {
+	// Packages はレポートの対象にするパッケージのパターンです
+	Packages []string `json:"packages"`
+	// Dir はレポートを書き出すディレクトリです
+	Dir string `json:"dir"`
+}
+
+// Hook は対象パッケージの compile に -m=2 を追加して診断を保存し、
+// link の後にレポートを書き出します
+func Hook(c *Config) hook.Hook {
+	var captured *bytes.Buffer
+
+	return hook.Hook{
+		Name: "escape",
+		Before: func(inv *hook.Invocation) error {
+			if c.Dir == "" || inv.Tool != "compile" || !hook.MatchAny(c.Packages, inv.Package()) {
+				return nil
+			}
+			inv.InsertArgs("-m=2")
+			// 診断はユーザーに見せずに取り込みます
+			captured = inv.CaptureStdout()
+			return nil
+		},
+		After: func(inv *hook.Invocation) error {
+			if c.Dir == "" {
+				return nil
+			}
+
+			switch {
+			case captured != nil:
+				records, err := Parse(bytes.NewReader(captured.Bytes()), inv.GoFiles())
+				if err != nil {
+					return err
+				}
+				return WritePackage(c.Dir, Package{ImportPath: inv.ImportPath, Records: records})
+			case inv.Tool == "link":
+				r, err := Collect(c.Dir)
+				if err != nil {
+					return err
+				}
+				return r.WriteFiles(c.Dir)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,222 @@
+package escape
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/atomicfile"
+)
+
+// Package はパッケージ1つ分の診断です
+type Package struct {
+	ImportPath string   `json:"importPath"`
+	Records    []Record `json:"records"`
+}
+
+// Report はビルド全体の診断をまとめたレポートです
+type Report struct {
+	Packages []Package `json:"packages"`
+}
+
+// packagesDir はパッケージごとの JSON を保存するディレクトリです
+func packagesDir(dir string) string {
+	return filepath.Join(dir, "packages")
+}
+
+// WritePackage はパッケージごとの診断を dir/packages に保存します。
+// 並行して実行される link が Collect で読み込むため、一時ファイルに書いてから置き換えます。
+func WritePackage(dir string, pkg Package) error {
+	if err := os.MkdirAll(packagesDir(dir), 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(packagesDir(dir), url.PathEscape(pkg.ImportPath)+".json")
+	return atomicfile.WriteJSON(path, pkg)
+}
+
+// Collect は dir/packages に保存された診断を1つのレポートにまとめます
+func Collect(dir string) (*Report, error) {
+	paths, err := filepath.Glob(filepath.Join(packagesDir(dir), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Report{}
+	for _, path := range paths {
+		var pkg Package
+		if err := readJSON(path, &pkg); err != nil {
+			return nil, err
+		}
+		r.Packages = append(r.Packages, pkg)
+	}
+	sort.Slice(r.Packages, func(i, j int) bool {
+		return r.Packages[i].ImportPath < r.Packages[j].ImportPath
+	})
+	return r, nil
+}
+
+// ReadReport は WriteFiles で書き出した report.json を読み込みます
+func ReadReport(path string) (*Report, error) {
+	var r Report
+	if err := readJSON(path, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// WriteFiles はレポートを dir/report.json と dir/report.html に書き出します
+func (r *Report) WriteFiles(dir string) error {
+	if err := atomicfile.WriteJSON(filepath.Join(dir, "report.json"), r); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(dir, "report.html"))
+	if err != nil {
+		return err
+	}
+	if err := r.WriteHTML(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Function は HTML で関数ごとにまとめて表示するための診断です
+type Function struct {
+	Name    string
+	Records []Record
+	Escapes int
+}
+
+// Functions はパッケージの診断を関数ごとにまとめます
+func (p Package) Functions() []Function {
+	var funcs []Function
+	index := make(map[string]int)
+	for _, rec := range p.Records {
+		i, ok := index[rec.Function]
+		if !ok {
+			i = len(funcs)
+			index[rec.Function] = i
+			funcs = append(funcs, Function{Name: rec.Function})
+		}
+		funcs[i].Records = append(funcs[i].Records, rec)
+		if rec.Escapes {
+			funcs[i].Escapes++
+		}
+	}
+	sort.SliceStable(funcs, func(i, j int) bool { return funcs[i].Name < funcs[j].Name })
+	return funcs
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Escape analysis report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; font-family: monospace; }
+.escapes { background: #fdd; }
+.inlined { background: #dfd; }
+</style>
+</head>
+<body>
+<h1>Escape analysis report</h1>
+{{range .Packages}}
+<h2>{{.ImportPath}}</h2>
+{{range .Functions}}
+<details{{if .Escapes}} open{{end}}>
+<summary>{{if .Name}}{{.Name}}{{else}}(package scope){{end}} &mdash; {{.Escapes}} escapes</summary>
+<table>
+<tr><th>pos</th><th>kind</th><th>subject</th><th>result</th><th>reason</th></tr>
+{{range .Records}}
+<tr class="{{if .Escapes}}escapes{{else if .Inlined}}inlined{{end}}">
+<td>{{.Pos}}</td><td>{{.Kind}}</td><td>{{.Subject}}</td>
+<td>{{if eq .Kind "escape"}}{{if .Escapes}}escapes to heap{{else}}does not escape{{end}}{{else if eq .Kind "call"}}inlined{{else if .Inlined}}can inline{{else}}cannot inline{{end}}</td>
+<td>{{.Reason}}</td>
+</tr>
+{{end}}
+</table>
+</details>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML はレポートをパッケージと関数ごとにまとめた HTML として書き出します
+func (r *Report) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, r)
+}
+
+// Diff は2つのレポートを比較し、消えた診断を "-"、増えた診断を "+" で始まる行として返します。
+// 行番号の変化を差分として扱わないように、位置以外の内容で比較します。
+func Diff(old, new *Report) []string {
+	oldKeys, newKeys := old.keys(), new.keys()
+
+	var lines []string
+	for k, n := range oldKeys {
+		for i := newKeys[k]; i < n; i++ {
+			lines = append(lines, "- "+k)
+		}
+	}
+	for k, n := range newKeys {
+		for i := oldKeys[k]; i < n; i++ {
+			lines = append(lines, "+ "+k)
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i][2:] != lines[j][2:] {
+			return lines[i][2:] < lines[j][2:]
+		}
+		return lines[i] < lines[j]
+	})
+	return lines
+}
+
+func (r *Report) keys() map[string]int {
+	keys := make(map[string]int)
+	for _, pkg := range r.Packages {
+		for _, rec := range pkg.Records {
+			keys[rec.describe(pkg.ImportPath)]++
+		}
+	}
+	return keys
+}
+
+func (rec Record) describe(importPath string) string {
+	var result string
+	switch {
+	case rec.Kind == KindEscape && rec.Escapes:
+		result = "escapes to heap"
+	case rec.Kind == KindEscape:
+		result = "does not escape"
+	case rec.Kind == KindCall:
+		result = "inlined call"
+	case rec.Inlined:
+		result = "can inline"
+	default:
+		result = "cannot inline: " + rec.Reason
+	}
+
+	fn := rec.Function
+	if fn == "" {
+		fn = "(package scope)"
+	}
+	return fmt.Sprintf("%s %s: %s %s", importPath, fn, strings.TrimSpace(rec.Subject), result)
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
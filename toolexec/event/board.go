@@ -0,0 +1,189 @@
+package event
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+// State は Status の状態です
+type State string
+
+const (
+	Running State = "running"
+	OK      State = "ok"
+	Failed  State = "FAIL"
+)
+
+// Status はツールの呼び出し1回分の状態です
+type Status struct {
+	Tool     string
+	Package  string
+	State    State
+	Start    time.Time
+	Elapsed  float64
+	ToolTime float64
+	ExitCode int
+	Phase    string
+	Error    string
+	Output   string
+}
+
+// Board は受け取ったイベントからパッケージごとの状態を集計します
+type Board struct {
+	statuses []*Status
+	// running はプロセス ID ごとの実行中の呼び出しです
+	running    map[int]*Status
+	start, end time.Time
+}
+
+// NewBoard は空の Board を作ります
+func NewBoard() *Board {
+	return &Board{running: make(map[int]*Status)}
+}
+
+// Apply はイベントを反映し、呼び出しが終了した場合はその状態を返します
+func (b *Board) Apply(e Event) *Status {
+	if b.start.IsZero() || e.Time.Before(b.start) {
+		b.start = e.Time
+	}
+	if e.Time.After(b.end) {
+		b.end = e.Time
+	}
+
+	s, ok := b.running[e.PID]
+	if !ok || e.Action == Start {
+		s = &Status{Tool: e.Tool, Package: e.Package, State: Running, Start: e.Time}
+		b.statuses = append(b.statuses, s)
+		b.running[e.PID] = s
+	}
+	switch e.Action {
+	case Run:
+		s.ToolTime = e.Elapsed
+	case Output:
+		s.Output += e.Output
+	case Pass, Fail:
+		s.State, s.Elapsed, s.Phase, s.Error = OK, e.Elapsed, e.Phase, e.Error
+		if e.Action == Fail {
+			s.State = Failed
+		}
+		if e.ExitCode != nil {
+			s.ExitCode = *e.ExitCode
+		}
+		delete(b.running, e.PID)
+		return s
+	}
+	return nil
+}
+
+// Failed は失敗した呼び出しを返します
+func (b *Board) Failed() []*Status {
+	var failed []*Status
+	for _, s := range b.statuses {
+		if s.State == Failed {
+			failed = append(failed, s)
+		}
+	}
+	return failed
+}
+
+// Render は実行中の呼び出しと直近に終了した呼び出しを最大 rows 行の表にします
+func (b *Board) Render(w io.Writer, now time.Time, rows int) error {
+	var running, done []*Status
+	for _, s := range b.statuses {
+		if s.State == Running {
+			running = append(running, s)
+		} else {
+			done = append(done, s)
+		}
+	}
+	list := running
+	if n := rows - len(list); n > 0 {
+		list = append(list, done[max(len(done)-n, 0):]...)
+	}
+	if len(list) > rows {
+		list = list[:rows]
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "STATE\tTOOL\tPACKAGE\tTIME\n")
+	for _, s := range list {
+		elapsed := s.Elapsed
+		if s.State == Running {
+			elapsed = now.Sub(s.Start).Seconds()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.2fs\n", s.State, s.Tool, s.Package, elapsed)
+	}
+	fmt.Fprintf(tw, "\n%s\n", msg.Sprintf(msg.BoardCounts, len(running), len(done), len(b.Failed())))
+	return tw.Flush()
+}
+
+// Summary は失敗した呼び出しとそのツールの出力、時間のかかった呼び出し、全体の集計を書き出します
+func (b *Board) Summary(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, s := range b.Failed() {
+		fmt.Fprintf(bw, "--- FAIL: %s %s (%s, exit status %d)\n", s.Tool, s.Package, s.Phase, s.ExitCode)
+		if s.Error != "" {
+			fmt.Fprintf(bw, "    %s\n", s.Error)
+		}
+		for _, line := range strings.Split(strings.TrimRight(s.Output, "\n"), "\n") {
+			if line != "" {
+				fmt.Fprintf(bw, "    %s\n", line)
+			}
+		}
+	}
+
+	tools := make(map[string]int)
+	done := make([]*Status, 0, len(b.statuses))
+	for _, s := range b.statuses {
+		if s.State != Running {
+			tools[s.Tool]++
+			done = append(done, s)
+		}
+	}
+	sort.SliceStable(done, func(i, j int) bool { return done[i].Elapsed > done[j].Elapsed })
+	if len(done) > 0 {
+		fmt.Fprintln(bw, msg.Sprintf(msg.BoardSlowest))
+		for _, s := range done[:min(len(done), 5)] {
+			fmt.Fprintf(bw, "    %.2fs\t%s %s\n", s.Elapsed, s.Tool, s.Package)
+		}
+	}
+
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	counts := make([]string, 0, len(names))
+	for _, name := range names {
+		counts = append(counts, fmt.Sprintf("%s %d", name, tools[name]))
+	}
+	result := "ok"
+	if len(b.Failed()) > 0 {
+		result = "FAIL"
+	}
+	fmt.Fprintf(bw, "%s\t%d actions (%s), %d failed, %.2fs\n", result, len(done), strings.Join(counts, ", "), len(b.Failed()), b.end.Sub(b.start).Seconds())
+	return bw.Flush()
+}
+
+// Read は r から1行1イベントを読み込んで fn を呼び出します。解釈できない行は無視します
+func Read(r io.Reader, fn func(Event)) error {
+	s := bufio.NewScanner(r)
+	// コンパイルエラーが多い場合は output イベントの行が長くなります
+	s.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for s.Scan() {
+		var e Event
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			continue
+		}
+		fn(e)
+	}
+	return s.Err()
+}
@@ -0,0 +1,197 @@
+// Package event はラッパーの各プロセスから、go test -json のような JSON のビルドイベントを送ります。
+//
+//	TOOLEXEC_EVENTS=unix:/tmp/build.sock go build -toolexec=wrapper ./...
+//	TOOLEXEC_EVENTS=/tmp/events.jsonl go build -toolexec=wrapper ./...
+//
+// TOOLEXEC_EVENTS に "unix:" で始まるパスを指定すると Unix ソケットに接続し、
+// それ以外はファイルに1行1イベントで追記します。ソケットに接続できない場合はイベントを送らずにビルドを続けます。
+//
+// ツール1回の呼び出しごとに次のイベントを送ります。
+//
+//	start   フックとツールの実行を始めた
+//	run     ツール本体が終了した（Elapsed はツールの実行時間、ExitCode は終了コード）
+//	output  ユーザーに表示されたツールの出力（コンパイルエラーなど）
+//	pass    フックを含めて成功した（Elapsed は全体の実行時間）
+//	fail    失敗した（Phase は失敗した段階、Error はフックのエラー）
+//
+// イベントを受け取ってビルドの状況を表示するには cmd/buildwatch を使います。
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+)
+
+// Env はイベントの送り先を指定する環境変数です
+const Env = "TOOLEXEC_EVENTS"
+
+// Action の値です
+const (
+	Start  = "start"
+	Run    = "run"
+	Output = "output"
+	Pass   = "pass"
+	Fail   = "fail"
+)
+
+// Phase の値です
+const (
+	PhaseBefore = "before"
+	PhaseRun    = "run"
+	PhaseAfter  = "after"
+)
+
+// Event はビルドイベントです
+type Event struct {
+	Time    time.Time `json:"Time"`
+	Action  string    `json:"Action"`
+	Tool    string    `json:"Tool"`
+	Package string    `json:"Package,omitempty"`
+	PID     int       `json:"PID"`
+	// Phase は fail の場合に失敗した段階（before, run, after）です
+	Phase string `json:"Phase,omitempty"`
+	// Elapsed は run ではツールの、pass と fail では全体の実行時間（秒）です
+	Elapsed  float64 `json:"Elapsed,omitempty"`
+	ExitCode *int    `json:"ExitCode,omitempty"`
+	Output   string  `json:"Output,omitempty"`
+	Error    string  `json:"Error,omitempty"`
+}
+
+// Open は dest にイベントを書き出す Writer を開きます
+func Open(dest string) (io.WriteCloser, error) {
+	if path, ok := strings.CutPrefix(dest, "unix:"); ok {
+		return net.Dial("unix", path)
+	}
+	return os.OpenFile(dest, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+}
+
+// Hook はツールの呼び出しごとにイベントを送ります。
+// 他のフックの処理時間も含めて計測し、ユーザーに表示される出力を取り込むため、最初に登録します。
+func Hook() hook.Hook {
+	var (
+		w       io.WriteCloser
+		start   time.Time
+		ran     bool
+		runErr  error
+		output  syncBuffer
+		emitErr error
+	)
+	emit := func(inv *hook.Invocation, e Event) {
+		if w == nil || emitErr != nil {
+			return
+		}
+		e.Time = time.Now()
+		e.Tool = inv.Tool
+		e.Package = inv.ImportPath
+		e.PID = os.Getpid()
+		data, err := json.Marshal(e)
+		if err != nil {
+			emitErr = err
+			return
+		}
+		// 他のプロセスのイベントと混ざらないように1回の書き込みで送ります
+		_, emitErr = w.Write(append(data, '\n'))
+	}
+
+	return hook.Hook{
+		Name: "event",
+		Before: func(inv *hook.Invocation) error {
+			dest := os.Getenv(Env)
+			if dest == "" {
+				return nil
+			}
+			var err error
+			if w, err = Open(dest); err != nil {
+				w = nil
+				return nil
+			}
+			start = time.Now()
+			inv.Stdout = io.MultiWriter(inv.Stdout, &output)
+			inv.Stderr = io.MultiWriter(inv.Stderr, &output)
+			emit(inv, Event{Action: Start})
+			return nil
+		},
+		Wrap: func(inv *hook.Invocation, run func() error) error {
+			runStart := time.Now()
+			err := run()
+			ran, runErr = true, err
+			if err == nil || isExitError(err) {
+				code := exitCode(err)
+				emit(inv, Event{Action: Run, Elapsed: time.Since(runStart).Seconds(), ExitCode: &code})
+			}
+			return err
+		},
+		Finish: func(inv *hook.Invocation, err error) {
+			if w == nil {
+				return
+			}
+			defer w.Close()
+
+			if out := output.String(); out != "" {
+				emit(inv, Event{Action: Output, Output: out})
+			}
+			e := Event{Action: Pass, Elapsed: time.Since(start).Seconds()}
+			if err != nil {
+				code := exitCode(err)
+				e.Action, e.ExitCode = Fail, &code
+				switch {
+				case isExitError(err):
+					e.Phase = PhaseRun
+				case runErr != nil:
+					// compilecache などの Wrap フックのエラーです
+					e.Phase, e.Error = PhaseRun, err.Error()
+				case ran:
+					e.Phase, e.Error = PhaseAfter, err.Error()
+				default:
+					e.Phase, e.Error = PhaseBefore, err.Error()
+				}
+			}
+			emit(inv, e)
+		},
+	}
+}
+
+func isExitError(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr)
+}
+
+// exitCode はラッパーが終了するときの終了コードを返します
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.ExitCode()
+	}
+	return 1
+}
+
+// syncBuffer はツールの標準出力と標準エラー出力から並行して書き込まれるバッファです
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
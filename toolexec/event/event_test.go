@@ -0,0 +1,105 @@
+package event_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/event"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+)
+
+func readEvents(t *testing.T, path string) []event.Event {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var events []event.Event
+	if err := event.Read(f, func(e event.Event) { events = append(events, e) }); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// actions はツールとパッケージの呼び出しのイベントの Action を順に返します
+func actions(events []event.Event, tool, pkg string) []event.Event {
+	var matched []event.Event
+	for _, e := range events {
+		if e.Tool == tool && e.Package == pkg {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+func TestHook(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	eventsPath := filepath.Join(t.TempDir(), "events.jsonl")
+	dir := buildtest.WriteModule(t, map[string]string{
+		"lib/lib.go": "package lib\n\nfunc F() int { return 1 }\n",
+		"main.go":    "package main\n\nimport \"example.com/app/lib\"\n\nfunc main() { println(lib.F()) }\n",
+	})
+	env := []string{event.Env + "=" + eventsPath}
+
+	if out, err := buildtest.GoBuild(t, dir, wrapper, env, "-o", "app", "."); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+	events := readEvents(t, eventsPath)
+	for _, inv := range [][2]string{{"compile", "example.com/app/lib"}, {"compile", "example.com/app"}, {"link", "example.com/app"}} {
+		es := actions(events, inv[0], inv[1])
+		if len(es) != 3 || es[0].Action != event.Start || es[1].Action != event.Run || es[2].Action != event.Pass {
+			t.Errorf("unexpected events for %s %s: %+v", inv[0], inv[1], es)
+			continue
+		}
+		if *es[1].ExitCode != 0 || es[2].Elapsed < es[1].Elapsed || es[0].PID != es[2].PID {
+			t.Errorf("unexpected events for %s %s: %+v", inv[0], inv[1], es)
+		}
+	}
+
+	// コンパイルエラーはツールの出力と一緒に fail として送ります
+	os.Remove(eventsPath)
+	if err := os.WriteFile(filepath.Join(dir, "lib", "lib.go"), []byte("package lib\n\nfunc F() int { return x }\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := buildtest.GoBuild(t, dir, wrapper, env, "-o", "app", "."); err == nil {
+		t.Fatalf("go build succeeded\n%s", out)
+	}
+	es := actions(readEvents(t, eventsPath), "compile", "example.com/app/lib")
+	if len(es) != 4 || es[2].Action != event.Output || es[3].Action != event.Fail {
+		t.Fatalf("unexpected events: %+v", es)
+	}
+	if !strings.Contains(es[2].Output, "undefined: x") || es[3].Phase != event.PhaseRun || *es[3].ExitCode == 0 {
+		t.Errorf("unexpected events: %+v", es)
+	}
+}
+
+func TestBuildwatch(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	buildwatch := buildtest.Build(t, "github.com/newmo-oss/gocon25-workshop/toolexec/cmd/buildwatch")
+	dir := buildtest.WriteModule(t, map[string]string{
+		"ok/ok.go":   "package ok\n\nfunc F() int { return 1 }\n",
+		"bad/bad.go": "package bad\n\nfunc F() int { return \"s\" }\n",
+	})
+
+	cmd := exec.Command(buildwatch, "go", "build", "-toolexec="+wrapper, "./...")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err == nil {
+		t.Fatalf("buildwatch succeeded\n%s", out)
+	}
+	for _, want := range []string{
+		"ok   compile example.com/app/ok ",
+		"FAIL compile example.com/app/bad ",
+		"--- FAIL: compile example.com/app/bad (run, exit status ",
+		`cannot use "s"`,
+		"FAIL\t2 actions (compile 2), 1 failed",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("output does not contain %q\n%s", want, out)
+		}
+	}
+}
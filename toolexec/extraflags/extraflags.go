@@ -0,0 +1,82 @@
+// Package extraflags はパッケージごとに compile や link のフラグを追加します。
+//
+// -gcflags=all=... のようにすべてのパッケージを再ビルドすることなく、
+// 特定のパッケージだけ -N -l や -d=checkptr を付けてコンパイルできます。
+//
+// 設定例:
+//
+//	{
+//	  "extraFlags": {
+//	    "rules": [
+//	      {"packages": "example.com/app/internal/parser", "compile": ["-N", "-l"]},
+//	      {"packages": "example.com/app/...", "compile": ["-d=checkptr"]},
+//	      {"packages": "example.com/app/cmd/server", "link": ["-s", "-w"]}
+//	    ],
+//	    "dryRun": true
+//	  }
+//	}
+package extraflags
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+)
+
+// Rule は packages に一致するパッケージの compile と link にフラグを追加します
+type Rule struct {
+	Packages string   `json:"packages"`
+	Compile  []string `json:"compile"`
+	Link     []string `json:"link"`
+}
+
+// Config はフラグ追加の設定です
+type Config struct {
+	Rules []Rule `json:"rules"`
+	// DryRun が true の場合、フラグを追加した最終的なコマンドを表示するだけで
+	// ツールは元の引数のまま実行します。TOOLEXEC_DRYRUN=1 でも有効になります。
+	DryRun bool `json:"dryRun"`
+}
+
+// Flags は importPath のパッケージで tool に追加するフラグを返します。
+// 複数のルールに一致した場合は設定ファイルに書かれた順に連結します。
+func (c *Config) Flags(tool, importPath string) []string {
+	var flags []string
+	for _, rule := range c.Rules {
+		if !hook.Match(rule.Packages, importPath) {
+			continue
+		}
+		switch tool {
+		case "compile":
+			flags = append(flags, rule.Compile...)
+		case "link":
+			flags = append(flags, rule.Link...)
+		}
+	}
+	return flags
+}
+
+// Hook は compile と link の引数にフラグを差し込みます
+func Hook(c *Config) hook.Hook {
+	return hook.Hook{
+		Name: "extraflags",
+		Before: func(inv *hook.Invocation) error {
+			if inv.Tool != "compile" && inv.Tool != "link" {
+				return nil
+			}
+
+			flags := c.Flags(inv.Tool, inv.Package())
+			if !c.DryRun && os.Getenv("TOOLEXEC_DRYRUN") != "1" {
+				inv.InsertArgs(flags...)
+				return nil
+			}
+
+			args := inv.Args
+			inv.InsertArgs(flags...)
+			fmt.Fprintf(inv.Stderr, "[TOOLEXEC] %s %s: %s\n", inv.Tool, inv.ImportPath, inv.CommandLine())
+			inv.Args = args
+			return nil
+		},
+	}
+}
@@ -0,0 +1,105 @@
+package extraflags_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+)
+
+var files = map[string]string{
+	"parser/parser.go": `package parser
+
+func Add(a, b int) int { return a + b }
+`,
+	"server/server.go": `package server
+
+func Sub(a, b int) int { return a - b }
+`,
+}
+
+func TestExtraFlags(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+
+	t.Run("inject", func(t *testing.T) {
+		config := buildtest.WriteConfig(t, `{
+  "extraFlags": {
+    "rules": [{"packages": "example.com/app/parser", "compile": ["-m"]}]
+  }
+}`)
+		dir := buildtest.WriteModule(t, files)
+
+		out, err := buildtest.GoBuild(t, dir, wrapper, []string{"TOOLEXEC_CONFIG=" + config}, "./...")
+		if err != nil {
+			t.Fatalf("go build failed: %v\n%s", err, out)
+		}
+		// -m を付けたパッケージだけインライン化の診断が出力されます
+		if !strings.Contains(out, "can inline Add") {
+			t.Errorf("output does not contain inlining diagnostics for parser\n%s", out)
+		}
+		if strings.Contains(out, "can inline Sub") {
+			t.Errorf("output contains inlining diagnostics for server\n%s", out)
+		}
+	})
+
+	t.Run("dryRun", func(t *testing.T) {
+		config := buildtest.WriteConfig(t, `{
+  "extraFlags": {
+    "rules": [{"packages": "example.com/app/parser", "compile": ["-N", "-l"]}],
+    "dryRun": true
+  }
+}`)
+		dir := buildtest.WriteModule(t, files)
+
+		out, err := buildtest.GoBuild(t, dir, wrapper, []string{"TOOLEXEC_CONFIG=" + config}, "./...")
+		if err != nil {
+			t.Fatalf("go build failed: %v\n%s", err, out)
+		}
+		for _, line := range strings.Split(out, "\n") {
+			if !strings.HasPrefix(line, "[TOOLEXEC] compile ") {
+				continue
+			}
+			injected := strings.Contains(line, " -N -l ")
+			want := strings.HasPrefix(line, "[TOOLEXEC] compile example.com/app/parser:")
+			if injected != want {
+				t.Errorf("unexpected flags in %q", line)
+			}
+			if want && !strings.HasSuffix(line, "parser.go") {
+				t.Errorf("flags are not placed before source files: %q", line)
+			}
+		}
+		if !strings.Contains(out, "[TOOLEXEC] compile example.com/app/parser:") {
+			t.Errorf("output does not contain the final argv for parser\n%s", out)
+		}
+	})
+
+	t.Run("test", func(t *testing.T) {
+		config := buildtest.WriteConfig(t, `{
+  "extraFlags": {
+    "rules": [{"packages": "example.com/app/parser", "compile": ["-m"]}]
+  }
+}`)
+		dir := buildtest.WriteModule(t, map[string]string{
+			"parser/parser.go": files["parser/parser.go"],
+			"parser/parser_test.go": `package parser
+
+import "testing"
+
+func TestAdd(t *testing.T) {
+	if Add(1, 2) != 3 {
+		t.Fail()
+	}
+}
+`,
+		})
+
+		// go test ではテストの変種 "example.com/app/parser [example.com/app/parser.test]" がコンパイルされます
+		out, err := buildtest.GoTest(t, dir, wrapper, []string{"TOOLEXEC_CONFIG=" + config}, "./...")
+		if err != nil {
+			t.Fatalf("go test failed: %v\n%s", err, out)
+		}
+		if !strings.Contains(out, "can inline Add") {
+			t.Errorf("output does not contain inlining diagnostics for the test variant of parser\n%s", out)
+		}
+	})
+}
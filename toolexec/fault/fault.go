@@ -0,0 +1,290 @@
+// Package fault は設定した関数でエラー、パニック、遅延を起こすコードをコンパイル時に差し込みます。
+//
+// 設定例:
+//
+//	{
+//	  "fault": {
+//	    "faults": [
+//	      {"func": "example.com/app/db.(*Client).Query", "kind": "error", "probability": 0.1},
+//	      {"func": "example.com/app/cache.Get", "kind": "latency", "latency": "200ms", "env": "FAULT_CACHE"},
+//	      {"func": "example.com/app/worker.Run", "kind": "panic", "env": "FAULT_WORKER"}
+//	    ],
+//	    "release": ["main.channel=release"]
+//	  }
+//	}
+//
+// 本番のコードにビルドタグやインターフェースを追加せずに結合テストで障害を起こすためのもので、
+// 設定があっても TOOLEXEC_FAULT=1 を指定したビルドでしか差し込みません。
+// 対象の関数の先頭には、kind に応じて次のような呼び出しを行番号が変わらないように差し込みます。
+//
+//	error    if err := inject.Fail(...); err != nil { return *new(T1), ..., err }
+//	panic    inject.Panic(...)
+//	latency  inject.Delay(...)
+//
+// probability は障害を起こす確率で、省略すると毎回起こします。
+// env を指定した場合はその環境変数が空でも "0" でもないときだけ起こします。
+//
+// 障害を差し込んだパッケージをリンクするときに、link の -X に release のいずれかの定義があれば
+// リリースビルドとみなしてビルドを失敗させます。
+//
+// 差し込んだコードが呼び出す inject パッケージは、-race や -buildmode=pie などのビルドと同じ計測とコード生成のフラグでコンパイルし、
+// フラグの組み合わせごとに cacheDir に保存します。
+package fault
+
+import (
+	_ "embed"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/srcpos"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/srcrewrite"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+// InjectPath は差し込む呼び出し先のパッケージです
+const InjectPath = "github.com/newmo-oss/gocon25-workshop/toolexec/fault/inject"
+
+//go:embed inject/inject.go
+var injectSource []byte
+
+// Config はフォルト注入の設定です
+type Config struct {
+	Faults []Fault `json:"faults"`
+	// Release はリリースビルドを示す -X の定義（例: main.channel=release）です
+	Release []string `json:"release"`
+	// CacheDir はコンパイルした inject パッケージを保存するディレクトリです。省略時はユーザーのキャッシュディレクトリです
+	CacheDir string `json:"cacheDir"`
+}
+
+// Fault は1つの関数に差し込む障害です
+type Fault struct {
+	// Func はパッケージパスを含む関数名（example.com/app/db.(*Client).Query）です
+	Func string `json:"func"`
+	// Kind は error, panic, latency のいずれかです
+	Kind        string  `json:"kind"`
+	Probability float64 `json:"probability"`
+	Env         string  `json:"env"`
+	// Latency は kind が latency の場合の待ち時間（time.ParseDuration の形式）です
+	Latency string `json:"latency"`
+}
+
+// Enabled はフォルト注入を有効にするフラグ（TOOLEXEC_FAULT=1）が指定されているかどうかを返します
+func Enabled() bool {
+	return os.Getenv("TOOLEXEC_FAULT") == "1"
+}
+
+// split は Func をパッケージパスと関数名に分けます
+func (f *Fault) split() (pkg, name string) {
+	slash := strings.LastIndexByte(f.Func, '/')
+	dot := strings.IndexByte(f.Func[slash+1:], '.')
+	if dot < 0 {
+		return "", f.Func
+	}
+	return f.Func[:slash+1+dot], f.Func[slash+1+dot+1:]
+}
+
+// faults はパッケージの障害を関数名ごとに返します
+func (c *Config) faults(pkg string) map[string]Fault {
+	m := make(map[string]Fault)
+	for _, f := range c.Faults {
+		if p, name := f.split(); p == pkg {
+			m[name] = f
+		}
+	}
+	return m
+}
+
+// linked はリンクするパッケージに障害を差し込んだものがあるかどうかを返します
+func (c *Config) linked(cfg *hook.ImportCfg, mainPkg string) bool {
+	for _, f := range c.Faults {
+		pkg, _ := f.split()
+		if _, ok := cfg.PackageFile[pkg]; ok || pkg == mainPkg {
+			return true
+		}
+	}
+	return false
+}
+
+// Hook は TOOLEXEC_FAULT=1 の場合に対象パッケージの compile でソースを書き換え、link で inject パッケージを追加します
+func Hook(c *Config) hook.Hook {
+	var tmpDir string
+	inject := &srcrewrite.Package{Path: InjectPath, Source: injectSource, CacheDir: c.CacheDir}
+
+	return hook.Hook{
+		Name: "fault",
+		Before: func(inv *hook.Invocation) error {
+			if len(c.Faults) == 0 || !Enabled() {
+				return nil
+			}
+
+			switch inv.Tool {
+			case "link":
+				cfg, err := inv.ImportCfg()
+				if err != nil {
+					return err
+				}
+				if !c.linked(cfg, inv.ImportPath) {
+					return nil
+				}
+				if def, ok := releaseDefinition(inv.Args, c.Release); ok {
+					return msg.Errorf(msg.FaultReleaseBuild, inv.ImportPath, def)
+				}
+				return inject.Add(inv)
+
+			case "compile":
+				// メインパッケージの -p は main になるため、インポートパスで指定します
+				pkgPath, ok := inv.Flag("p")
+				if !ok || pkgPath == "main" {
+					pkgPath, _, _ = strings.Cut(inv.ImportPath, " ")
+				}
+				faults := c.faults(pkgPath)
+				output, ok := inv.Flag("o")
+				if len(faults) == 0 || !ok {
+					return nil
+				}
+				dir, err := os.MkdirTemp(filepath.Dir(output), "fault")
+				if err != nil {
+					return err
+				}
+				tmpDir = dir
+
+				found := make(map[string]bool)
+				instrumented, err := srcrewrite.Files(inv, dir, func(filename string, src []byte) ([]byte, bool, error) {
+					return Instrument(filename, src, pkgPath, faults, found)
+				})
+				if err != nil {
+					return err
+				}
+				for name, f := range faults {
+					if !found[name] {
+						return msg.Errorf(msg.FaultFuncNotFound, f.Func)
+					}
+				}
+				if !instrumented {
+					return nil
+				}
+				return inject.Add(inv)
+			}
+			return nil
+		},
+		Finish: func(inv *hook.Invocation, err error) {
+			if tmpDir != "" {
+				os.RemoveAll(tmpDir)
+			}
+		},
+	}
+}
+
+// Instrument は src の faults に含まれる関数の先頭に障害を起こす呼び出しを差し込み、
+// 差し込んだ関数名を found に記録します。対象の関数がない場合は ok が false になります。
+func Instrument(filename string, src []byte, pkgPath string, faults map[string]Fault, found map[string]bool) (out []byte, ok bool, err error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var inserts []srcrewrite.Insertion
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Body == nil {
+			continue
+		}
+		name := srcpos.FuncName(fd)
+		fault, ok := faults[name]
+		if !ok {
+			continue
+		}
+		code, err := statement(fset, src, fd, fault, pkgPath+"."+name)
+		if err != nil {
+			return nil, false, err
+		}
+		found[name] = true
+		inserts = append(inserts, srcrewrite.Insertion{
+			Offset: fset.Position(fd.Body.Lbrace).Offset + 1,
+			Text:   " " + code,
+		})
+	}
+	if len(inserts) == 0 {
+		return nil, false, nil
+	}
+	inserts = append(inserts, srcrewrite.Insertion{
+		Offset: fset.Position(f.Name.End()).Offset,
+		Text:   "; import __fault " + strconv.Quote(InjectPath),
+	})
+	return srcrewrite.Apply(filename, src, inserts), true, nil
+}
+
+// statement は関数の先頭に差し込む1行の文を作ります
+func statement(fset *token.FileSet, src []byte, fd *ast.FuncDecl, f Fault, name string) (string, error) {
+	probability := f.Probability
+	if probability == 0 {
+		probability = 1
+	}
+	args := fmt.Sprintf("%q, %s, %q", name, strconv.FormatFloat(probability, 'g', -1, 64), f.Env)
+
+	switch f.Kind {
+	case "panic":
+		return "__fault.Panic(" + args + ");", nil
+	case "latency":
+		d, err := time.ParseDuration(f.Latency)
+		if err != nil {
+			return "", msg.Errorf(msg.FaultInvalidLatency, f.Func, err)
+		}
+		return fmt.Sprintf("__fault.Delay(%s, %d);", args, d), nil
+	case "error":
+		var results []string
+		if fd.Type.Results != nil {
+			for _, field := range fd.Type.Results.List {
+				typ := string(src[fset.Position(field.Type.Pos()).Offset:fset.Position(field.Type.End()).Offset])
+				if strings.Contains(typ, "\n") {
+					return "", msg.Errorf(msg.FaultMultilineResult, f.Func)
+				}
+				n := max(len(field.Names), 1)
+				for range n {
+					results = append(results, typ)
+				}
+			}
+		}
+		if len(results) == 0 || results[len(results)-1] != "error" {
+			return "", msg.Errorf(msg.FaultNoErrorResult, f.Func)
+		}
+		values := make([]string, 0, len(results))
+		for _, typ := range results[:len(results)-1] {
+			values = append(values, "*new("+typ+")")
+		}
+		values = append(values, "__err")
+		return fmt.Sprintf("if __err := __fault.Fail(%s); __err != nil { return %s };", args, strings.Join(values, ", ")), nil
+	}
+	return "", msg.Errorf(msg.FaultUnknownKind, f.Func, f.Kind)
+}
+
+// releaseDefinition は link の -X の定義のうち release に含まれるものを返します
+func releaseDefinition(args, release []string) (string, bool) {
+	for i, arg := range args {
+		var def string
+		switch {
+		case (arg == "-X" || arg == "--X") && i+1 < len(args):
+			def = args[i+1]
+		case strings.HasPrefix(arg, "-X="):
+			def = arg[len("-X="):]
+		case strings.HasPrefix(arg, "--X="):
+			def = arg[len("--X="):]
+		default:
+			continue
+		}
+		if slices.Contains(release, def) {
+			return def, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,131 @@
+package fault_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+)
+
+func TestHook(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	config := buildtest.WriteConfig(t, `{"fault": {
+	"faults": [
+		{"func": "example.com/app/db.(*Client).Query", "kind": "error", "env": "FAULT_DB"},
+		{"func": "example.com/app/db.Slow", "kind": "latency", "latency": "300ms"},
+		{"func": "example.com/app.crash", "kind": "panic", "env": "FAULT_CRASH"}
+	],
+	"release": ["main.channel=release"],
+	"cacheDir": "`+filepath.ToSlash(t.TempDir())+`"
+}}`)
+	dir := buildtest.WriteModule(t, map[string]string{
+		"db/db.go": `package db
+
+type Client struct{}
+
+func (c *Client) Query(q string) (n int, s []string, err error) {
+	return 1, nil, nil
+}
+
+func Slow() {}
+`,
+		"main.go": `package main
+
+import (
+	"fmt"
+	"time"
+
+	"example.com/app/db"
+)
+
+var channel = "dev"
+
+func crash() {}
+
+func main() {
+	_, _, err := new(db.Client).Query("q")
+	fmt.Println("err:", err)
+
+	start := time.Now()
+	db.Slow()
+	fmt.Println("slow:", time.Since(start) >= 300*time.Millisecond)
+
+	crash()
+}
+`,
+	})
+	app := filepath.Join(dir, "app")
+	run := func(env ...string) string {
+		t.Helper()
+		cmd := exec.Command(app)
+		cmd.Env = append(os.Environ(), env...)
+		out, _ := cmd.CombinedOutput()
+		return string(out)
+	}
+	env := []string{"TOOLEXEC_CONFIG=" + config}
+
+	// フラグがなければ何も差し込みません
+	if out, err := buildtest.GoBuild(t, dir, wrapper, env, "-o", "app", "."); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+	if out := run("FAULT_DB=1", "FAULT_CRASH=1"); out != "err: <nil>\nslow: false\n" {
+		t.Errorf("faults are injected without TOOLEXEC_FAULT=1\n%s", out)
+	}
+
+	enabled := append(env, "TOOLEXEC_FAULT=1")
+	if out, err := buildtest.GoBuild(t, dir, wrapper, enabled, "-o", "app", "."); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+	if out := run(); out != "err: <nil>\nslow: true\n" {
+		t.Errorf("unexpected output without trigger variables\n%s", out)
+	}
+	out := run("FAULT_DB=1", "FAULT_CRASH=1")
+	if !strings.Contains(out, "err: fault: injected error in example.com/app/db.(*Client).Query\n") {
+		t.Errorf("error is not injected\n%s", out)
+	}
+	// パニックの位置は書き換える前のソースを指します
+	if !strings.Contains(out, "panic: fault: injected panic in example.com/app.crash") || !strings.Contains(out, filepath.Join(dir, "main.go")+":12") {
+		t.Errorf("panic is not injected\n%s", out)
+	}
+
+	out, err := buildtest.GoBuild(t, dir, wrapper, enabled, "-o", "app", "-ldflags=-X main.channel=release", ".")
+	if err == nil || !strings.Contains(out, "release build") {
+		t.Errorf("release build is not refused: %v\n%s", err, out)
+	}
+}
+
+func TestHookBuildFlags(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	cacheDir := t.TempDir()
+	config := buildtest.WriteConfig(t, `{"fault": {
+	"faults": [{"func": "example.com/app.crash", "kind": "panic"}],
+	"cacheDir": "`+filepath.ToSlash(cacheDir)+`"
+}}`)
+	dir := buildtest.WriteModule(t, map[string]string{
+		"main.go": `package main
+
+func crash() {}
+
+func main() { crash() }
+`,
+	})
+	env := []string{"TOOLEXEC_CONFIG=" + config, "TOOLEXEC_FAULT=1"}
+
+	// inject パッケージはビルドと同じ計測とコード生成のフラグでコンパイルします
+	for _, flags := range [][]string{{"-race"}, {"-buildmode=pie"}} {
+		args := append(flags, "-o", "app", ".")
+		if out, err := buildtest.GoBuild(t, dir, wrapper, env, args...); err != nil {
+			t.Fatalf("go build %s failed: %v\n%s", flags, err, out)
+		}
+		out, _ := exec.Command(filepath.Join(dir, "app")).CombinedOutput()
+		if !strings.Contains(string(out), "panic: fault: injected panic in example.com/app.crash") {
+			t.Errorf("panic is not injected into app built with %s\n%s", flags, out)
+		}
+	}
+	if archives, _ := filepath.Glob(filepath.Join(cacheDir, "*.a")); len(archives) != 2 {
+		t.Errorf("inject archives = %q; want one for each set of flags", archives)
+	}
+}
@@ -0,0 +1,69 @@
+// Package inject は fault フックがコンパイル時に関数へ差し込む呼び出し先です。
+//
+// link の importcfg にはプログラムが元々依存するパッケージしか含まれないため、
+// このパッケージは runtime 以外のパッケージに依存しないように、
+// 乱数、スリープ、環境変数を runtime から直接取得します。
+package inject
+
+import _ "unsafe" // go:linkname
+
+//go:linkname cheaprand runtime.cheaprand
+func cheaprand() uint32
+
+//go:linkname sleep time.Sleep
+func sleep(ns int64)
+
+//go:linkname runtimeEnvs syscall.runtime_envs
+func runtimeEnvs() []string
+
+// Error は注入されたエラーです
+type Error struct {
+	Func string
+}
+
+func (e *Error) Error() string {
+	return "fault: injected error in " + e.Func
+}
+
+// hit は障害を起こすかどうかを決めます。
+// env が空でなければその環境変数が空でも "0" でもない場合だけ、さらに probability の確率で起こします。
+func hit(probability float64, env string) bool {
+	if env != "" {
+		v := getenv(env)
+		if v == "" || v == "0" {
+			return false
+		}
+	}
+	return probability >= 1 || float64(cheaprand())/(1<<32) < probability
+}
+
+func getenv(key string) string {
+	for _, kv := range runtimeEnvs() {
+		if len(kv) > len(key) && kv[len(key)] == '=' && kv[:len(key)] == key {
+			return kv[len(key)+1:]
+		}
+	}
+	return ""
+}
+
+// Fail は障害を起こす場合に name の関数が返すエラーを返します
+func Fail(name string, probability float64, env string) error {
+	if !hit(probability, env) {
+		return nil
+	}
+	return &Error{Func: name}
+}
+
+// Panic は障害を起こす場合にパニックします
+func Panic(name string, probability float64, env string) {
+	if hit(probability, env) {
+		panic("fault: injected panic in " + name)
+	}
+}
+
+// Delay は障害を起こす場合に ns ナノ秒待ちます
+func Delay(name string, probability float64, env string, ns int64) {
+	if hit(probability, env) {
+		sleep(ns)
+	}
+}
@@ -0,0 +1,315 @@
+// Package hook は -toolexec から呼び出されるラッパーの共通部分です。
+//
+// go build -toolexec="wrapper" を指定すると、go コマンドは compile や link などのツールを
+// 直接実行する代わりに "wrapper /path/to/tool [ツールの引数...]" を実行します。
+// このパッケージはその引数を Invocation として解釈し、登録された Hook を
+// ツール実行の前後に呼び出します。
+package hook
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+// Invocation は toolexec から渡されたツールの呼び出し1回分を表します
+type Invocation struct {
+	// ToolPath は実行するツールのパスです（例: /usr/local/go/pkg/tool/linux_amd64/compile）
+	ToolPath string
+	// Tool はツール名です（compile, link, asm など）
+	Tool string
+	// Args はツールに渡す引数です。Before フックで書き換えることができます
+	Args []string
+	// ImportPath は TOOLEXEC_IMPORTPATH 環境変数の値で、ビルド中のパッケージを表します
+	ImportPath string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Limits はツールのプロセスに適用する制限です。Before フックで設定します
+	Limits Limits
+	// ProcessState は終了したツールのプロセスの状態です。起動できなかった場合は nil です
+	ProcessState *os.ProcessState
+	// Killed はラッパーがツールを終了させた理由（タイムアウト、転送したシグナル）です
+	Killed string
+
+	// captured は CaptureStdout で取り込んでいるツールの標準出力です
+	captured *bytes.Buffer
+	stdout   io.Writer
+}
+
+// Parse は os.Args 形式の引数から Invocation を作成します
+func Parse(args []string) (*Invocation, error) {
+	// Args[0]: このプログラム自身のパス
+	// Args[1]: 実行するツール（compile, link など）のパス
+	// Args[2:]: ツールに渡す引数
+	if len(args) < 2 {
+		return nil, msg.Errorf(msg.Usage, filepath.Base(args[0]))
+	}
+
+	toolPath := args[1]
+	return &Invocation{
+		ToolPath:   toolPath,
+		Tool:       strings.TrimSuffix(filepath.Base(toolPath), ".exe"),
+		Args:       args[2:],
+		ImportPath: os.Getenv("TOOLEXEC_IMPORTPATH"),
+		Stdin:      os.Stdin,
+		Stdout:     os.Stdout,
+		Stderr:     os.Stderr,
+	}, nil
+}
+
+// IsVersionQuery はビルドキャッシュのキーを作るための -V=full の呼び出しかどうかを返します
+func (inv *Invocation) IsVersionQuery() bool {
+	return len(inv.Args) == 1 && strings.HasPrefix(inv.Args[0], "-V")
+}
+
+// Flag は "-name value" または "-name=value" 形式のフラグの値を返します
+func (inv *Invocation) Flag(name string) (string, bool) {
+	prefix := "-" + name
+	for i, arg := range inv.Args {
+		if arg == prefix && i+1 < len(inv.Args) {
+			return inv.Args[i+1], true
+		}
+		if value, ok := strings.CutPrefix(arg, prefix+"="); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// HasFlag は値を取らないフラグ（-std, -pack など）が指定されているかどうかを返します
+func (inv *Invocation) HasFlag(name string) bool {
+	for _, arg := range inv.Args {
+		if arg == "-"+name || arg == "-"+name+"=true" {
+			return true
+		}
+	}
+	return false
+}
+
+// inputExts はツールの入力ファイルとして扱う拡張子です
+var inputExts = map[string]bool{".go": true, ".s": true, ".a": true, ".o": true}
+
+// InputIndex は引数のうち入力ファイルが始まる位置を返します。
+// compile や asm はフラグの後ろにソースファイルを、link はメインパッケージの
+// アーカイブを受け取るため、末尾から入力ファイルらしい引数を数えます。
+func (inv *Invocation) InputIndex() int {
+	i := len(inv.Args)
+	for i > 0 {
+		arg := inv.Args[i-1]
+		if strings.HasPrefix(arg, "-") || !inputExts[filepath.Ext(arg)] {
+			break
+		}
+		i--
+	}
+	return i
+}
+
+// Inputs はツールに渡される入力ファイルの一覧を返します
+func (inv *Invocation) Inputs() []string {
+	return inv.Args[inv.InputIndex():]
+}
+
+// GoFiles は compile に渡される .go ファイルの一覧を返します
+func (inv *Invocation) GoFiles() []string {
+	var files []string
+	for _, f := range inv.Inputs() {
+		if filepath.Ext(f) == ".go" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// InsertArgs は入力ファイルの直前に引数を挿入します。
+// compile ではソースファイルより前にフラグを置く必要があるため、このメソッドを使ってフラグを追加します。
+func (inv *Invocation) InsertArgs(args ...string) {
+	i := inv.InputIndex()
+	inv.Args = append(inv.Args[:i:i], append(args, inv.Args[i:]...)...)
+}
+
+// CommandLine はツールの実行コマンドを表示用の文字列にします
+func (inv *Invocation) CommandLine() string {
+	words := make([]string, 0, len(inv.Args)+1)
+	for _, w := range append([]string{inv.ToolPath}, inv.Args...) {
+		if w == "" || strings.ContainsAny(w, " \t\n\"'\\$") {
+			w = strconv.Quote(w)
+		}
+		words = append(words, w)
+	}
+	return strings.Join(words, " ")
+}
+
+// CaptureStdout はツールの標準出力をユーザーに表示せずに取り込むようにします。
+// compile の -m などの診断は標準出力に書かれるため、フックで解析するときに使います。
+// 複数のフックから呼ばれた場合は同じバッファを返します。
+// ツールが失敗した場合はコンパイルエラーを表示するために、取り込んだ出力を元の出力先に書き出します。
+func (inv *Invocation) CaptureStdout() *bytes.Buffer {
+	if inv.captured == nil {
+		inv.captured = new(bytes.Buffer)
+		inv.stdout, inv.Stdout = inv.Stdout, inv.captured
+	}
+	return inv.captured
+}
+
+// Hook はツール実行の前後に差し込まれる処理です
+type Hook struct {
+	// Name はエラー表示に使うフックの名前です
+	Name string
+	// Before はツール実行前に呼ばれます。エラーを返すとツールを実行せずにビルドを失敗させます
+	Before func(inv *Invocation) error
+	// Wrap はツール本体の実行を包みます。run を呼ぶと元のツール（または内側の Wrap）を実行し、
+	// run を呼ばずに戻るとツールの実行を省略できます。複数のフックの Wrap は登録順に外側から呼ばれます。
+	Wrap func(inv *Invocation, run func() error) error
+	// After はツールが正常終了した後に呼ばれます
+	After func(inv *Invocation) error
+	// Finish は成功・失敗にかかわらず最後に呼ばれます。err はビルドを失敗させたエラーです
+	Finish func(inv *Invocation, err error)
+}
+
+// Runner は Hook を順番に呼び出しながらツールを実行します
+type Runner struct {
+	// ID は -V=full の出力に追記される識別子です。
+	// go コマンドはこの出力をビルドキャッシュのキーに使うため、
+	// 設定が変わったときに古いキャッシュが使われないようにできます。
+	ID    string
+	Hooks []Hook
+}
+
+// Main は os.Args を解釈してツールを実行し、その終了コードで終了します
+func (r *Runner) Main() {
+	args, err := msg.ParseFlag(os.Args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	inv, err := Parse(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	err = r.Run(inv)
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		fmt.Fprintf(os.Stderr, "[TOOLEXEC] %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Run は Before フック、Wrap フックで包んだツール本体、After フック、Finish フックの順に実行します
+func (r *Runner) Run(inv *Invocation) error {
+	if inv.IsVersionQuery() {
+		return r.runVersionQuery(inv)
+	}
+
+	err := r.run(inv)
+	for _, h := range r.Hooks {
+		if h.Finish != nil {
+			h.Finish(inv, err)
+		}
+	}
+	return err
+}
+
+func (r *Runner) run(inv *Invocation) error {
+	for _, h := range r.Hooks {
+		if h.Before == nil {
+			continue
+		}
+		if err := h.Before(inv); err != nil {
+			return fmt.Errorf("%s: %w", h.Name, err)
+		}
+	}
+
+	run := inv.Run
+	for i := len(r.Hooks) - 1; i >= 0; i-- {
+		h, next := r.Hooks[i], run
+		if h.Wrap != nil {
+			run = func() error { return h.Wrap(inv, next) }
+		}
+	}
+
+	if err := run(); err != nil {
+		if inv.captured != nil {
+			inv.stdout.Write(inv.captured.Bytes())
+		}
+		return err
+	}
+
+	for _, h := range r.Hooks {
+		if h.After == nil {
+			continue
+		}
+		if err := h.After(inv); err != nil {
+			return fmt.Errorf("%s: %w", h.Name, err)
+		}
+	}
+	return nil
+}
+
+// Run は元のツールを Args で実行します。
+// ツールは独立したプロセスグループで起動し、ラッパーが受け取ったシグナルの転送と Limits の適用を行います。
+func (inv *Invocation) Run() error {
+	cmd := exec.Command(inv.ToolPath, inv.Args...)
+	cmd.Stdin = inv.Stdin
+	cmd.Stdout = inv.Stdout
+	cmd.Stderr = inv.Stderr
+	return inv.supervise(cmd)
+}
+
+// GoVersion は元のツールの -V の出力から "go1.25.1" のような Go のバージョンを返します
+func (inv *Invocation) GoVersion() (string, error) {
+	out, err := exec.Command(inv.ToolPath, "-V").Output()
+	if err != nil {
+		return "", err
+	}
+	// compile version go1.25.1
+	fields := strings.Fields(string(out))
+	if len(fields) < 3 {
+		return "", fmt.Errorf("unexpected version output: %q", out)
+	}
+	return fields[2], nil
+}
+
+// runVersionQuery はツールのバージョン出力に Runner.ID を追記します
+func (r *Runner) runVersionQuery(inv *Invocation) error {
+	var stdout bytes.Buffer
+	out := inv.Stdout
+	inv.Stdout = &stdout
+	defer func() { inv.Stdout = out }()
+
+	if err := inv.Run(); err != nil {
+		return err
+	}
+
+	line := strings.TrimSpace(stdout.String())
+	if r.ID != "" {
+		line = appendToolID(line, "toolexec="+r.ID)
+	}
+	_, err := fmt.Fprintln(out, line)
+	return err
+}
+
+// appendToolID は "compile version go1.25.1" のような出力に識別子を追加します。
+// 開発版のツールチェーンでは最後のフィールドが buildID= である必要があるため、その手前に挿入します。
+func appendToolID(line, id string) string {
+	fields := strings.Fields(line)
+	if len(fields) > 0 && strings.HasPrefix(fields[len(fields)-1], "buildID=") {
+		last := fields[len(fields)-1]
+		fields = append(fields[:len(fields)-1], id, last)
+		return strings.Join(fields, " ")
+	}
+	return line + " " + id
+}
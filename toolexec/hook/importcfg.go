@@ -0,0 +1,91 @@
+package hook
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ImportCfg は compile や link に -importcfg で渡される設定ファイルの内容です
+//
+//	# import config
+//	importmap old=new
+//	packagefile fmt=/tmp/go-build/b002/_pkg_.a
+//	modinfo "..."
+type ImportCfg struct {
+	// PackageFile はインポートパスからコンパイル済みアーカイブへの対応です
+	PackageFile map[string]string
+	// ImportMap はソース上のインポートパスから実際のパッケージ（vendor など）への対応です
+	ImportMap map[string]string
+	// ModInfo は link に渡されるモジュール情報で、runtime/debug.BuildInfo の文字列表現を含みます
+	ModInfo string
+}
+
+// ImportCfg は -importcfg で指定されたファイルを読み込みます
+func (inv *Invocation) ImportCfg() (*ImportCfg, error) {
+	path, ok := inv.Flag("importcfg")
+	if !ok {
+		return nil, fmt.Errorf("%s: -importcfg not found", inv.Tool)
+	}
+	return ReadImportCfg(path)
+}
+
+// ReadImportCfg は importcfg ファイルを読み込みます
+func ReadImportCfg(path string) (*ImportCfg, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg := &ImportCfg{
+		PackageFile: make(map[string]string),
+		ImportMap:   make(map[string]string),
+	}
+
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 16*1024*1024)
+	for lineno := 1; s.Scan(); lineno++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		verb, args, _ := strings.Cut(line, " ")
+		switch verb {
+		case "packagefile":
+			pkg, file, ok := strings.Cut(args, "=")
+			if !ok {
+				return nil, fmt.Errorf("%s:%d: invalid packagefile: %s", path, lineno, args)
+			}
+			cfg.PackageFile[pkg] = file
+		case "importmap":
+			from, to, ok := strings.Cut(args, "=")
+			if !ok {
+				return nil, fmt.Errorf("%s:%d: invalid importmap: %s", path, lineno, args)
+			}
+			cfg.ImportMap[from] = to
+		case "modinfo":
+			info, err := strconv.Unquote(args)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid modinfo: %w", path, lineno, err)
+			}
+			cfg.ModInfo = info
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Resolve はソース上のインポートパスを importmap に従って解決します
+func (cfg *ImportCfg) Resolve(importPath string) string {
+	if to, ok := cfg.ImportMap[importPath]; ok {
+		return to
+	}
+	return importPath
+}
@@ -0,0 +1,90 @@
+package hook
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Kind は go build や go test がツールを呼び出した目的の分類です
+type Kind string
+
+const (
+	// KindBuild は通常のビルドの compile, asm, link などです
+	KindBuild Kind = "build"
+	// KindTestCompile はテスト用の変種のパッケージのコンパイルです。
+	// TOOLEXEC_IMPORTPATH は "example.com/app/lib [example.com/app/lib.test]" のようになり、
+	// テスト対象のパッケージ、外部テストパッケージ（lib_test）、テスト対象をインポートするため
+	// 再コンパイルされるパッケージが含まれます。
+	KindTestCompile Kind = "test-compile"
+	// KindTestMain は go test が生成した _testmain.go のコンパイルです
+	KindTestMain Kind = "test-main"
+	// KindTestLink は *.test バイナリのリンクです
+	KindTestLink Kind = "test-link"
+	// KindVet は go test や go vet から実行される vet です
+	KindVet Kind = "vet"
+	// KindTest2JSON は test2json です
+	KindTest2JSON Kind = "test2json"
+)
+
+// IsTest はテストのための呼び出しかどうかを返します。vet は go vet から実行された場合も含みます。
+func (k Kind) IsTest() bool {
+	return k != KindBuild
+}
+
+// Kind は呼び出しの目的を分類します
+func (inv *Invocation) Kind() Kind {
+	switch inv.Tool {
+	case "vet":
+		return KindVet
+	case "test2json":
+		return KindTest2JSON
+	case "compile":
+		for _, f := range inv.GoFiles() {
+			if filepath.Base(f) == "_testmain.go" {
+				return KindTestMain
+			}
+		}
+	case "link":
+		if strings.HasSuffix(inv.ImportPath, ".test") {
+			return KindTestLink
+		}
+	}
+	if _, ok := variantOf(inv.ImportPath); ok {
+		return KindTestCompile
+	}
+	return KindBuild
+}
+
+// TestPackage はテストのための呼び出しの場合に、テスト対象のパッケージのインポートパスを返します。
+// "example.com/app/lib_test [example.com/app/lib.test]" や "example.com/app/lib.test" は
+// どちらも "example.com/app/lib" になります。
+func (inv *Invocation) TestPackage() (string, bool) {
+	if test, ok := variantOf(inv.ImportPath); ok {
+		return strings.TrimSuffix(test, ".test"), true
+	}
+	switch inv.Kind() {
+	case KindTestMain, KindTestLink:
+		return strings.TrimSuffix(inv.ImportPath, ".test"), true
+	}
+	return "", false
+}
+
+// Package は TOOLEXEC_IMPORTPATH からテストの変種の " [pkg.test]" を取り除いたインポートパスを返します。
+// *.test バイナリのリンク（"pkg.test"）ではテスト対象のパッケージを返します。
+// フックはパッケージのパターンをこの値と照合するため、go build と go test で同じパッケージが対象になります。
+func (inv *Invocation) Package() string {
+	if inv.Kind() == KindTestLink {
+		return strings.TrimSuffix(inv.ImportPath, ".test")
+	}
+	path, _, _ := strings.Cut(inv.ImportPath, " [")
+	return path
+}
+
+// variantOf は "pkg [pkg.test]" 形式のインポートパスから角括弧の中身を返します
+func variantOf(importPath string) (string, bool) {
+	_, rest, ok := strings.Cut(importPath, " [")
+	if !ok || !strings.HasSuffix(rest, "]") {
+		return "", false
+	}
+	return strings.TrimSuffix(rest, "]"), true
+}
@@ -0,0 +1,41 @@
+package hook
+
+import (
+	"path"
+	"strings"
+)
+
+// Match はインポートパスがパターンに一致するかどうかを返します。
+//
+// パターンには path.Match のグロブに加えて、go コマンドと同じく
+// "example.com/app/..." のような末尾の "/..." を使えます。
+// "/..." はそのパッケージ自身とその配下のすべてのパッケージに一致します。
+func Match(pattern, importPath string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/..."); ok {
+		if Match(prefix, importPath) {
+			return true
+		}
+		for dir := path.Dir(importPath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if Match(prefix, dir) {
+				return true
+			}
+		}
+		return false
+	}
+	if pattern == "..." {
+		return true
+	}
+
+	ok, err := path.Match(pattern, importPath)
+	return err == nil && ok
+}
+
+// MatchAny はいずれかのパターンに一致するかどうかを返します
+func MatchAny(patterns []string, importPath string) bool {
+	for _, p := range patterns {
+		if Match(p, importPath) {
+			return true
+		}
+	}
+	return false
+}
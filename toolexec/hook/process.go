@@ -0,0 +1,82 @@
+package hook
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+// Limits はツールのプロセスに適用する制限です
+type Limits struct {
+	// Timeout を過ぎるとツールのプロセスグループを終了させます。0 の場合は制限しません
+	Timeout time.Duration
+	// Memory はツールの仮想メモリの上限（バイト）です。0 の場合は制限しません
+	Memory uint64
+}
+
+// Usage はツールのプロセスの資源の使用量です
+type Usage struct {
+	UserTime   time.Duration `json:"userTime"`
+	SystemTime time.Duration `json:"systemTime"`
+	// MaxRSS は最大常駐セットサイズ（バイト）です。取得できない OS では 0 です
+	MaxRSS int64 `json:"maxRSS"`
+}
+
+// killDelay は SIGTERM を送ってから SIGKILL を送るまでの時間です
+var killDelay = 3 * time.Second
+
+// supervise は cmd を独立したプロセスグループで実行し、終了するまで監視します。
+// ラッパーが受け取った SIGINT と SIGTERM はツールのプロセスグループに転送し、
+// Limits.Timeout を過ぎた場合は SIGTERM を、それでも終了しなければ SIGKILL を送ります。
+// 終了したツールのプロセスの状態と、終了させた理由を inv に記録します。
+func (inv *Invocation) supervise(cmd *exec.Cmd) error {
+	setProcessGroup(cmd)
+
+	// go コマンドへの Ctrl-C はラッパーにも届くため、ツールが終了するまで待ってから終了します
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	if inv.Limits.Memory > 0 {
+		if err := limitMemory(cmd, inv.Limits.Memory); err != nil {
+			return fmt.Errorf("set memory limit: %w", err)
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var timeout, kill <-chan time.Time
+	if inv.Limits.Timeout > 0 {
+		timer := time.NewTimer(inv.Limits.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		select {
+		case err := <-done:
+			inv.ProcessState = cmd.ProcessState
+			return err
+		case sig := <-sigs:
+			if inv.Killed == "" {
+				inv.Killed = msg.Sprintf(msg.ReceivedSignal, sig)
+			}
+			signalGroup(cmd.Process, sig)
+			kill = time.After(killDelay)
+		case <-timeout:
+			inv.Killed = msg.Sprintf(msg.TimedOut, inv.Limits.Timeout)
+			signalGroup(cmd.Process, syscall.SIGTERM)
+			kill = time.After(killDelay)
+		case <-kill:
+			signalGroup(cmd.Process, syscall.SIGKILL)
+		}
+	}
+}
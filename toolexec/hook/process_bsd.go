@@ -0,0 +1,21 @@
+//go:build unix && !linux
+
+package hook
+
+import (
+	"os/exec"
+	"syscall"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+func setPdeathsig(attr *syscall.SysProcAttr) {}
+
+// maxRSSBytes は ru_maxrss をバイトにします。macOS ではバイト単位です
+func maxRSSBytes(maxrss int64) int64 {
+	return maxrss
+}
+
+func limitMemory(cmd *exec.Cmd, limit uint64) error {
+	return msg.Errorf(msg.MemoryLimitUnsupported)
+}
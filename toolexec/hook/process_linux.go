@@ -0,0 +1,105 @@
+package hook
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+// setPdeathsig はラッパーが SIGKILL で終了した場合もツールを残さないようにします
+func setPdeathsig(attr *syscall.SysProcAttr) {
+	attr.Pdeathsig = syscall.SIGKILL
+}
+
+// maxRSSBytes は Linux ではキロバイト単位の ru_maxrss をバイトにします
+func maxRSSBytes(maxrss int64) int64 {
+	return maxrss * 1024
+}
+
+// memoryLimitEnv はツールを起動する補助プロセスとしてラッパーを実行するときに、RLIMIT_AS の値を渡す環境変数です
+const memoryLimitEnv = "TOOLEXEC_MEMORY_LIMIT"
+
+func init() {
+	if limit, ok := syscall.Getenv(memoryLimitEnv); ok {
+		execWithMemoryLimit(limit, os.Args[1:])
+	}
+}
+
+// limitMemory は cmd をラッパー自身を補助プロセスとして経由して起動するように書き換えます。
+// 補助プロセスは RLIMIT_AS を設定してからツールを exec するため、上限はツールの起動時から有効で、
+// ツールが起動する子プロセスにも引き継がれます。ラッパー自身の上限は変えません。
+func limitMemory(cmd *exec.Cmd, limit uint64) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env, memoryLimitEnv+"="+strconv.FormatUint(limit, 10))
+	cmd.Args = append([]string{exe, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = exe
+	return nil
+}
+
+// execWithMemoryLimit は RLIMIT_AS を limit にしてから args のツールを exec します。戻りません。
+// 上限を下げた後にメモリを確保しないように、exec の引数は先に作ります。
+func execWithMemoryLimit(limit string, args []string) {
+	fail := func(err error) {
+		fmt.Fprintf(os.Stderr, "[TOOLEXEC] %s\n", msg.Sprintf(msg.MemoryLimitFailed, err))
+		os.Exit(1)
+	}
+	n, err := strconv.ParseUint(limit, 10, 64)
+	if err != nil {
+		fail(err)
+	}
+	if len(args) == 0 {
+		fail(msg.Errorf(msg.NoToolToRun))
+	}
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, memoryLimitEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	path, err := syscall.BytePtrFromString(args[0])
+	if err != nil {
+		fail(err)
+	}
+	argv, err := syscall.SlicePtrFromStrings(args)
+	if err != nil {
+		fail(err)
+	}
+	envv, err := syscall.SlicePtrFromStrings(env)
+	if err != nil {
+		fail(err)
+	}
+
+	var old syscall.Rlimit
+	if err := prlimit(0, syscall.RLIMIT_AS, nil, &old); err != nil {
+		fail(err)
+	}
+	lim := syscall.Rlimit{Cur: min(n, old.Max), Max: old.Max}
+	if err := prlimit(0, syscall.RLIMIT_AS, &lim, nil); err != nil {
+		fail(err)
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_EXECVE,
+		uintptr(unsafe.Pointer(path)), uintptr(unsafe.Pointer(&argv[0])), uintptr(unsafe.Pointer(&envv[0])))
+	fail(errno)
+}
+
+func prlimit(pid, resource int, newLimit, old *syscall.Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource),
+		uintptr(unsafe.Pointer(newLimit)), uintptr(unsafe.Pointer(old)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
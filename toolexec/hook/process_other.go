@@ -0,0 +1,26 @@
+//go:build !unix
+
+package hook
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalGroup はシグナルを送れない OS ではプロセスを終了させます
+func signalGroup(p *os.Process, sig os.Signal) {
+	p.Kill()
+}
+
+// ResourceUsage は終了したプロセスの資源の使用量を返します
+func ResourceUsage(ps *os.ProcessState) Usage {
+	return Usage{UserTime: ps.UserTime(), SystemTime: ps.SystemTime()}
+}
+
+func limitMemory(cmd *exec.Cmd, limit uint64) error {
+	return msg.Errorf(msg.MemoryLimitUnsupported)
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package hook
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	setPdeathsig(cmd.SysProcAttr)
+}
+
+// signalGroup はプロセスグループ全体にシグナルを送ります
+func signalGroup(p *os.Process, sig os.Signal) {
+	if s, ok := sig.(syscall.Signal); ok {
+		syscall.Kill(-p.Pid, s)
+		return
+	}
+	p.Signal(sig)
+}
+
+// ResourceUsage は終了したプロセスの資源の使用量を返します
+func ResourceUsage(ps *os.ProcessState) Usage {
+	u := Usage{UserTime: ps.UserTime(), SystemTime: ps.SystemTime()}
+	if ru, ok := ps.SysUsage().(*syscall.Rusage); ok {
+		u.MaxRSS = maxRSSBytes(int64(ru.Maxrss))
+	}
+	return u
+}
@@ -0,0 +1,153 @@
+// Package importpolicy はパッケージごとに禁止したインポートをビルド時に検出します。
+//
+// 設定例:
+//
+//	{
+//	  "importPolicy": {
+//	    "rules": [
+//	      {"packages": "example.com/app/domain/...", "deny": ["unsafe", "reflect"]}
+//	    ]
+//	  }
+//	}
+package importpolicy
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+// Rule は packages に一致するパッケージで deny に一致するインポートを禁止します
+type Rule struct {
+	Packages string   `json:"packages"`
+	Deny     []string `json:"deny"`
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%q (deny: %s)", r.Packages, strings.Join(r.Deny, ", "))
+}
+
+// Policy はインポートの禁止ルールの一覧です
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Import はパッケージがインポートしているパッケージです
+type Import struct {
+	Path string
+	// Pos はソース上の位置です。importcfg からしか分からない場合は空になります
+	Pos string
+}
+
+// Violation はルールに違反したインポートです
+type Violation struct {
+	Import Import
+	Rule   Rule
+}
+
+func (v Violation) String() string {
+	pos := v.Import.Pos
+	if pos == "" {
+		pos = "importcfg"
+	}
+	return msg.Sprintf(msg.ImportDenied, pos, v.Import.Path, v.Rule)
+}
+
+// Check は importPath のパッケージが imports をインポートしてよいかを検査します
+func (p *Policy) Check(importPath string, imports []Import) []Violation {
+	var violations []Violation
+	for _, rule := range p.Rules {
+		if !hook.Match(rule.Packages, importPath) {
+			continue
+		}
+		for _, imp := range imports {
+			if hook.MatchAny(rule.Deny, imp.Path) {
+				violations = append(violations, Violation{Import: imp, Rule: rule})
+			}
+		}
+	}
+	return violations
+}
+
+// Hook は compile の前にインポートを検査し、違反があればビルドを失敗させます
+func Hook(p *Policy) hook.Hook {
+	return hook.Hook{
+		Name: "importpolicy",
+		Before: func(inv *hook.Invocation) error {
+			if inv.Tool != "compile" || len(p.Rules) == 0 {
+				return nil
+			}
+
+			imports, err := Imports(inv)
+			if err != nil {
+				return err
+			}
+
+			// go test のテストの変種 "pkg [pkg.test]" もテスト対象のパッケージのルールで確かめます
+			violations := p.Check(inv.Package(), imports)
+			if len(violations) == 0 {
+				return nil
+			}
+
+			var b strings.Builder
+			msg.Fprintf(&b, msg.ImportPolicyViolation, inv.ImportPath)
+			for _, v := range violations {
+				fmt.Fprintf(&b, "\n\t%s", v)
+			}
+			return fmt.Errorf("%s", b.String())
+		},
+	}
+}
+
+// Imports は compile に渡された importcfg とソースファイルからインポートの一覧を作ります。
+//
+// importcfg には依存パッケージのアーカイブしか書かれていないため、
+// アーカイブを持たない unsafe などはソースファイルのインポート宣言から補います。
+func Imports(inv *hook.Invocation) ([]Import, error) {
+	cfg, err := inv.ImportCfg()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var imports []Import
+
+	fset := token.NewFileSet()
+	for _, file := range inv.GoFiles() {
+		f, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range f.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			path = cfg.Resolve(path)
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			imports = append(imports, Import{Path: path, Pos: fset.Position(spec.Pos()).String()})
+		}
+	}
+
+	var rest []string
+	for path := range cfg.PackageFile {
+		if !seen[path] {
+			rest = append(rest, path)
+		}
+	}
+	sort.Strings(rest)
+	for _, path := range rest {
+		imports = append(imports, Import{Path: path})
+	}
+
+	return imports, nil
+}
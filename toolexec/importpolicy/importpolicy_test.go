@@ -0,0 +1,96 @@
+package importpolicy_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+)
+
+const policy = `{
+  "importPolicy": {
+    "rules": [
+      {"packages": "example.com/app/domain/...", "deny": ["unsafe", "reflect"]}
+    ]
+  }
+}`
+
+func TestImportPolicy(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	env := []string{"TOOLEXEC_CONFIG=" + buildtest.WriteConfig(t, policy)}
+
+	t.Run("violate", func(t *testing.T) {
+		dir := buildtest.WriteModule(t, map[string]string{
+			"domain/user/user.go": `package user
+
+import "unsafe"
+
+func Size(n int) uintptr { return unsafe.Sizeof(n) }
+`,
+		})
+
+		out, err := buildtest.GoBuild(t, dir, wrapper, env, "./...")
+		if err == nil {
+			t.Fatalf("go build succeeded; want import policy violation\n%s", out)
+		}
+		for _, want := range []string{
+			"import policy violation in package example.com/app/domain/user",
+			`user.go:3:8: import "unsafe" denied by rule "example.com/app/domain/..." (deny: unsafe, reflect)`,
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("output does not contain %q\n%s", want, out)
+			}
+		}
+	})
+
+	t.Run("satisfy", func(t *testing.T) {
+		dir := buildtest.WriteModule(t, map[string]string{
+			"domain/user/user.go": `package user
+
+func Name(id int) string { return "user" }
+`,
+			// ルールの対象外のパッケージでは unsafe を使えます
+			"infra/mem/mem.go": `package mem
+
+import "unsafe"
+
+func Size(n int) uintptr { return unsafe.Sizeof(n) }
+`,
+		})
+
+		if out, err := buildtest.GoBuild(t, dir, wrapper, env, "./..."); err != nil {
+			t.Fatalf("go build failed: %v\n%s", err, out)
+		}
+	})
+
+	t.Run("test", func(t *testing.T) {
+		env := []string{"TOOLEXEC_CONFIG=" + buildtest.WriteConfig(t, `{
+  "importPolicy": {"rules": [{"packages": "example.com/app/domain/user", "deny": ["reflect"]}]}
+}`)}
+		dir := buildtest.WriteModule(t, map[string]string{
+			"domain/user/user.go": `package user
+
+func Name(id int) string { return "user" }
+`,
+			"domain/user/user_test.go": `package user
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestName(t *testing.T) {
+	if reflect.TypeOf(Name(1)).Kind() != reflect.String {
+		t.Fail()
+	}
+}
+`,
+		})
+
+		// go test ではテストの変種 "example.com/app/domain/user [example.com/app/domain/user.test]" がコンパイルされます
+		out, err := buildtest.GoTest(t, dir, wrapper, env, "./...")
+		if err == nil || !strings.Contains(out, `import "reflect" denied by rule "example.com/app/domain/user"`) {
+			t.Errorf("go test did not fail with the import policy violation: %v\n%s", err, out)
+		}
+	})
+}
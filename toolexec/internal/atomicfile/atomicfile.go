@@ -0,0 +1,41 @@
+// Package atomicfile は並行して実行される他のツールが読み込むファイルを、書きかけの内容を見せずに書き込みます。
+package atomicfile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile は path と同じディレクトリの一時ファイルに書き込んでから path に名前を変えます。
+// path を読み込む他のプロセスは、置き換える前か後のどちらかの内容だけを読みます。
+func WriteFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		// CreateTemp は 0600 で作るため、os.WriteFile と同じ権限にします
+		err = os.Chmod(f.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// WriteJSON は v を字下げした JSON にして WriteFile で書き込みます
+func WriteJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFile(path, append(data, '\n'))
+}
@@ -0,0 +1,97 @@
+// Package buildtest は toolexec のラッパーを実際の go build で確かめるテスト用の補助関数です。
+package buildtest
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// WrapperPackage はテストでビルドするラッパーのパッケージです
+const WrapperPackage = "github.com/newmo-oss/gocon25-workshop/toolexec/cmd/wrapper"
+
+// BuildWrapper はラッパーをテスト用の一時ディレクトリにビルドしてそのパスを返します
+func BuildWrapper(t testing.TB) string {
+	t.Helper()
+	return Build(t, WrapperPackage)
+}
+
+// Build は pkg をテスト用の一時ディレクトリにビルドしてそのパスを返します
+func Build(t testing.TB, pkg string) string {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("skipping build test in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+
+	bin := filepath.Join(t.TempDir(), filepath.Base(pkg))
+	out, err := exec.Command("go", "build", "-o", bin, pkg).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go build %s: %v\n%s", pkg, err, out)
+	}
+	return bin
+}
+
+// WriteModule は files をテスト用の一時ディレクトリに書き出したモジュールを作成します。
+// files に go.mod がなければ example.com/app モジュールとして作成します。
+func WriteModule(t testing.TB, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	if _, ok := files["go.mod"]; !ok {
+		files["go.mod"] = "module example.com/app\n\ngo 1.25\n"
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// WriteConfig はラッパーの設定ファイルを書き出してそのパスを返します
+func WriteConfig(t testing.TB, config string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "toolexec.json")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Env はラッパーを実行するときの環境変数です。
+// テストはフックのメッセージを英語で確かめるため、ロケールを en_US.UTF-8 にした上で env を追加します。
+func Env(env ...string) []string {
+	return append(append(os.Environ(), "LC_ALL=en_US.UTF-8"), env...)
+}
+
+// GoBuild は dir で go build -toolexec=wrapper を実行し、結合した出力を返します
+func GoBuild(t testing.TB, dir, wrapper string, env []string, args ...string) (string, error) {
+	t.Helper()
+
+	cmd := exec.Command("go", append([]string{"build", "-toolexec=" + wrapper}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = Env(env...)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// GoTest は dir で go test -toolexec=wrapper を実行し、結合した出力を返します
+func GoTest(t testing.TB, dir, wrapper string, env []string, args ...string) (string, error) {
+	t.Helper()
+
+	cmd := exec.Command("go", append([]string{"test", "-toolexec=" + wrapper}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = Env(env...)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
@@ -0,0 +1,255 @@
+// Package linkdeps は link に渡される情報から、実際にリンクされるパッケージとモジュールを求めます。
+//
+// link の -importcfg にはリンクされるすべてのパッケージのアーカイブと、
+// go コマンドが作ったモジュール情報（modinfo）が書かれています。
+// go.mod ではなくこの一覧から求めるため、ビルドタグで除外された依存は含まれません。
+package linkdeps
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+)
+
+// Module はリンクされたパッケージを提供するモジュールです
+type Module struct {
+	Path    string
+	Version string
+	// Sum は go.sum 形式のハッシュ（h1:...）です
+	Sum string
+	// Replace は replace ディレクティブで置き換えられた場合の置き換え先です
+	Replace *Module
+	// Dir はモジュールキャッシュまたはローカルの置き換え先のディレクトリです。見つからない場合は空です
+	Dir string
+	// Packages はこのモジュールからリンクされたパッケージです
+	Packages []string
+}
+
+// Result はリンクされたパッケージの一覧です
+type Result struct {
+	GoVersion string
+	// Main はメインモジュールです。モジュール情報がない場合は Path が空になります
+	Main Module
+	// Std はリンクされた標準ライブラリのパッケージです
+	Std []string
+	// Modules はメインモジュール以外の依存モジュールです
+	Modules []Module
+}
+
+// Load は link の呼び出しからリンクされるパッケージとモジュールを求めます
+func Load(inv *hook.Invocation) (*Result, error) {
+	cfg, err := inv.ImportCfg()
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := ParseModInfo(cfg.ModInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Result{GoVersion: info.GoVersion}
+	if r.GoVersion == "" {
+		// go コマンドが渡す modinfo には Go のバージョンが含まれず、link が追加します
+		if r.GoVersion, err = inv.GoVersion(); err != nil {
+			return nil, err
+		}
+	}
+	var mods []*Module
+	if info.Main.Path != "" {
+		r.Main = Module{Path: info.Main.Path, Version: info.Main.Version, Sum: info.Main.Sum}
+		mods = append(mods, &r.Main)
+	}
+	for _, dep := range info.Deps {
+		m := &Module{Path: dep.Path, Version: dep.Version, Sum: dep.Sum}
+		if dep.Replace != nil {
+			m.Replace = &Module{Path: dep.Replace.Path, Version: dep.Replace.Version, Sum: dep.Replace.Sum}
+			// ローカルディレクトリへの置き換えのバージョンは (devel) と記録されます
+			if m.Replace.Version == "(devel)" {
+				m.Replace.Version = ""
+			}
+		}
+		mods = append(mods, m)
+	}
+	// 長いモジュールパスを優先して一致させます
+	byLen := append([]*Module(nil), mods...)
+	sort.SliceStable(byLen, func(i, j int) bool { return len(byLen[i].Path) > len(byLen[j].Path) })
+
+	pkgs := make([]string, 0, len(cfg.PackageFile))
+	for pkg := range cfg.PackageFile {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	for _, pkg := range pkgs {
+		if m := lookup(byLen, pkg); m != nil {
+			m.Packages = append(m.Packages, pkg)
+			continue
+		}
+		if IsStd(pkg) {
+			r.Std = append(r.Std, pkg)
+		}
+	}
+
+	mainDir := mainModuleDir()
+	if r.Main.Path != "" {
+		r.Main.Dir = mainDir
+	}
+
+	sums := readGoSum(mainDir)
+	cache := ModCache()
+	for _, m := range mods {
+		// ビルドタグで除外されたなど、パッケージがリンクされていないモジュールは含めません
+		if m == &r.Main || len(m.Packages) == 0 {
+			continue
+		}
+		fill(m, mainDir, sums, cache)
+		r.Modules = append(r.Modules, *m)
+	}
+
+	return r, nil
+}
+
+func lookup(mods []*Module, pkg string) *Module {
+	for _, m := range mods {
+		if pkg == m.Path || strings.HasPrefix(pkg, m.Path+"/") {
+			return m
+		}
+	}
+	return nil
+}
+
+// fill はモジュール情報にハッシュがない場合に go.sum とモジュールキャッシュから補い、
+// モジュールキャッシュ上のディレクトリを求めます
+func fill(m *Module, mainDir string, sums map[string]string, cache string) {
+	target := m
+	if m.Replace != nil {
+		target = m.Replace
+	}
+
+	if target.Version == "" {
+		// ローカルディレクトリへの置き換えです
+		dir := target.Path
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(mainDir, dir)
+		}
+		m.Dir = dir
+		return
+	}
+
+	if target.Sum == "" {
+		target.Sum = sums[target.Path+" "+target.Version]
+	}
+	if target.Sum == "" && cache != "" {
+		if data, err := os.ReadFile(filepath.Join(cache, "cache", "download", EscapePath(target.Path), "@v", EscapePath(target.Version)+".ziphash")); err == nil {
+			target.Sum = strings.TrimSpace(string(data))
+		}
+	}
+	if m.Sum == "" {
+		m.Sum = target.Sum
+	}
+
+	if cache != "" {
+		dir := filepath.Join(cache, EscapePath(target.Path)+"@"+EscapePath(target.Version))
+		if _, err := os.Stat(dir); err == nil {
+			m.Dir = dir
+		}
+	}
+}
+
+// ParseModInfo は importcfg の modinfo を解釈します。
+// modinfo はランタイムが見つけられるように前後に16バイトの目印が付いた debug.BuildInfo の文字列です。
+func ParseModInfo(modinfo string) (*debug.BuildInfo, error) {
+	if modinfo == "" {
+		return &debug.BuildInfo{}, nil
+	}
+	if len(modinfo) < 32 {
+		return nil, fmt.Errorf("invalid modinfo")
+	}
+	return debug.ParseBuildInfo(modinfo[16 : len(modinfo)-16])
+}
+
+// IsStd は標準ライブラリのパッケージかどうかを返します
+func IsStd(pkg string) bool {
+	first, _, _ := strings.Cut(pkg, "/")
+	return !strings.Contains(first, ".") && pkg != "main" && pkg != "command-line-arguments"
+}
+
+// ModCache はモジュールキャッシュのディレクトリを返します
+func ModCache() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		gopath = filepath.Join(home, "go")
+	}
+	return filepath.Join(filepath.SplitList(gopath)[0], "pkg", "mod")
+}
+
+// EscapePath はモジュールキャッシュで使われる形式にパスをエスケープします。
+// 大文字を "!" と小文字の組み合わせにします（例: github.com/BurntSushi -> github.com/!burnt!sushi）。
+func EscapePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// mainModuleDir は作業ディレクトリから go.mod のあるディレクトリを探します。
+// link は go コマンドを実行したディレクトリで実行されます。
+func mainModuleDir() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// readGoSum は go.sum からモジュールのハッシュを読み込みます。キーは "path version" です
+func readGoSum(dir string) map[string]string {
+	sums := make(map[string]string)
+	if dir == "" {
+		return sums
+	}
+	f, err := os.Open(filepath.Join(dir, "go.sum"))
+	if err != nil {
+		return sums
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 3 || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		sums[fields[0]+" "+fields[1]] = fields[2]
+	}
+	return sums
+}
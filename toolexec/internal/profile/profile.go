@@ -0,0 +1,250 @@
+// Package profile は runtime/pprof の CPU プロファイルから必要な情報だけを読み出します。
+//
+// プロファイルは gzip で圧縮された profile.proto 形式の Protocol Buffers です。
+// サンプルとその呼び出し位置だけが必要なため、依存を増やさずに必要なフィールドだけを解析します。
+package profile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Profile はサンプルの一覧です
+type Profile struct {
+	// SampleType は値の種類です（例: "samples/count", "cpu/nanoseconds"）
+	SampleType []string
+	Samples    []Sample
+}
+
+// Sample はスタック1つ分のサンプルです
+type Sample struct {
+	// Value は最後の値の種類（CPU プロファイルでは cpu/nanoseconds）の値です
+	Value int64
+	// Stack は葉から順に並んだフレームです。インライン展開された関数も1フレームとして含みます
+	Stack []Frame
+}
+
+// Frame は関数と行です
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+// Parse はプロファイルを読み込みます
+func Parse(r io.Reader) (*Profile, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data)
+}
+
+type rawSample struct {
+	locations []uint64
+	values    []int64
+}
+
+type rawLine struct {
+	function uint64
+	line     int64
+}
+
+type rawFunction struct {
+	name, filename int64
+}
+
+func parse(data []byte) (*Profile, error) {
+	var (
+		sampleTypes [][2]int64
+		samples     []rawSample
+		locations   = make(map[uint64][]rawLine)
+		functions   = make(map[uint64]rawFunction)
+		stringTable []string
+	)
+
+	err := fields(data, func(num, wire int, v uint64, b []byte) error {
+		switch num {
+		case 1: // sample_type
+			var t [2]int64 // type, unit
+			err := fields(b, func(num, wire int, v uint64, b []byte) error {
+				if num == 1 || num == 2 {
+					t[num-1] = int64(v)
+				}
+				return nil
+			})
+			sampleTypes = append(sampleTypes, t)
+			return err
+		case 2: // sample
+			var s rawSample
+			err := fields(b, func(num, wire int, v uint64, b []byte) error {
+				switch num {
+				case 1:
+					s.locations = appendVarints(s.locations, wire, v, b)
+				case 2:
+					for _, x := range appendVarints(nil, wire, v, b) {
+						s.values = append(s.values, int64(x))
+					}
+				}
+				return nil
+			})
+			samples = append(samples, s)
+			return err
+		case 4: // location
+			var id uint64
+			var lines []rawLine
+			err := fields(b, func(num, wire int, v uint64, b []byte) error {
+				switch num {
+				case 1:
+					id = v
+				case 4:
+					var l rawLine
+					err := fields(b, func(num, wire int, v uint64, b []byte) error {
+						switch num {
+						case 1:
+							l.function = v
+						case 2:
+							l.line = int64(v)
+						}
+						return nil
+					})
+					lines = append(lines, l)
+					return err
+				}
+				return nil
+			})
+			locations[id] = lines
+			return err
+		case 5: // function
+			var id uint64
+			var f rawFunction
+			err := fields(b, func(num, wire int, v uint64, b []byte) error {
+				switch num {
+				case 1:
+					id = v
+				case 2:
+					f.name = int64(v)
+				case 4:
+					f.filename = int64(v)
+				}
+				return nil
+			})
+			functions[id] = f
+			return err
+		case 6: // string_table
+			stringTable = append(stringTable, string(b))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("parse profile: %w", err)
+	}
+
+	str := func(i int64) string {
+		if i < 0 || int(i) >= len(stringTable) {
+			return ""
+		}
+		return stringTable[i]
+	}
+
+	p := &Profile{}
+	for _, t := range sampleTypes {
+		p.SampleType = append(p.SampleType, str(t[0])+"/"+str(t[1]))
+	}
+	for _, s := range samples {
+		if len(s.values) == 0 {
+			continue
+		}
+		sample := Sample{Value: s.values[len(s.values)-1]}
+		for _, loc := range s.locations {
+			for _, l := range locations[loc] {
+				f := functions[l.function]
+				sample.Stack = append(sample.Stack, Frame{Function: str(f.name), File: str(f.filename), Line: int(l.line)})
+			}
+		}
+		p.Samples = append(p.Samples, sample)
+	}
+	return p, nil
+}
+
+// fields はメッセージのフィールドを順番に fn に渡します。
+// varint のフィールドは v に、長さ付きのフィールドは b に値が入ります。
+func fields(data []byte, fn func(num, wire int, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("invalid field key")
+		}
+		data = data[n:]
+
+		num, wire := int(key>>3), int(key&7)
+		var (
+			v uint64
+			b []byte
+		)
+		switch wire {
+		case 0: // varint
+			v, n = binary.Uvarint(data)
+			if n <= 0 {
+				return errors.New("invalid varint")
+			}
+			data = data[n:]
+		case 1: // fixed64
+			if len(data) < 8 {
+				return io.ErrUnexpectedEOF
+			}
+			v, data = binary.LittleEndian.Uint64(data), data[8:]
+		case 2: // length-delimited
+			l, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < l {
+				return io.ErrUnexpectedEOF
+			}
+			b, data = data[n:n+int(l)], data[n+int(l):]
+		case 5: // fixed32
+			if len(data) < 4 {
+				return io.ErrUnexpectedEOF
+			}
+			v, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d", wire)
+		}
+
+		if err := fn(num, wire, v, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendVarints は packed と unpacked のどちらの repeated フィールドも読み込みます
+func appendVarints(dst []uint64, wire int, v uint64, b []byte) []uint64 {
+	if wire == 0 {
+		return append(dst, v)
+	}
+	r := bytes.NewReader(b)
+	for r.Len() > 0 {
+		x, err := binary.ReadUvarint(r)
+		if err != nil {
+			break
+		}
+		dst = append(dst, x)
+	}
+	return dst
+}
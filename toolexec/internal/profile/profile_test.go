@@ -0,0 +1,188 @@
+package profile_test
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/profile"
+)
+
+// burn は mix を hot にインライン展開させ、1 つの位置に複数の行を持つプロファイルを作ります
+const burn = `package burn
+
+import (
+	"testing"
+	"time"
+)
+
+var sink uint64
+
+func mix(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	return x ^ x>>33
+}
+
+//go:noinline
+func hot(n int) uint64 {
+	var s uint64
+	for i := range n {
+		s += mix(uint64(i))
+	}
+	return s
+}
+
+//go:noinline
+func cold(n int) uint64 {
+	var s uint64
+	for i := range n {
+		s += uint64(i) * uint64(i)
+	}
+	return s
+}
+
+func TestBurn(t *testing.T) {
+	for end := time.Now().Add(500 * time.Millisecond); time.Now().Before(end); {
+		sink += hot(1 << 20)
+		sink += cold(1 << 18)
+	}
+}
+`
+
+func TestParse(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping CPU profiling in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"go.mod":       "module example.com/burn\n",
+		"burn_test.go": burn,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command("go", "test", "-cpuprofile", "cpu.pprof", "-run", "^TestBurn$", ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go test -cpuprofile: %v\n%s", err, out)
+	}
+	path := filepath.Join(dir, "cpu.pprof")
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, err := profile.Parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"samples/count", "cpu/nanoseconds"}; !slices.Equal(p.SampleType, want) {
+		t.Errorf("SampleType = %q; want %q", p.SampleType, want)
+	}
+
+	got := make(map[string]int64)
+	flat := make(map[string]int64)
+	inlined := false
+	for _, s := range p.Samples {
+		var frames []string
+		for i, fr := range s.Stack {
+			frames = append(frames, fmt.Sprintf("%s %s:%d", fr.Function, fr.File, fr.Line))
+			if fr.Function == "example.com/burn.mix" && i+1 < len(s.Stack) && s.Stack[i+1].Function == "example.com/burn.hot" {
+				inlined = true
+			}
+		}
+		got[strings.Join(frames, "\n")] += s.Value
+		if len(s.Stack) > 0 {
+			flat[s.Stack[0].Function] += s.Value
+		}
+	}
+
+	// go tool pprof -raw で読んだサンプルと、スタックごとの値がすべて一致することを確かめます
+	if want := raw(t, path); !maps.Equal(got, want) {
+		t.Errorf("samples do not match go tool pprof -raw\ngot:  %v\nwant: %v", got, want)
+	}
+	if flat["example.com/burn.mix"]+flat["example.com/burn.hot"] == 0 || flat["example.com/burn.cold"] == 0 {
+		t.Errorf("flat values per function = %v; want samples in mix or hot and in cold", flat)
+	}
+	if !inlined {
+		t.Error("no sample has mix inlined into hot")
+	}
+}
+
+// raw は go tool pprof -raw の出力から、スタックごとの cpu/nanoseconds の合計を返します
+func raw(t *testing.T, path string) map[string]int64 {
+	t.Helper()
+	out, err := exec.Command("go", "tool", "pprof", "-raw", path).Output()
+	if err != nil {
+		t.Fatalf("go tool pprof -raw: %v", err)
+	}
+
+	type sample struct {
+		value     int64
+		locations []string
+	}
+	var (
+		samples   []sample
+		locations = make(map[string][]string)
+		section   string
+		current   string
+	)
+	sc := bufio.NewScanner(strings.NewReader(string(out)))
+	for sc.Scan() {
+		line := sc.Text()
+		switch line {
+		case "Samples:", "Locations", "Mappings":
+			section = line
+			continue
+		}
+		fields := strings.Fields(line)
+		switch section {
+		case "Samples:":
+			// "          5   50000000: 1 2 3 "
+			if len(fields) < 3 || !strings.HasSuffix(fields[1], ":") {
+				continue
+			}
+			v, err := strconv.ParseInt(strings.TrimSuffix(fields[1], ":"), 10, 64)
+			if err != nil {
+				t.Fatalf("bad sample line %q", line)
+			}
+			samples = append(samples, sample{v, fields[2:]})
+		case "Locations":
+			// "     1: 0x543369 M=1 example.com/burn.mix /tmp/burn_test.go:11:0 s=10"
+			// "             example.com/burn.hot /tmp/burn_test.go:20:0 s=17"
+			if len(fields) > 0 && strings.HasSuffix(fields[0], ":") {
+				current = strings.TrimSuffix(fields[0], ":")
+				fields = fields[3:]
+			}
+			if len(fields) < 2 {
+				continue
+			}
+			pos := fields[1][:strings.LastIndex(fields[1], ":")] // 列を取り除きます
+			locations[current] = append(locations[current], fields[0]+" "+pos)
+		}
+	}
+
+	m := make(map[string]int64)
+	for _, s := range samples {
+		var frames []string
+		for _, id := range s.locations {
+			frames = append(frames, locations[id]...)
+		}
+		m[strings.Join(frames, "\n")] += s.value
+	}
+	return m
+}
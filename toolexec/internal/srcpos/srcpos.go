@@ -0,0 +1,116 @@
+// Package srcpos はコンパイラの診断の位置から関数やループを求めます。
+package srcpos
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+)
+
+// Index はソースファイルの位置から関数とループを求めるための索引です
+type Index struct {
+	fset  *token.FileSet
+	files map[string]*ast.File
+}
+
+// NewIndex は files を解析して索引を作ります。解析できないファイルは無視します
+func NewIndex(files []string) *Index {
+	idx := &Index{fset: token.NewFileSet(), files: make(map[string]*ast.File)}
+	for _, file := range files {
+		f, err := parser.ParseFile(idx.fset, file, nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		idx.files[filepath.Clean(file)] = f
+	}
+	return idx
+}
+
+// Func は位置を含む関数の名前を返します。関数の外側の場合は空文字列を返します
+func (idx *Index) Func(file string, line int) string {
+	f := idx.files[filepath.Clean(file)]
+	if f == nil {
+		return ""
+	}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		if idx.fset.Position(fn.Pos()).Line <= line && line <= idx.fset.Position(fn.End()).Line {
+			return FuncName(fn)
+		}
+	}
+	return ""
+}
+
+// Loop は位置を含む最も内側の for 文の位置を "file.go:line:col" の形式で返します。
+// ループの外側の場合は空文字列を返します。
+func (idx *Index) Loop(file string, line, col int) string {
+	f := idx.files[filepath.Clean(file)]
+	if f == nil {
+		return ""
+	}
+
+	var loop ast.Node
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		start, end := idx.fset.Position(n.Pos()), idx.fset.Position(n.End())
+		if !contains(start, end, line, col) {
+			return false
+		}
+		switch n.(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			loop = n
+		}
+		return true
+	})
+	if loop == nil {
+		return ""
+	}
+
+	pos := idx.fset.Position(loop.Pos())
+	return fmt.Sprintf("%s:%d:%d", filepath.Base(pos.Filename), pos.Line, pos.Column)
+}
+
+func contains(start, end token.Position, line, col int) bool {
+	if line < start.Line || line == start.Line && col < start.Column {
+		return false
+	}
+	if line > end.Line || line == end.Line && col > end.Column {
+		return false
+	}
+	return true
+}
+
+// FuncName は "F", "T.M", "(*T).M" の形式で関数名を返します
+func FuncName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+
+	typ := fn.Recv.List[0].Type
+	star := false
+	if s, ok := typ.(*ast.StarExpr); ok {
+		star, typ = true, s.X
+	}
+	switch t := typ.(type) {
+	case *ast.IndexExpr:
+		typ = t.X
+	case *ast.IndexListExpr:
+		typ = t.X
+	}
+
+	var recv string
+	if id, ok := typ.(*ast.Ident); ok {
+		recv = id.Name
+	}
+	if star {
+		return "(*" + recv + ")." + fn.Name.Name
+	}
+	return recv + "." + fn.Name.Name
+}
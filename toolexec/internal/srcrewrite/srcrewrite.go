@@ -0,0 +1,203 @@
+// Package srcrewrite は compile に渡されるソースを書き換え、
+// 書き換えたコードが呼び出すパッケージをビルドに追加するための共通処理です。
+//
+// 書き換えたファイルは元のファイルと行番号が変わらないように既存の行の中にコードを差し込み、
+// 先頭に元のファイルを指す //line ディレクティブを付けます。
+// 差し込んだコードが呼び出すパッケージは go コマンドの依存関係に含まれないため、
+// 一度だけコンパイルしてキャッシュし、compile と link の importcfg に追加します。
+// パッケージはビルドと同じ計測（-race, -msan, -asan）とコード生成（-shared, -dynlink, -linkshared）のフラグでコンパイルします。
+package srcrewrite
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+)
+
+// Insertion はソースのバイトオフセット Offset に差し込む文字列です
+type Insertion struct {
+	Offset int
+	Text   string
+}
+
+// Apply は src に inserts を差し込み、先頭に filename を指す //line ディレクティブを付けます。
+// Text に改行を含めると以降の行番号がずれます。
+func Apply(filename string, src []byte, inserts []Insertion) []byte {
+	inserts = append([]Insertion(nil), inserts...)
+	sort.SliceStable(inserts, func(i, j int) bool { return inserts[i].Offset < inserts[j].Offset })
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "//line %s:1:1\n", filename)
+	last := 0
+	for _, ins := range inserts {
+		b.Write(src[last:ins.Offset])
+		b.WriteString(ins.Text)
+		last = ins.Offset
+	}
+	b.Write(src[last:])
+	return b.Bytes()
+}
+
+// Files は compile の .go ファイルを rewrite で書き換えて dir に書き出し、引数を差し替えます。
+// rewrite には元のファイルの絶対パスが渡され、書き換えない場合は ok に false を返します。
+// cgo などが $WORK に生成したファイルは対象にしません。
+func Files(inv *hook.Invocation, dir string, rewrite func(filename string, src []byte) (out []byte, ok bool, err error)) (bool, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return false, err
+	}
+	output, _ := inv.Flag("o")
+	workDir := filepath.Dir(output)
+
+	rewritten := false
+	for i := inv.InputIndex(); i < len(inv.Args); i++ {
+		file := inv.Args[i]
+		if filepath.Ext(file) != ".go" {
+			continue
+		}
+		abs := file
+		if !filepath.IsAbs(abs) {
+			abs = filepath.Join(cwd, file)
+		}
+		if strings.HasPrefix(abs, workDir+string(filepath.Separator)) {
+			continue
+		}
+
+		src, err := os.ReadFile(abs)
+		if err != nil {
+			return false, err
+		}
+		out, ok, err := rewrite(abs, src)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			continue
+		}
+		dst := filepath.Join(dir, filepath.Base(file))
+		if err := os.WriteFile(dst, out, 0o644); err != nil {
+			return false, err
+		}
+		inv.Args[i] = dst
+		rewritten = true
+	}
+	return rewritten, nil
+}
+
+// Package は差し込んだコードが呼び出すパッケージです。
+// link の importcfg に含まれない標準ライブラリに依存しないように、runtime 以外をインポートしてはいけません。
+type Package struct {
+	Path   string
+	Source []byte
+	// CacheDir はコンパイルしたアーカイブを保存するディレクトリです。空の場合はユーザーのキャッシュディレクトリです
+	CacheDir string
+}
+
+// Add は p をコンパイルし、inv の importcfg に追加したファイルに差し替えます。compile と link の両方で使えます
+func (p *Package) Add(inv *hook.Invocation) error {
+	archive, err := p.archive(filepath.Join(filepath.Dir(inv.ToolPath), "compile"), buildFlags(inv))
+	if err != nil {
+		return fmt.Errorf("compile %s: %w", p.Path, err)
+	}
+
+	path, ok := inv.Flag("importcfg")
+	if !ok {
+		return fmt.Errorf("%s: -importcfg not found", inv.Tool)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	data = fmt.Appendf(bytes.TrimRight(data, "\n"), "\npackagefile %s=%s\n", p.Path, archive)
+	newPath := path + "." + filepath.Base(p.Path)
+	if err := os.WriteFile(newPath, data, 0o644); err != nil {
+		return err
+	}
+	for i, arg := range inv.Args {
+		switch arg {
+		case path:
+			inv.Args[i] = newPath
+		case "-importcfg=" + path:
+			inv.Args[i] = "-importcfg=" + newPath
+		}
+	}
+	return nil
+}
+
+// buildFlags は inv に渡されたフラグのうち、アーカイブの互換性に関わる compile のフラグを返します。
+// link には -shared と -dynlink が渡されないため、go コマンドがそれらのフラグの名前を加える -installsuffix から判断します。
+func buildFlags(inv *hook.Invocation) []string {
+	var flags []string
+	for _, name := range []string{"race", "msan", "asan", "shared", "dynlink", "linkshared"} {
+		if inv.HasFlag(name) {
+			flags = append(flags, "-"+name)
+		}
+	}
+	if inv.Tool == "link" {
+		suffix, _ := inv.Flag("installsuffix")
+		for _, name := range strings.Split(suffix, "_") {
+			if (name == "shared" || name == "dynlink") && !slices.Contains(flags, "-"+name) {
+				flags = append(flags, "-"+name)
+			}
+		}
+	}
+	return flags
+}
+
+// archive はツールチェーン、フラグ、ソースごとにコンパイルしたアーカイブのパスを返します。
+// compile は環境変数 GOEXPERIMENT の実験を有効にしてコンパイルするため、GOEXPERIMENT もキーに含めます。
+func (p *Package) archive(compile string, flags []string) (string, error) {
+	version, err := exec.Command(compile, "-V=full").Output()
+	if err != nil {
+		return "", err
+	}
+	dir := p.CacheDir
+	if dir == "" {
+		if dir, err = os.UserCacheDir(); err != nil {
+			return "", err
+		}
+		dir = filepath.Join(dir, "gocon25-toolexec", "srcrewrite")
+	}
+	key := sha256.Sum256(fmt.Appendf(nil, "%s\x00%s\x00%s\x00%s\x00%s", version, os.Getenv("GOEXPERIMENT"), strings.Join(flags, " "), p.Path, p.Source))
+	archive := filepath.Join(dir, fmt.Sprintf("%s-%x.a", filepath.Base(p.Path), key[:12]))
+	if _, err := os.Stat(archive); err == nil {
+		return archive, nil
+	}
+
+	tmp, err := os.MkdirTemp("", "srcrewrite")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, filepath.Base(p.Path)+".go")
+	importcfg := filepath.Join(tmp, "importcfg")
+	if err := os.WriteFile(src, p.Source, 0o644); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(importcfg, nil, 0o644); err != nil {
+		return "", err
+	}
+	out := filepath.Join(tmp, "pkg.a")
+	args := append([]string{"-o", out, "-p", p.Path, "-trimpath", tmp + "=>" + p.Path, "-importcfg", importcfg, "-pack"}, flags...)
+	cmd := exec.Command(compile, append(args, src)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("%w\n%s", err, output)
+	}
+
+	// 並行して実行される他の compile と競合しないように、名前の変更で保存します
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(out, archive); err != nil {
+		return "", err
+	}
+	return archive, nil
+}
@@ -0,0 +1,119 @@
+package license
+
+import (
+	"regexp"
+	"strings"
+)
+
+// classifierVersion はキャッシュした判定結果を無効にするため、判定の規則を変えたら上げます
+const classifierVersion = 3
+
+// rule は SPDX ライセンスを特徴付ける語句です。正規化した本文に all のすべてを含み、none のどれも含まない場合に一致します
+type rule struct {
+	id   string
+	all  []string
+	none []string
+}
+
+// gnuLicenses は GNU のライセンスの名前と版ごとの SPDX 識別子です。
+// GNU のライセンスは本文で互いの名前に触れる（GPL-3.0 の 13 条の AGPL、末尾の LGPL、1991 年の GPL-2.0 の
+// GNU Library General Public License など）ため、語句を含むかどうかでは区別できません。
+// ライセンスの本文も、著作権表示に続く「This program is free software ...」の告知も、
+// そのライセンス自身の名前を最初に挙げるため、本文全体で最初に現れた名前とその後の最初の版で判定します。
+// 語句の前後に空白を求めるため、"gnu general public license" は LGPL や AGPL の名前に一致しません。
+var gnuLicenses = map[string]map[string]string{
+	"gnu affero general public license":  {"3": "AGPL-3.0"},
+	"gnu lesser general public license":  {"3": "LGPL-3.0", "2.1": "LGPL-2.1"},
+	"gnu library general public license": {"2": "LGPL-2.0"},
+	"gnu general public license":         {"3": "GPL-3.0", "2": "GPL-2.0"},
+}
+
+var gnuVersionRe = regexp.MustCompile(` version (3|2\.1|2) `)
+
+// secondaryRules は互換性のあるライセンスとして本文で GNU のライセンスの名前を挙げるライセンスで、GNU のライセンスより先に判定します
+var secondaryRules = []rule{
+	{id: "MPL-2.0", all: []string{"mozilla public license", "version 2.0"}},
+	{id: "EPL-2.0", all: []string{"eclipse public license", "v 2.0"}},
+}
+
+// rules は判定する順番に並べた、GNU 以外のライセンスの規則です
+var rules = []rule{
+	{id: "Apache-2.0", all: []string{"apache license", "version 2.0"}},
+	{id: "CC0-1.0", all: []string{"cc0 1.0 universal"}},
+	{id: "Unlicense", all: []string{"this is free and unencumbered software released into the public domain"}},
+	{id: "BSD-3-Clause", all: []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{id: "BSD-3-Clause", all: []string{"redistribution and use in source and binary forms", "names of its contributors may not be used"}},
+	{id: "BSD-2-Clause", all: []string{"redistribution and use in source and binary forms", "this software is provided by"}},
+	{id: "MIT", all: []string{"permission is hereby granted free of charge to any person obtaining a copy"}},
+	// ISC と 0BSD は著作権表示を求めるかどうかだけが違います
+	{id: "0BSD", all: []string{"permission to use copy modify and or distribute this software for any purpose with or without fee is hereby granted"}, none: []string{"copyright notice and this permission notice appear in all copies"}},
+	{id: "ISC", all: []string{"permission to use copy modify and or distribute this software for any purpose with or without fee is hereby granted"}},
+}
+
+var nonWordRe = regexp.MustCompile(`[^a-z0-9.]+`)
+
+// normalize は大文字と小文字、句読点、空白の違いを無視できるように本文を正規化します
+func normalize(text string) string {
+	text = nonWordRe.ReplaceAllString(strings.ToLower(text), " ")
+	// 文末のピリオドは除き、"2.0" のような番号の中のピリオドだけを残します
+	text = strings.ReplaceAll(text+" ", ". ", " ")
+	return strings.TrimSpace(text)
+}
+
+// Classify はライセンスファイルの本文から SPDX の識別子を返します。判定できない場合は空です
+func Classify(text string) string {
+	norm := " " + normalize(text) + " "
+	if id := match(norm, secondaryRules); id != "" {
+		return id
+	}
+	if id, ok := classifyGNU(norm); ok {
+		return id
+	}
+	return match(norm, rules)
+}
+
+func match(norm string, rules []rule) string {
+	for _, r := range rules {
+		if containsAll(norm, r.all) && !containsAny(norm, r.none) {
+			return r.id
+		}
+	}
+	return ""
+}
+
+// classifyGNU は最初に現れた GNU のライセンスの名前と、その後の最初の版から識別子を返します。
+// GNU のライセンスの名前を含む場合は、版を判定できなくても ok を返します
+func classifyGNU(norm string) (id string, ok bool) {
+	first, name := -1, ""
+	for n := range gnuLicenses {
+		if i := strings.Index(norm, " "+n+" "); i >= 0 && (first < 0 || i < first) {
+			first, name = i, n
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+	m := gnuVersionRe.FindStringSubmatch(norm[first+len(name)+1:])
+	if m == nil {
+		return "", true
+	}
+	return gnuLicenses[name][m[1]], true
+}
+
+func containsAll(s string, phrases []string) bool {
+	for _, p := range phrases {
+		if !strings.Contains(s, " "+p+" ") {
+			return false
+		}
+	}
+	return true
+}
+
+func containsAny(s string, phrases []string) bool {
+	for _, p := range phrases {
+		if strings.Contains(s, " "+p+" ") {
+			return true
+		}
+	}
+	return false
+}
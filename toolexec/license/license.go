@@ -0,0 +1,256 @@
+// Package license は link 時にリンクされるモジュールのライセンスを調べ、許可・拒否のポリシーと照合します。
+//
+// 設定例:
+//
+//	{
+//	  "license": {
+//	    "allow": ["MIT", "Apache-2.0", "BSD-2-Clause", "BSD-3-Clause", "ISC"],
+//	    "deny": ["GPL-2.0", "GPL-3.0", "AGPL-3.0"],
+//	    "unknown": "warn",
+//	    "ignore": ["example.com/internal/..."]
+//	  }
+//	}
+//
+// link の importcfg から求めた実際にリンクされるモジュール（internal/linkdeps）について、
+// モジュールキャッシュまたは置き換え先のディレクトリの直下にある LICENSE, COPYING などのファイルを
+// 組み込みの分類器で SPDX の識別子に判定します。
+//
+// モジュールのライセンスファイルのどれかが deny に含まれる場合、または allow を指定していてどれも allow に含まれない場合は
+// 違反としてリンクの前にビルドを失敗させます。warn を true にすると失敗させずに警告します。
+// ライセンスを判定できないモジュールは unknown（warn, fail, ignore）に従います。
+//
+// モジュールキャッシュのモジュールは内容が変わらないため、判定結果をモジュールのバージョンごとにキャッシュします。
+package license
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/linkdeps"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+// Config はライセンスのポリシーです
+type Config struct {
+	// Allow は許可する SPDX の識別子です。空の場合は deny に含まれないものをすべて許可します
+	Allow []string `json:"allow"`
+	// Deny は拒否する SPDX の識別子です
+	Deny []string `json:"deny"`
+	// Unknown はライセンスを判定できないモジュールの扱い（warn, fail, ignore）です。省略時は warn です
+	Unknown string `json:"unknown"`
+	// Warn が true の場合は違反があってもビルドを失敗させずに警告します
+	Warn bool `json:"warn"`
+	// Ignore は調べないモジュールパスのパターンです
+	Ignore []string `json:"ignore"`
+	// CacheDir は判定結果のキャッシュのディレクトリです。省略時はユーザーのキャッシュディレクトリです
+	CacheDir string `json:"cacheDir"`
+}
+
+// File はモジュールのライセンスファイル1つ分の判定結果です
+type File struct {
+	Name string `json:"name"`
+	// License は SPDX の識別子です。判定できない場合は空です
+	License string `json:"license"`
+}
+
+// cacheEntry はキャッシュに保存する判定結果です
+type cacheEntry struct {
+	ClassifierVersion int    `json:"classifierVersion"`
+	Files             []File `json:"files"`
+}
+
+// licenseFileRe はライセンスファイルの名前です（LICENSE, LICENSE.md, LICENSE-APACHE, COPYING.LESSER など）
+var licenseFileRe = regexp.MustCompile(`(?i)^(licen[cs]e|copying|unlicense)([-._].*)?$`)
+
+// Scan は dir の直下のライセンスファイルを判定します
+func Scan(dir string) ([]File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []File
+	for _, e := range entries {
+		if e.IsDir() || !licenseFileRe.MatchString(e.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Name: e.Name(), License: Classify(string(data))})
+	}
+	return files, nil
+}
+
+// Check はリンクされるモジュールをポリシーと照合し、違反と警告を返します
+func (c *Config) Check(r *linkdeps.Result) (violations, warnings []string, err error) {
+	for _, m := range r.Modules {
+		if hook.MatchAny(c.Ignore, m.Path) {
+			continue
+		}
+		name := moduleName(m)
+		if m.Dir == "" {
+			warnings, violations = c.unknown(warnings, violations, msg.Sprintf(msg.LicenseNoModuleDir, name))
+			continue
+		}
+		files, err := c.scan(m)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(files) == 0 {
+			warnings, violations = c.unknown(warnings, violations, msg.Sprintf(msg.LicenseNoFile, name))
+			continue
+		}
+
+		allowed := false
+		for _, f := range files {
+			switch {
+			case f.License == "":
+				warnings, violations = c.unknown(warnings, violations, msg.Sprintf(msg.LicenseUnrecognized, name, f.Name))
+			case contains(c.Deny, f.License):
+				violations = append(violations, msg.Sprintf(msg.LicenseDenied, name, f.License, f.Name))
+			case len(c.Allow) == 0 || contains(c.Allow, f.License):
+				allowed = true
+			}
+		}
+		if !allowed && len(c.Allow) > 0 {
+			var licenses []string
+			for _, f := range files {
+				if f.License != "" && !contains(c.Deny, f.License) {
+					licenses = append(licenses, fmt.Sprintf("%s (%s)", f.License, f.Name))
+				}
+			}
+			if len(licenses) > 0 {
+				violations = append(violations, msg.Sprintf(msg.LicenseNotAllowed, name, strings.Join(licenses, ", ")))
+			}
+		}
+	}
+	return violations, warnings, nil
+}
+
+// unknown はライセンスを判定できないモジュールを Unknown の設定に従って振り分けます
+func (c *Config) unknown(warnings, violations []string, message string) ([]string, []string) {
+	switch c.Unknown {
+	case "fail":
+		violations = append(violations, message)
+	case "ignore":
+	default:
+		warnings = append(warnings, message)
+	}
+	return warnings, violations
+}
+
+// scan はモジュールのライセンスファイルを判定します。モジュールキャッシュのモジュールは結果をキャッシュします
+func (c *Config) scan(m linkdeps.Module) ([]File, error) {
+	target := m
+	if m.Replace != nil {
+		target = *m.Replace
+	}
+	if target.Version == "" {
+		// ローカルディレクトリへの置き換えは内容が変わるためキャッシュしません
+		return Scan(m.Dir)
+	}
+
+	dir := c.CacheDir
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return Scan(m.Dir)
+		}
+		dir = filepath.Join(cache, "gocon25-toolexec", "license")
+	}
+	path := filepath.Join(dir, linkdeps.EscapePath(target.Path)+"@"+linkdeps.EscapePath(target.Version)+".json")
+	if data, err := os.ReadFile(path); err == nil {
+		var e cacheEntry
+		if json.Unmarshal(data, &e) == nil && e.ClassifierVersion == classifierVersion {
+			return e.Files, nil
+		}
+	}
+
+	files, err := Scan(m.Dir)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(cacheEntry{ClassifierVersion: classifierVersion, Files: files})
+	if err != nil {
+		return nil, err
+	}
+	// 並行して実行される他の link と競合しないように、名前の変更で保存します
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return nil, err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return files, nil
+}
+
+func moduleName(m linkdeps.Module) string {
+	name := m.Path
+	if m.Version != "" {
+		name += "@" + m.Version
+	}
+	if m.Replace != nil {
+		name += " => " + strings.TrimSpace(m.Replace.Path+" "+m.Replace.Version)
+	}
+	return name
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Hook は link の前にリンクされるモジュールのライセンスを調べ、違反があればビルドを失敗させます
+func Hook(c *Config) hook.Hook {
+	return hook.Hook{
+		Name: "license",
+		Before: func(inv *hook.Invocation) error {
+			if inv.Tool != "link" || len(c.Allow)+len(c.Deny) == 0 {
+				return nil
+			}
+
+			r, err := linkdeps.Load(inv)
+			if err != nil {
+				return err
+			}
+			violations, warnings, err := c.Check(r)
+			if err != nil {
+				return err
+			}
+			sort.Strings(violations)
+			if c.Warn {
+				warnings, violations = append(warnings, violations...), nil
+			}
+			for _, w := range warnings {
+				fmt.Fprintf(inv.Stderr, "[TOOLEXEC] license: %s\n", w)
+			}
+			if len(violations) > 0 {
+				return msg.Errorf(msg.LicenseViolation, inv.ImportPath, strings.Join(violations, "\n\t"))
+			}
+			return nil
+		},
+	}
+}
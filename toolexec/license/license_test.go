@@ -0,0 +1,129 @@
+package license_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/license"
+)
+
+func TestClassify(t *testing.T) {
+	tests := map[string]string{
+		"MIT": `MIT License
+
+Copyright (c) 2020 Someone
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal`,
+		"Apache-2.0": `
+                                 Apache License
+                           Version 2.0, January 2004
+                        http://www.apache.org/licenses/`,
+		"BSD-2-Clause": `Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"`,
+		"BSD-3-Clause": `Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+   * Neither the name of Google LLC nor the names of its
+contributors may be used to endorse or promote products derived from`,
+		"MPL-2.0": `Mozilla Public License Version 2.0
+1.12. "Secondary License"
+    means either the GNU General Public License, Version 2.0, the GNU
+    Lesser General Public License, Version 2.1, the GNU Affero General
+    Public License, Version 3.0, or any later versions of those licenses.`,
+		"ISC": `Permission to use, copy, modify, and/or distribute this software for any
+purpose with or without fee is hereby granted, provided that the above
+copyright notice and this permission notice appear in all copies.`,
+		"": "All rights reserved.",
+	}
+	for want, text := range tests {
+		if got := license.Classify(text); got != want {
+			t.Errorf("Classify(%.30q) = %q; want %q", text, got, want)
+		}
+	}
+
+	// GNU のライセンスは本文で互いの名前に触れるため、全文で確かめます
+	for name, want := range map[string]string{
+		"GPL-2.0-1991.txt":   "GPL-2.0", // 本文で GNU Library General Public License に触れる版です
+		"GPL-2.0.txt":        "GPL-2.0",
+		"GPL-3.0.txt":        "GPL-3.0", // 13 条で GNU Affero General Public License に触れます
+		"GPL-3.0-notice.txt": "GPL-3.0", // 著作権表示と告知だけのファイルです
+		"GPL-3.0-banner.txt": "GPL-3.0", // 本文の前にプロジェクトの名前と著作権表示があります
+		"LGPL-2.0.txt":       "LGPL-2.0",
+		"LGPL-2.1.txt":       "LGPL-2.1",
+		"LGPL-3.0.txt":       "LGPL-3.0",
+		"AGPL-3.0.txt":       "AGPL-3.0",
+	} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := license.Classify(string(data)); got != want {
+			t.Errorf("Classify(%s) = %q; want %q", name, got, want)
+		}
+	}
+}
+
+func TestHook(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	cacheDir := t.TempDir()
+	dir := buildtest.WriteModule(t, map[string]string{
+		"go.mod": `module example.com/app
+
+go 1.25
+
+require (
+	example.com/gpl v1.0.0
+	golang.org/x/mod v0.28.0
+)
+
+replace example.com/gpl => ./gpl
+`,
+		"go.sum": `golang.org/x/mod v0.28.0 h1:gQBtGhjxykdjY9YhZpSlZIsbnaE2+PgjfLWUQTnoZ1U=
+golang.org/x/mod v0.28.0/go.mod h1:yfB/L0NOf/kmEbXjzCPOx1iK1fRutOydrCMsqRhEBxI=
+`,
+		"gpl/go.mod":  "module example.com/gpl\n\ngo 1.25\n",
+		"gpl/gpl.go":  "package gpl\n\nfunc F() int { return 1 }\n",
+		"gpl/COPYING": "                    GNU GENERAL PUBLIC LICENSE\n                       Version 3, 29 June 2007\n",
+		"main.go": `package main
+
+import (
+	"example.com/gpl"
+	"golang.org/x/mod/semver"
+)
+
+func main() { println(gpl.F(), semver.IsValid("v1.0.0")) }
+`,
+	})
+	policy := `"allow": ["MIT", "BSD-3-Clause"], "deny": ["GPL-3.0"], "cacheDir": "` + filepath.ToSlash(cacheDir) + `"`
+
+	config := buildtest.WriteConfig(t, `{"license": {`+policy+`}}`)
+	out, err := buildtest.GoBuild(t, dir, wrapper, []string{"TOOLEXEC_CONFIG=" + config}, "-o", "app", ".")
+	if err == nil {
+		t.Fatalf("go build succeeded with a denied license\n%s", out)
+	}
+	if !strings.Contains(out, "example.com/gpl@v1.0.0 => ./gpl: GPL-3.0 (COPYING) is denied") || strings.Contains(out, "golang.org/x/mod") {
+		t.Errorf("unexpected output\n%s", out)
+	}
+
+	// x/mod はモジュールのバージョンごとにキャッシュし、ローカルの置き換えはキャッシュしません
+	cached, err := os.ReadFile(filepath.Join(cacheDir, "golang.org", "x", "mod@v0.28.0.json"))
+	if err != nil || !strings.Contains(string(cached), `"license":"BSD-3-Clause"`) {
+		t.Errorf("cache = %s, %v", cached, err)
+	}
+	if entries, _ := filepath.Glob(filepath.Join(cacheDir, "example.com", "*")); len(entries) != 0 {
+		t.Errorf("local replacement is cached: %v", entries)
+	}
+
+	config = buildtest.WriteConfig(t, `{"license": {`+policy+`, "warn": true}}`)
+	out, err = buildtest.GoBuild(t, dir, wrapper, []string{"TOOLEXEC_CONFIG=" + config}, "-o", "app", ".")
+	if err != nil {
+		t.Fatalf("go build failed in warn mode: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "[TOOLEXEC] license: example.com/gpl@v1.0.0 => ./gpl: GPL-3.0 (COPYING) is denied") {
+		t.Errorf("warning is not shown\n%s", out)
+	}
+}
@@ -0,0 +1,71 @@
+package msg
+
+var en = map[Key]string{
+	Compiling: "Compiling",
+	Linking:   "Linking",
+	BuildDone: "🎉 Build complete!",
+
+	Usage:                  "usage: %s /path/to/tool [args...]",
+	TimedOut:               "timed out after %s",
+	ReceivedSignal:         "received %s",
+	MemoryLimitUnsupported: "memory limit is only supported on linux",
+	MemoryLimitFailed:      "set memory limit: %v",
+	NoToolToRun:            "no tool to run",
+
+	SuperviseKilledBy:     "killed by %s",
+	SuperviseReport:       "%s %s %s; report: %s",
+	SuperviseReportFailed: "%s %s %s; writing report: %v",
+	SuperviseTimeout:      "timeout for %s: %w",
+	SuperviseMemory:       "memory for %s: %w",
+	SuperviseInvalidSize:  "invalid size %q",
+	ReachNotReachable:     "%s is not reachable",
+	ReachFromRoots:        "%s is reachable only from linker roots (init, runtime): %s",
+	ReachReachable:        "%s is reachable: %s",
+	BinSizeGrew:           "binary size of %s grew by %d bytes in %d package(s)",
+	BinSizeNotELF:         "binsize: %s is not an ELF file; skipping",
+	NotReproducible:       "%s %s is not reproducible: %s",
+	MismatchOffset:        "first difference at offset %#x",
+	MismatchMember:        " in archive member %s",
+	MismatchSection:       " in section %s",
+	MismatchSymbol:        " (symbol %s)",
+	MismatchCause:         "\n\tlikely cause: %s",
+	CauseAbsolutePath:     "embedded absolute path (build with -trimpath)",
+	CauseTimestamp:        "embedded timestamp (use SOURCE_DATE_EPOCH or the commit time)",
+	CauseReordered:        "same bytes in a different order (map iteration order in code generation)",
+	CauseNondeterministic: "nondeterministic code generation (map iteration order, goroutine scheduling)",
+	DebugoptInlined:       "%s: %s from %s is inlined into %s, which is optimized; breakpoints in the inlined copy are not hit",
+	LicenseNoModuleDir:    "%s: module directory not found",
+	LicenseNoFile:         "%s: no license file found",
+	LicenseUnrecognized:   "%s: license in %s is not recognized",
+	LicenseDenied:         "%s: %s (%s) is denied",
+	LicenseNotAllowed:     "%s: %s is not in the allow list",
+	LicenseViolation:      "%s links modules violating the license policy:\n\t%s",
+	ImportPolicyViolation: "import policy violation in package %s:",
+	ImportDenied:          "%s: import %q denied by rule %s",
+	FaultReleaseBuild:     "fault injection is enabled (TOOLEXEC_FAULT=1) but %s is a release build (-X %s)",
+	FaultFuncNotFound:     "fault: function %s not found",
+	FaultInvalidLatency:   "fault %s: latency: %w",
+	FaultMultilineResult:  "fault %s: result type spanning multiple lines is not supported",
+	FaultNoErrorResult:    "fault %s: kind error requires the last result to be error",
+	FaultUnknownKind:      "fault %s: unknown kind %q",
+	BuildmetaInvalidEpoch: "invalid SOURCE_DATE_EPOCH: %w",
+	BuildmetaUnknownTime:  "unknown time source %q",
+	AnalyzeUnknown:        "unknown analyzer %q",
+	AnalyzeStrict:         "findings in %s (strict mode)",
+	CompileCacheMismatch:  "compilecache: cached archive of %s differs from compiler output at byte %d (cached %d bytes, compiled %d bytes, key %s)",
+	ReplayOK:              "ok",
+	ReplayExitStatus:      "exit status %d (recorded %d)",
+	ReplaySame:            ", output same as recorded",
+	ReplayDiffers:         ", output differs from recorded",
+
+	BoardCounts:  "%d running, %d done, %d failed",
+	BoardSlowest: "slowest:",
+
+	CommandFailed: "%s: %v",
+	UsageEscape:   "usage: wrapper escape report <dir>\n       wrapper escape diff <old.json> <new.json>",
+	UsageBCE:      "usage: wrapper bce report [-profile cpu.pprof] <dir>",
+	UsageSize:     "usage: wrapper size <binary>",
+	UsageReplay:   "usage: wrapper replay [-pkg pattern] [-tool compile] [-tooldir dir] [-extra flags] [-root dir] [-script] <log.jsonl>",
+	UsageReach:    "usage: wrapper reach why <name.reach.json> <symbol or package>...",
+	UsageAnalyze:  "usage: wrapper analyze [-analyzers a,b] unit.cfg",
+}
@@ -0,0 +1,71 @@
+package msg
+
+var ja = map[Key]string{
+	Compiling: "コンパイル中",
+	Linking:   "リンク中",
+	BuildDone: "🎉 ビルド完了！",
+
+	Usage:                  "使い方: %s /path/to/tool [引数...]",
+	TimedOut:               "%s でタイムアウトしました",
+	ReceivedSignal:         "%s を受信しました",
+	MemoryLimitUnsupported: "メモリの制限は linux でのみ使えます",
+	MemoryLimitFailed:      "メモリの制限を設定できませんでした: %v",
+	NoToolToRun:            "実行するツールがありません",
+
+	SuperviseKilledBy:     "%s で強制終了されました",
+	SuperviseReport:       "%s %s: %s。レポート: %s",
+	SuperviseReportFailed: "%s %s: %s。レポートを書き出せませんでした: %v",
+	SuperviseTimeout:      "%s のタイムアウト: %w",
+	SuperviseMemory:       "%s のメモリの上限: %w",
+	SuperviseInvalidSize:  "サイズ %q が不正です",
+	ReachNotReachable:     "%s には到達できません",
+	ReachFromRoots:        "%s にはリンカーのルート（init, runtime）からのみ到達できます: %s",
+	ReachReachable:        "%s に到達できます: %s",
+	BinSizeGrew:           "%s のバイナリサイズが合計 %d バイト増えました（%d パッケージ）",
+	BinSizeNotELF:         "binsize: %s は ELF 形式ではないため解析しません",
+	NotReproducible:       "%s %s は再現できません: %s",
+	MismatchOffset:        "オフセット %#x で最初に異なります",
+	MismatchMember:        "（アーカイブのメンバー %s）",
+	MismatchSection:       "（セクション %s）",
+	MismatchSymbol:        "（シンボル %s）",
+	MismatchCause:         "\n\t考えられる原因: %s",
+	CauseAbsolutePath:     "絶対パスが埋め込まれています（-trimpath を付けてビルドしてください）",
+	CauseTimestamp:        "時刻が埋め込まれています（SOURCE_DATE_EPOCH かコミットの時刻を使ってください）",
+	CauseReordered:        "同じバイト列が異なる順序で並んでいます（コード生成でのマップの反復順序）",
+	CauseNondeterministic: "コード生成が決定的ではありません（マップの反復順序、ゴルーチンのスケジューリング）",
+	DebugoptInlined:       "%s: %s（%s）が最適化された %s にインライン化されています。インライン化されたコードのブレークポイントでは停止しません",
+	LicenseNoModuleDir:    "%s: モジュールのディレクトリが見つかりません",
+	LicenseNoFile:         "%s: ライセンスファイルが見つかりません",
+	LicenseUnrecognized:   "%s: %s のライセンスを判別できません",
+	LicenseDenied:         "%s: %s（%s）は禁止されています",
+	LicenseNotAllowed:     "%s: %s は許可リストにありません",
+	LicenseViolation:      "%s がライセンスのポリシーに違反するモジュールをリンクしています:\n\t%s",
+	ImportPolicyViolation: "パッケージ %s がインポートのポリシーに違反しています:",
+	ImportDenied:          "%s: %q のインポートはルール %s で禁止されています",
+	FaultReleaseBuild:     "障害の注入が有効（TOOLEXEC_FAULT=1）ですが、%s はリリースビルド（-X %s）です",
+	FaultFuncNotFound:     "fault: 関数 %s が見つかりません",
+	FaultInvalidLatency:   "fault %s: 遅延時間が不正です: %w",
+	FaultMultilineResult:  "fault %s: 複数行にわたる戻り値の型には対応していません",
+	FaultNoErrorResult:    "fault %s: kind error には最後の戻り値が error の関数が必要です",
+	FaultUnknownKind:      "fault %s: 不明な kind %q です",
+	BuildmetaInvalidEpoch: "SOURCE_DATE_EPOCH が不正です: %w",
+	BuildmetaUnknownTime:  "不明な時刻の取得元 %q です",
+	AnalyzeUnknown:        "不明なアナライザー %q です",
+	AnalyzeStrict:         "%s に指摘があります（strict モード）",
+	CompileCacheMismatch:  "compilecache: キャッシュした %s のアーカイブがコンパイラの出力と %d バイト目で異なります（キャッシュ %d バイト、コンパイル %d バイト、キー %s）",
+	ReplayOK:              "成功",
+	ReplayExitStatus:      "終了コード %d（記録 %d）",
+	ReplaySame:            "、出力は記録と同じです",
+	ReplayDiffers:         "、出力が記録と異なります",
+
+	BoardCounts:  "実行中 %d、完了 %d、失敗 %d",
+	BoardSlowest: "時間のかかった呼び出し:",
+
+	CommandFailed: "%s に失敗しました: %v",
+	UsageEscape:   "使い方: wrapper escape report <dir>\n        wrapper escape diff <old.json> <new.json>",
+	UsageBCE:      "使い方: wrapper bce report [-profile cpu.pprof] <dir>",
+	UsageSize:     "使い方: wrapper size <binary>",
+	UsageReplay:   "使い方: wrapper replay [-pkg pattern] [-tool compile] [-tooldir dir] [-extra flags] [-root dir] [-script] <log.jsonl>",
+	UsageReach:    "使い方: wrapper reach why <name.reach.json> <symbol or package>...",
+	UsageAnalyze:  "使い方: wrapper analyze [-analyzers a,b] unit.cfg",
+}
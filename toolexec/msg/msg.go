@@ -0,0 +1,190 @@
+// Package msg はラッパーやフックがユーザーに表示するメッセージのカタログです。
+//
+// メッセージは Key で指定し、LC_ALL, LC_MESSAGES, LANG 環境変数の順に見つかった
+// ロケールの言語（ja または en）のカタログから選びます。
+// ロケールが設定されていないか、C のようにカタログのない言語の場合は日本語になります。
+// -toolexec="wrapper -lang=ja" のように -lang フラグを指定するとロケールより優先します。
+package msg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Key はメッセージの識別子です
+type Key string
+
+const (
+	// ワークショップのステップ
+
+	Compiling Key = "compiling"
+	Linking   Key = "linking"
+	BuildDone Key = "build-done"
+
+	// hook
+
+	Usage                  Key = "usage"
+	TimedOut               Key = "timed-out"
+	ReceivedSignal         Key = "received-signal"
+	MemoryLimitUnsupported Key = "memory-limit-unsupported"
+	MemoryLimitFailed      Key = "memory-limit-failed"
+	NoToolToRun            Key = "no-tool-to-run"
+
+	// フック
+
+	SuperviseKilledBy     Key = "supervise-killed-by"
+	SuperviseReport       Key = "supervise-report"
+	SuperviseReportFailed Key = "supervise-report-failed"
+	SuperviseTimeout      Key = "supervise-timeout"
+	SuperviseMemory       Key = "supervise-memory"
+	SuperviseInvalidSize  Key = "supervise-invalid-size"
+	ReachNotReachable     Key = "reach-not-reachable"
+	ReachFromRoots        Key = "reach-from-roots"
+	ReachReachable        Key = "reach-reachable"
+	BinSizeGrew           Key = "binsize-grew"
+	BinSizeNotELF         Key = "binsize-not-elf"
+	NotReproducible       Key = "not-reproducible"
+	MismatchOffset        Key = "mismatch-offset"
+	MismatchMember        Key = "mismatch-member"
+	MismatchSection       Key = "mismatch-section"
+	MismatchSymbol        Key = "mismatch-symbol"
+	MismatchCause         Key = "mismatch-cause"
+	CauseAbsolutePath     Key = "cause-absolute-path"
+	CauseTimestamp        Key = "cause-timestamp"
+	CauseReordered        Key = "cause-reordered"
+	CauseNondeterministic Key = "cause-nondeterministic"
+	DebugoptInlined       Key = "debugopt-inlined"
+	LicenseNoModuleDir    Key = "license-no-module-dir"
+	LicenseNoFile         Key = "license-no-file"
+	LicenseUnrecognized   Key = "license-unrecognized"
+	LicenseDenied         Key = "license-denied"
+	LicenseNotAllowed     Key = "license-not-allowed"
+	LicenseViolation      Key = "license-violation"
+	ImportPolicyViolation Key = "import-policy-violation"
+	ImportDenied          Key = "import-denied"
+	FaultReleaseBuild     Key = "fault-release-build"
+	FaultFuncNotFound     Key = "fault-func-not-found"
+	FaultInvalidLatency   Key = "fault-invalid-latency"
+	FaultMultilineResult  Key = "fault-multiline-result"
+	FaultNoErrorResult    Key = "fault-no-error-result"
+	FaultUnknownKind      Key = "fault-unknown-kind"
+	BuildmetaInvalidEpoch Key = "buildmeta-invalid-epoch"
+	BuildmetaUnknownTime  Key = "buildmeta-unknown-time"
+	AnalyzeUnknown        Key = "analyze-unknown"
+	AnalyzeStrict         Key = "analyze-strict"
+	CompileCacheMismatch  Key = "compilecache-mismatch"
+	ReplayOK              Key = "replay-ok"
+	ReplayExitStatus      Key = "replay-exit-status"
+	ReplaySame            Key = "replay-same"
+	ReplayDiffers         Key = "replay-differs"
+
+	// ビルドの進捗
+
+	BoardCounts  Key = "board-counts"
+	BoardSlowest Key = "board-slowest"
+
+	// サブコマンド
+
+	CommandFailed Key = "command-failed"
+	UsageEscape   Key = "usage-escape"
+	UsageBCE      Key = "usage-bce"
+	UsageSize     Key = "usage-size"
+	UsageReplay   Key = "usage-replay"
+	UsageReach    Key = "usage-reach"
+	UsageAnalyze  Key = "usage-analyze"
+)
+
+// Default はロケールから言語が決まらない場合の言語です
+const Default = "ja"
+
+// catalogs は言語ごとのメッセージです。値は fmt の書式です
+var catalogs = map[string]map[Key]string{
+	"ja": ja,
+	"en": en,
+}
+
+// override は -lang フラグで指定された言語です
+var override string
+
+// Lang は現在の言語を返します
+func Lang() string {
+	if override != "" {
+		return override
+	}
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			return langOf(v)
+		}
+	}
+	return Default
+}
+
+// langOf は "ja_JP.UTF-8" のようなロケールから言語を求めます
+func langOf(locale string) string {
+	lang, _, _ := strings.Cut(locale, ".")
+	lang, _, _ = strings.Cut(lang, "_")
+	lang = strings.ToLower(lang)
+	if _, ok := catalogs[lang]; ok {
+		return lang
+	}
+	return Default
+}
+
+// SetLang はロケールに関係なく使う言語を設定します。空文字列を指定するとロケールに戻します
+func SetLang(lang string) error {
+	if _, ok := catalogs[lang]; lang != "" && !ok {
+		return fmt.Errorf("unknown language %q", lang)
+	}
+	override = lang
+	return nil
+}
+
+// ParseFlag は os.Args 形式の引数からプログラム名の直後にある -lang フラグを取り除き、その言語を設定します。
+// toolexec ではツールのパスより前の引数がラッパー自身の引数になります。
+func ParseFlag(args []string) ([]string, error) {
+	if len(args) < 2 {
+		return args, nil
+	}
+	var lang string
+	rest := args[1:]
+	switch {
+	case strings.HasPrefix(rest[0], "-lang="):
+		lang, rest = strings.TrimPrefix(rest[0], "-lang="), rest[1:]
+	case rest[0] == "-lang" && len(rest) > 1:
+		lang, rest = rest[1], rest[2:]
+	case rest[0] == "-lang":
+		return nil, errors.New("flag needs an argument: -lang")
+	default:
+		return args, nil
+	}
+	if err := SetLang(lang); err != nil {
+		return nil, err
+	}
+	return append([]string{args[0]}, rest...), nil
+}
+
+// Sprintf は現在の言語で key のメッセージを書式化します
+func Sprintf(key Key, args ...any) string {
+	return fmt.Sprintf(format(key), args...)
+}
+
+// Errorf は key のメッセージをエラーにします。書式に %w を含む場合は引数のエラーを包みます
+func Errorf(key Key, args ...any) error {
+	return fmt.Errorf(format(key), args...)
+}
+
+// Fprintf は key のメッセージを w に書き出します
+func Fprintf(w io.Writer, key Key, args ...any) (int, error) {
+	return fmt.Fprintf(w, format(key), args...)
+}
+
+// format は現在の言語の key の書式を返します。カタログにない場合は英語の書式を使います
+func format(key Key) string {
+	if f, ok := catalogs[Lang()][key]; ok {
+		return f
+	}
+	return en[key]
+}
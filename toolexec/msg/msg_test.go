@@ -0,0 +1,119 @@
+package msg
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// declaredKeys は msg.go で宣言された Key の定数を返します
+func declaredKeys(t *testing.T) []Key {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "msg.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []Key
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			if id, ok := vs.Type.(*ast.Ident); !ok || id.Name != "Key" {
+				continue
+			}
+			for _, v := range vs.Values {
+				s, err := strconv.Unquote(v.(*ast.BasicLit).Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				keys = append(keys, Key(s))
+			}
+		}
+	}
+	return keys
+}
+
+// verbRe は書式の動詞です。%% は引数を取らないため除きます
+var verbRe = regexp.MustCompile(`%[-+# 0]*[0-9]*(?:\.[0-9]+)?[a-zA-Z]`)
+
+func TestCatalogs(t *testing.T) {
+	keys := declaredKeys(t)
+	if len(keys) == 0 {
+		t.Fatal("no keys declared")
+	}
+	for lang, catalog := range catalogs {
+		for _, key := range keys {
+			format, ok := catalog[key]
+			if !ok || format == "" {
+				t.Errorf("%s: missing message for %q", lang, key)
+				continue
+			}
+			// 言語によって引数の順序や型が変わると書式化に失敗します
+			if got, want := verbRe.FindAllString(format, -1), verbRe.FindAllString(en[key], -1); !slices.Equal(got, want) {
+				t.Errorf("%s: verbs of %q = %q; want %q as in en", lang, key, got, want)
+			}
+		}
+		for key := range catalog {
+			if !slices.Contains(keys, key) {
+				t.Errorf("%s: message for undeclared key %q", lang, key)
+			}
+		}
+	}
+}
+
+func TestLang(t *testing.T) {
+	for _, tt := range []struct {
+		lcAll, lcMessages, lang string
+		want                    string
+	}{
+		{"", "", "", Default},
+		{"", "", "ja_JP.UTF-8", "ja"},
+		{"", "", "en_US.UTF-8", "en"},
+		{"C", "", "en_US.UTF-8", Default},
+		{"", "ja_JP.eucJP", "en_US.UTF-8", "ja"},
+		{"fr_FR.UTF-8", "", "", Default},
+		{"ja", "", "", "ja"},
+	} {
+		t.Setenv("LC_ALL", tt.lcAll)
+		t.Setenv("LC_MESSAGES", tt.lcMessages)
+		t.Setenv("LANG", tt.lang)
+		if got := Lang(); got != tt.want {
+			t.Errorf("Lang() with LC_ALL=%q LC_MESSAGES=%q LANG=%q = %q; want %q", tt.lcAll, tt.lcMessages, tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestParseFlag(t *testing.T) {
+	t.Setenv("LC_ALL", "ja_JP.UTF-8")
+	t.Cleanup(func() { SetLang("") })
+
+	for _, tt := range []struct {
+		args []string
+		want []string
+		lang string
+	}{
+		{[]string{"wrapper", "/go/pkg/tool/compile", "-o", "x.a"}, []string{"wrapper", "/go/pkg/tool/compile", "-o", "x.a"}, "ja"},
+		{[]string{"wrapper", "-lang=en", "/go/pkg/tool/compile"}, []string{"wrapper", "/go/pkg/tool/compile"}, "en"},
+		{[]string{"wrapper", "-lang", "ja", "escape", "report"}, []string{"wrapper", "escape", "report"}, "ja"},
+	} {
+		SetLang("")
+		got, err := ParseFlag(tt.args)
+		if err != nil || !slices.Equal(got, tt.want) || Lang() != tt.lang {
+			t.Errorf("ParseFlag(%q) = %q, %v with language %s; want %q with %s", tt.args, got, err, Lang(), tt.want, tt.lang)
+		}
+	}
+
+	if _, err := ParseFlag([]string{"wrapper", "-lang=fr", "/go/pkg/tool/compile"}); err == nil {
+		t.Error("ParseFlag accepted unknown language fr")
+	}
+	if got := Sprintf(BinSizeGrew, "example.com/app", 1, 2); got != "example.com/app のバイナリサイズが合計 1 バイト増えました（2 パッケージ）" {
+		t.Errorf("Sprintf in ja = %q", got)
+	}
+}
@@ -0,0 +1,314 @@
+// Package reach はリンカーの -dumpdep の出力から、シンボルやパッケージがバイナリに含まれる理由を調べます。
+//
+// 設定例:
+//
+//	{
+//	  "reach": {
+//	    "packages": ["example.com/app/cmd/server"],
+//	    "dir": "/tmp/reach",
+//	    "why": ["golang.org/x/text/unicode/norm", "encoding/json.Marshal"]
+//	  }
+//	}
+//
+// packages に一致するメインパッケージの link に -dumpdep を追加し、
+// リンカーが標準出力に書く "from -> to" の依存関係をユーザーに見せずに取り込みます。
+// -dumpdep は出力するバイナリを変えません。
+//
+// link の後に dir に次のファイルを書き出し、why に指定したシンボルまたはパッケージについて
+// main.main からの最短経路を表示します。main.main から到達できない場合は init などのルートからの経路を表示します。
+//
+//	<バイナリ名>.reach.json  シンボルの依存関係のグラフ
+//	<バイナリ名>.reach.dot   パッケージの依存関係のグラフ（Graphviz）
+//
+// 保存したグラフは wrapper reach why <バイナリ名>.reach.json <シンボルまたはパッケージ> でも調べられます。
+package reach
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/binsize"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/sbom"
+)
+
+// Root はリンカーがルートとして扱うシンボルの依存元です（-dumpdep の "_"）
+const Root = "_"
+
+// Main は最短経路の起点にする関数です
+const Main = "main.main"
+
+// Config は到達可能性のレポートの設定です
+type Config struct {
+	// Packages は -dumpdep を追加するメインパッケージのパターンです
+	Packages []string `json:"packages"`
+	// Dir はグラフを書き出すディレクトリです。省略時は link の作業ディレクトリである go コマンドを実行したディレクトリです
+	Dir string `json:"dir"`
+	// Why は link の後に経路を表示するシンボルまたはパッケージです
+	Why []string `json:"why"`
+}
+
+// Graph はシンボルの依存関係のグラフです
+type Graph struct {
+	// Edges はシンボルから参照するシンボルへの辺です。Root からの辺はリンカーのルートです
+	Edges map[string][]string `json:"edges"`
+}
+
+// Parse は -dumpdep の "from -> to" の行からグラフを作ります。それ以外の行は無視します
+func Parse(r io.Reader) (*Graph, error) {
+	g := &Graph{Edges: make(map[string][]string)}
+	seen := make(map[[2]string]bool)
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		from, to, ok := strings.Cut(s.Text(), " -> ")
+		// インターフェースを通して呼ばれるメソッドへの辺は "type:*T <UsedInIface> -> T.M" と表示されます
+		from = strings.TrimSuffix(from, " <UsedInIface>")
+		// DWARF の情報などの名前のないシンボルからの辺は含めません
+		if !ok || from == "" || seen[[2]string{from, to}] {
+			continue
+		}
+		seen[[2]string{from, to}] = true
+		g.Edges[from] = append(g.Edges[from], to)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	for _, to := range g.Edges {
+		sort.Strings(to)
+	}
+	return g, nil
+}
+
+// ReadGraph は書き出したグラフの JSON を読み込みます
+func ReadGraph(path string) (*Graph, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var g Graph
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &g, nil
+}
+
+// matches は sym が target のシンボルそのものか、target のパッケージのシンボルかどうかを返します
+func matches(sym, target string) bool {
+	return sym == target || binsize.PackageOf(sym) == target
+}
+
+// Why は main.main から target（シンボルまたはパッケージ）までの最短経路を返します。
+// main.main から到達できない場合は Root からの経路を返し、到達できない場合は nil です。
+func (g *Graph) Why(target string) []string {
+	if path := g.shortest(Main, target); path != nil {
+		return path
+	}
+	return g.shortest(Root, target)
+}
+
+// shortest は幅優先探索で start から target までの最短経路を求めます
+func (g *Graph) shortest(start, target string) []string {
+	prev := map[string]string{start: ""}
+	queue := []string{start}
+	for len(queue) > 0 {
+		sym := queue[0]
+		queue = queue[1:]
+		if sym != Root && matches(sym, target) {
+			var path []string
+			for s := sym; s != ""; s = prev[s] {
+				path = append(path, s)
+			}
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+			return path
+		}
+		for _, next := range g.Edges[sym] {
+			if _, ok := prev[next]; !ok {
+				prev[next] = sym
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
+
+// PackageEdges はシンボルの辺をパッケージの間の辺にまとめます。
+// 同じパッケージの中の辺、Root からの辺、文字列や型情報などのパッケージに属さないシンボルへの辺は含めません。
+func (g *Graph) PackageEdges() map[string][]string {
+	set := make(map[string]map[string]bool)
+	for from, tos := range g.Edges {
+		fp := binsize.PackageOf(from)
+		if from == Root || fp == Root || strings.HasPrefix(fp, "(") {
+			continue
+		}
+		for _, to := range tos {
+			tp := binsize.PackageOf(to)
+			if fp == tp || strings.HasPrefix(tp, "(") {
+				continue
+			}
+			if set[fp] == nil {
+				set[fp] = make(map[string]bool)
+			}
+			set[fp][tp] = true
+		}
+	}
+	edges := make(map[string][]string, len(set))
+	for from, tos := range set {
+		for to := range tos {
+			edges[from] = append(edges[from], to)
+		}
+		sort.Strings(edges[from])
+	}
+	return edges
+}
+
+// WriteDOT はパッケージの依存関係のグラフを Graphviz の DOT 形式で書き出します
+func (g *Graph) WriteDOT(w io.Writer) error {
+	edges := g.PackageEdges()
+	froms := make([]string, 0, len(edges))
+	for from := range edges {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph reach {")
+	fmt.Fprintln(bw, "\trankdir=LR;")
+	fmt.Fprintln(bw, "\tnode [shape=box];")
+	for _, from := range froms {
+		for _, to := range edges[from] {
+			fmt.Fprintf(bw, "\t%q -> %q;\n", from, to)
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// WriteFiles は dir に name.reach.json と name.reach.dot を書き出します
+func (g *Graph) WriteFiles(dir, name string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".reach.json"), append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	var dot bytes.Buffer
+	if err := g.WriteDOT(&dot); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name+".reach.dot"), dot.Bytes(), 0o644)
+}
+
+// FormatPath は経路を表示用の文字列にします
+func FormatPath(target string, path []string) string {
+	switch {
+	case path == nil:
+		return msg.Sprintf(msg.ReachNotReachable, target)
+	case path[0] == Root:
+		return msg.Sprintf(msg.ReachFromRoots, target, strings.Join(path[1:], " -> "))
+	}
+	return msg.Sprintf(msg.ReachReachable, target, strings.Join(path, " -> "))
+}
+
+// edgeFilter は link の標準出力から -dumpdep の行を取り出し、それ以外の行を w に書き出します
+type edgeFilter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	edges   bytes.Buffer
+	partial []byte
+}
+
+func (f *edgeFilter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.partial = append(f.partial, p...)
+	for {
+		i := bytes.IndexByte(f.partial, '\n')
+		if i < 0 {
+			break
+		}
+		f.line(f.partial[:i+1])
+		f.partial = f.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+func (f *edgeFilter) line(line []byte) {
+	if bytes.Contains(line, []byte(" -> ")) {
+		f.edges.Write(line)
+		return
+	}
+	f.w.Write(line)
+}
+
+// flush は改行で終わっていない最後の行を書き出します
+func (f *edgeFilter) flush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.partial) > 0 {
+		f.line(f.partial)
+		f.partial = nil
+	}
+}
+
+// Hook は対象のメインパッケージの link に -dumpdep を追加し、link の後にグラフを書き出します
+func Hook(c *Config) hook.Hook {
+	var filter *edgeFilter
+
+	return hook.Hook{
+		Name: "reach",
+		Before: func(inv *hook.Invocation) error {
+			if inv.Tool != "link" || !hook.MatchAny(c.Packages, inv.Package()) {
+				return nil
+			}
+			inv.InsertArgs("-dumpdep")
+			filter = &edgeFilter{w: inv.Stdout}
+			inv.Stdout = filter
+			return nil
+		},
+		After: func(inv *hook.Invocation) error {
+			if filter == nil {
+				return nil
+			}
+			filter.flush()
+			g, err := Parse(&filter.edges)
+			if err != nil {
+				return err
+			}
+
+			dir := c.Dir
+			if dir == "" {
+				if dir, err = os.Getwd(); err != nil {
+					return err
+				}
+			}
+			if err := g.WriteFiles(dir, sbom.BinaryName(inv.ImportPath)); err != nil {
+				return err
+			}
+			for _, target := range c.Why {
+				fmt.Fprintf(inv.Stderr, "[TOOLEXEC] reach: %s\n", FormatPath(target, g.Why(target)))
+			}
+			return nil
+		},
+		Finish: func(inv *hook.Invocation, err error) {
+			if filter != nil {
+				filter.flush()
+			}
+		},
+	}
+}
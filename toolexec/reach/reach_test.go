@@ -0,0 +1,116 @@
+package reach_test
+
+import (
+	"bytes"
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/reach"
+)
+
+func TestHook(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	out := t.TempDir()
+	config := buildtest.WriteConfig(t, `{"reach": {
+	"packages": ["example.com/app"],
+	"dir": "`+filepath.ToSlash(out)+`",
+	"why": ["example.com/app/codec", "example.com/app/setup", "net/http"]
+}}`)
+	dir := buildtest.WriteModule(t, map[string]string{
+		"lib/lib.go": `package lib
+
+import "example.com/app/codec"
+
+//go:noinline
+func Encode(v int) []byte { return codec.Encode(v) }
+`,
+		"codec/codec.go": `package codec
+
+import "strconv"
+
+//go:noinline
+func Encode(v int) []byte { return strconv.AppendInt(nil, int64(v), 10) }
+`,
+		"setup/setup.go": `package setup
+
+var Ready bool
+
+func init() { Ready = true }
+`,
+		"main.go": `package main
+
+import (
+	"os"
+
+	"example.com/app/lib"
+	_ "example.com/app/setup"
+)
+
+func main() { os.Stdout.Write(lib.Encode(1)) }
+`,
+	})
+
+	if stderr, err := buildtest.GoBuild(t, dir, wrapper, nil, "-o", "plain", "."); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, stderr)
+	}
+	stderr, err := buildtest.GoBuild(t, dir, wrapper, []string{"TOOLEXEC_CONFIG=" + config}, "-o", "app", ".")
+	if err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, stderr)
+	}
+	if strings.Contains(stderr, "runtime.throw ->") {
+		t.Errorf("-dumpdep output is shown to the user\n%s", stderr)
+	}
+	for _, want := range []string{
+		"[TOOLEXEC] reach: example.com/app/codec is reachable: main.main -> example.com/app/lib.Encode -> example.com/app/codec.Encode\n",
+		"[TOOLEXEC] reach: example.com/app/setup is reachable only from linker roots (init, runtime): ",
+		"[TOOLEXEC] reach: net/http is not reachable\n",
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("output does not contain %q\n%s", want, stderr)
+		}
+	}
+
+	// -dumpdep はビルド ID 以外のバイナリの内容を変えません
+	if !bytes.Equal(withoutBuildID(t, filepath.Join(dir, "plain")), withoutBuildID(t, filepath.Join(dir, "app"))) {
+		t.Error("binary is changed by -dumpdep")
+	}
+
+	g, err := reach.ReadGraph(filepath.Join(out, "app.reach.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path := g.Why("example.com/app/lib.Encode"); strings.Join(path, " ") != "main.main example.com/app/lib.Encode" {
+		t.Errorf("Why(lib.Encode) = %v", path)
+	}
+	dot, err := os.ReadFile(filepath.Join(out, "app.reach.dot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(dot), `"example.com/app/lib" -> "example.com/app/codec";`) {
+		t.Errorf("package edge is not in the DOT graph\n%.500s", dot)
+	}
+}
+
+// withoutBuildID はバイナリのビルド ID のノートを取り除いた内容を返します。
+// GNU のビルド ID は Go のビルド ID から作られるため、設定が違うビルドでは両方が変わります。
+func withoutBuildID(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{".note.go.buildid", ".note.gnu.build-id"} {
+		if sec := f.Section(name); sec != nil {
+			clear(data[sec.Offset : sec.Offset+sec.Size])
+		}
+	}
+	return data
+}
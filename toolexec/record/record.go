@@ -0,0 +1,265 @@
+// Package record はツールの呼び出しを記録し、go コマンドなしで再実行できるようにします。
+//
+// 設定例:
+//
+//	{
+//	  "record": {
+//	    "log": "/tmp/build.jsonl",
+//	    "archive": "/tmp/build-archive"
+//	  }
+//	}
+//
+// ツールの呼び出しごとに、実行したツール、引数、環境変数、作業ディレクトリ、終了コードを
+// log に1行の JSON（Entry）として追記します。記録する環境変数は GO, CGO_ で始まるものと
+// TOOLEXEC_IMPORTPATH です。
+//
+// archive を指定すると、ソースファイル、importcfg、依存パッケージのアーカイブなどの入力を
+// 内容のハッシュをファイル名にして archive/files に保存します。
+// go コマンドの作業ディレクトリ（$WORK）はビルド後に削除されるため、後から再実行するには archive が必要です
+// （go build -work で $WORK を残す場合は不要です）。
+//
+// 記録した呼び出しは wrapper replay で再実行できます。
+//
+//	wrapper replay -pkg example.com/app/parser -tool compile /tmp/build.jsonl
+//	wrapper replay -script /tmp/build.jsonl > build.sh
+package record
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+)
+
+// Config は記録の設定です
+type Config struct {
+	// Log は記録を追記する JSON Lines ファイルです
+	Log string `json:"log"`
+	// Archive は入力ファイルを保存するディレクトリです（省略可）
+	Archive string `json:"archive"`
+}
+
+// Entry はツールの呼び出し1回分の記録です
+type Entry struct {
+	Tool       string   `json:"tool"`
+	ToolPath   string   `json:"toolPath"`
+	Args       []string `json:"args"`
+	Env        []string `json:"env"`
+	Dir        string   `json:"dir"`
+	ImportPath string   `json:"importPath"`
+	// ExitCode はツールの終了コードです。ツールを実行できなかった場合は -1 です
+	ExitCode int `json:"exitCode"`
+	// Archive は入力を保存したディレクトリです
+	Archive string `json:"archive,omitempty"`
+	// Files は保存した入力ファイルの絶対パスと内容のハッシュです
+	Files map[string]string `json:"files,omitempty"`
+	// Output は -o の出力ファイルの内容のハッシュです
+	Output string `json:"output,omitempty"`
+}
+
+// Hook はツールの実行後に呼び出しを記録します。ツールが失敗した場合も記録します
+func Hook(c *Config) hook.Hook {
+	return hook.Hook{
+		Name: "record",
+		Finish: func(inv *hook.Invocation, err error) {
+			if c.Log == "" {
+				return
+			}
+			if err := c.record(inv, err); err != nil {
+				fmt.Fprintf(inv.Stderr, "[TOOLEXEC] record: %v\n", err)
+			}
+		},
+	}
+}
+
+func (c *Config) record(inv *hook.Invocation, runErr error) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	e := &Entry{
+		Tool:       inv.Tool,
+		ToolPath:   inv.ToolPath,
+		Args:       inv.Args,
+		Env:        recordedEnv(os.Environ()),
+		Dir:        dir,
+		ImportPath: inv.ImportPath,
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(runErr, &exitErr):
+		e.ExitCode = exitErr.ExitCode()
+	case runErr != nil:
+		e.ExitCode = -1
+	}
+	if output, ok := inv.Flag("o"); ok && runErr == nil {
+		e.Output, _ = fileHash(abs(dir, output))
+	}
+
+	if c.Archive != "" {
+		e.Archive = c.Archive
+		e.Files = make(map[string]string)
+		for _, path := range Inputs(e) {
+			sum, err := c.store(path)
+			if err != nil {
+				return err
+			}
+			e.Files[path] = sum
+		}
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	// 並行して実行される他のツールの記録と混ざらないように、1行を1回の write で追記します
+	f, err := os.OpenFile(c.Log, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func recordedEnv(environ []string) []string {
+	var env []string
+	for _, kv := range environ {
+		if strings.HasPrefix(kv, "GO") || strings.HasPrefix(kv, "CGO_") || strings.HasPrefix(kv, "TOOLEXEC_IMPORTPATH=") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// Inputs は呼び出しが読み込むファイルの絶対パスを返します。
+// 入力ファイルに加えて、-importcfg などのフラグで渡される設定ファイルと、そこから参照されるファイルを含みます。
+func Inputs(e *Entry) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		path = abs(e.Dir, path)
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	inv := &hook.Invocation{Tool: e.Tool, Args: e.Args}
+	var includeDirs []string
+	for _, in := range inv.Inputs() {
+		add(in)
+		if filepath.Ext(in) == ".s" {
+			includeDirs = append(includeDirs, filepath.Dir(abs(e.Dir, in)))
+		}
+	}
+	for _, name := range []string{"symabis", "pgoprofile", "coveragecfg"} {
+		if v, ok := inv.Flag(name); ok {
+			add(v)
+		}
+	}
+	// asm がインクルードする、ソースと -I のディレクトリにある go_asm.h などのヘッダーファイル
+	for i, arg := range e.Args {
+		if arg == "-I" && i+1 < len(e.Args) {
+			includeDirs = append(includeDirs, abs(e.Dir, e.Args[i+1]))
+		}
+	}
+	// "cgo/abi_amd64.h" のようにサブディレクトリのヘッダーもインクルードされます
+	for _, dir := range includeDirs {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && filepath.Ext(path) == ".h" {
+				add(path)
+			}
+			return nil
+		})
+	}
+	if v, ok := inv.Flag("importcfg"); ok {
+		add(v)
+		if cfg, err := hook.ReadImportCfg(abs(e.Dir, v)); err == nil {
+			for _, file := range cfg.PackageFile {
+				add(file)
+			}
+		}
+	}
+	if v, ok := inv.Flag("embedcfg"); ok {
+		add(v)
+		if cfg, err := readEmbedCfg(abs(e.Dir, v)); err == nil {
+			for _, file := range cfg.Files {
+				add(file)
+			}
+		}
+	}
+	return paths
+}
+
+// embedCfg は compile の -embedcfg で渡される //go:embed の設定です
+type embedCfg struct {
+	Patterns map[string][]string
+	Files    map[string]string
+}
+
+func readEmbedCfg(path string) (*embedCfg, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg embedCfg
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// store はファイルを内容のハッシュを名前にして archive/files に保存します
+func (c *Config) store(path string) (string, error) {
+	sum, err := fileHash(path)
+	if err != nil {
+		return "", err
+	}
+	dst := filepath.Join(c.Archive, "files", sum)
+	if _, err := os.Stat(dst); err == nil {
+		return sum, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	tmp := fmt.Sprintf("%s.tmp%d", dst, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return "", err
+	}
+	return sum, os.Rename(tmp, dst)
+}
+
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func abs(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
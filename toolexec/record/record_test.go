@@ -0,0 +1,122 @@
+package record_test
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/record"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	tmp := t.TempDir()
+	logPath, archive := filepath.Join(tmp, "build.jsonl"), filepath.Join(tmp, "archive")
+	env := []string{"TOOLEXEC_CONFIG=" + buildtest.WriteConfig(t, `{"record": {"log": "`+filepath.ToSlash(logPath)+`", "archive": "`+filepath.ToSlash(archive)+`"}}`)}
+
+	// ビルドキャッシュが使われないように、実行ごとに異なるソースにします
+	dir := buildtest.WriteModule(t, map[string]string{
+		"main.go": `package main
+
+import "example.com/app/greet"
+
+func main() { println(greet.Hello()) }
+`,
+		"greet/greet.go": fmt.Sprintf("package greet\n\nfunc Hello() string { return %q }\n", time.Now().String()),
+	})
+	if out, err := buildtest.GoBuild(t, dir, wrapper, env, "-trimpath", "-o", "app", "."); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+
+	entries, err := record.ReadLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var compiles, links int
+	for _, e := range entries {
+		switch {
+		case e.Tool == "compile" && strings.HasPrefix(e.ImportPath, "example.com/app"):
+			compiles++
+		case e.Tool == "link":
+			links++
+			if e.ExitCode != 0 || len(e.Files) == 0 || e.Output == "" {
+				t.Errorf("unexpected link entry: %+v", e)
+			}
+		}
+	}
+	if compiles != 2 || links != 1 {
+		t.Fatalf("recorded %d compiles and %d links of example.com/app", compiles, links)
+	}
+
+	// $WORK は削除されていますが、保存した入力から go コマンドなしで再実行できます
+	replay := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command(wrapper, append([]string{"replay"}, args...)...)
+		cmd.Env = buildtest.Env()
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("replay %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return string(out)
+	}
+
+	out := replay("-pkg", "example.com/app/greet", "-tool", "compile", logPath)
+	if want := "compile example.com/app/greet: ok, output same as recorded"; strings.TrimSpace(out) != want {
+		t.Errorf("got %q; want %q", out, want)
+	}
+
+	out = replay(logPath)
+	if strings.Contains(out, "exit status") || !strings.Contains(out, "link example.com/app: ok, output same as recorded") {
+		t.Errorf("whole build is not replayed\n%s", out)
+	}
+
+	// ツールのフラグを変えると出力が変わります
+	out = replay("-pkg", "example.com/app/greet", "-tool", "compile", "-extra", "-N -l", logPath)
+	if !strings.Contains(out, "output differs from recorded") {
+		t.Errorf("extra flags are not applied\n%s", out)
+	}
+
+	script := replay("-script", "-tool", "compile", "-pkg", "example.com/app/greet", logPath)
+	if out, err := exec.Command("sh", "-c", script).CombinedOutput(); err != nil {
+		t.Errorf("script failed: %v\n%s\n%s", err, out, script)
+	}
+}
+
+// TestRecordTrace は trace が書き換えたソースも、一時ディレクトリが削除される前に保存されることを確かめます
+func TestRecordTrace(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	tmp := t.TempDir()
+	logPath, archive := filepath.Join(tmp, "build.jsonl"), filepath.Join(tmp, "archive")
+	env := []string{"TOOLEXEC_CONFIG=" + buildtest.WriteConfig(t, `{
+  "trace": {"packages": ["example.com/app/greet"], "cacheDir": "`+filepath.ToSlash(filepath.Join(tmp, "cache"))+`"},
+  "record": {"log": "`+filepath.ToSlash(logPath)+`", "archive": "`+filepath.ToSlash(archive)+`"}
+}`)}
+
+	dir := buildtest.WriteModule(t, map[string]string{
+		"main.go": `package main
+
+import "example.com/app/greet"
+
+func main() { println(greet.Hello()) }
+`,
+		"greet/greet.go": fmt.Sprintf("package greet\n\nfunc Hello() string { return %q }\n", time.Now().String()),
+	})
+	out, err := buildtest.GoBuild(t, dir, wrapper, env, "-o", "app", ".")
+	if err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+	if strings.Contains(out, "record:") {
+		t.Errorf("recording failed\n%s", out)
+	}
+
+	cmd := exec.Command(wrapper, "replay", "-pkg", "example.com/app/greet", "-tool", "compile", logPath)
+	cmd.Env = buildtest.Env()
+	got, err := cmd.CombinedOutput()
+	if want := "compile example.com/app/greet: ok, output same as recorded"; err != nil || strings.TrimSpace(string(got)) != want {
+		t.Errorf("replay: %v\n%s\nwant %q", err, got, want)
+	}
+}
@@ -0,0 +1,408 @@
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+)
+
+// ReadLog は記録したログを読み込みます
+func ReadLog(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 64*1024*1024)
+	for lineno := 1; s.Scan(); lineno++ {
+		var e Entry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineno, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, s.Err()
+}
+
+// Options は再実行の設定です
+type Options struct {
+	// Packages は再実行するパッケージのパターンです。省略時はすべてです
+	Packages []string
+	// Tools は再実行するツールの名前です。省略時はすべてです
+	Tools []string
+	// ToolDir は記録したツールの代わりに使うツールのディレクトリです。別のツールチェーンとの比較に使います
+	ToolDir string
+	// ExtraArgs は入力ファイルの直前に追加する引数です
+	ExtraArgs []string
+	// Root は保存した入力を展開するディレクトリです。省略時は一時ディレクトリを作り、終了後に削除します
+	Root string
+}
+
+// Select は opts に一致する記録を返します。記録は依存パッケージが先になるように終了順に並んでいます
+func Select(entries []Entry, opts *Options) []Entry {
+	var selected []Entry
+	for _, e := range entries {
+		inv := &hook.Invocation{Tool: e.Tool, Args: e.Args, ImportPath: e.ImportPath}
+		if len(opts.Packages) > 0 && !hook.MatchAny(opts.Packages, inv.Package()) {
+			continue
+		}
+		if len(opts.Tools) > 0 && !contains(opts.Tools, e.Tool) {
+			continue
+		}
+		selected = append(selected, e)
+	}
+	return selected
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Command は再実行するコマンドです
+type Command struct {
+	Entry *Entry
+	Dir   string
+	Path  string
+	Args  []string
+	Env   []string
+	// Output は -o の出力先です
+	Output string
+	// Pack はツールを実行する代わりに Output のアーカイブに追加するオブジェクトファイルです。
+	// go コマンドはアセンブリのオブジェクトをツールを使わずにアーカイブへ追加するため、記録には残りません。
+	Pack []string
+}
+
+// Prepare は記録からコマンドを作ります。記録に保存した入力がある場合は、
+// 元の絶対パスを Root の下に再現するように展開し、引数と importcfg のパスを書き換えます。
+// 返した cleanup は一時ディレクトリを削除します。
+func Prepare(entries []Entry, opts *Options) (cmds []Command, root string, cleanup func(), err error) {
+	cleanup = func() {}
+	archived := false
+	for _, e := range entries {
+		archived = archived || len(e.Files) > 0
+	}
+
+	var m *mapper
+	if archived {
+		root = opts.Root
+		if root == "" {
+			if root, err = os.MkdirTemp("", "replay"); err != nil {
+				return nil, "", cleanup, err
+			}
+			cleanup = func() { os.RemoveAll(root) }
+		}
+		m = newMapper(root, entries)
+		for i := range entries {
+			if err := m.restore(&entries[i]); err != nil {
+				cleanup()
+				return nil, "", func() {}, err
+			}
+		}
+	}
+
+	for i := range entries {
+		e := &entries[i]
+		cmd := Command{Entry: e, Dir: e.Dir, Path: e.ToolPath, Args: append([]string(nil), e.Args...), Env: e.Env}
+		if opts.ToolDir != "" {
+			cmd.Path = filepath.Join(opts.ToolDir, filepath.Base(e.ToolPath))
+		}
+		if m != nil {
+			cmd.Dir = m.path(e.Dir)
+			for j, arg := range cmd.Args {
+				cmd.Args[j] = m.arg(arg)
+			}
+		}
+		if len(opts.ExtraArgs) > 0 {
+			inv := &hook.Invocation{Args: cmd.Args}
+			inv.InsertArgs(opts.ExtraArgs...)
+			cmd.Args = inv.Args
+		}
+		if output, ok := (&hook.Invocation{Args: cmd.Args}).Flag("o"); ok {
+			cmd.Output = abs(cmd.Dir, output)
+		}
+		cmds = append(cmds, cmd)
+	}
+	return addPacks(cmds), root, cleanup, nil
+}
+
+// addPacks は compile -pack の後に、同じパッケージの asm の出力をアーカイブに追加するコマンドを挿入します
+func addPacks(cmds []Command) []Command {
+	var result []Command
+	pending := make(map[string]*Command)
+	for i := range cmds {
+		c := cmds[i]
+		result = append(result, c)
+
+		inv := &hook.Invocation{Args: c.Args}
+		switch {
+		case c.Entry.Tool == "compile" && inv.HasFlag("pack") && c.Output != "":
+			pending[c.Entry.ImportPath] = &Command{
+				Entry:  &Entry{Tool: "pack", ImportPath: c.Entry.ImportPath},
+				Dir:    c.Dir,
+				Output: c.Output,
+			}
+		case c.Entry.Tool == "asm" && !inv.HasFlag("gensymabis") && c.Output != "":
+			p := pending[c.Entry.ImportPath]
+			if p == nil || filepath.Dir(p.Output) != filepath.Dir(c.Output) {
+				continue
+			}
+			p.Pack = append(p.Pack, c.Output)
+			// 同じパッケージの asm が続く場合は最後の asm の後に追加します
+			if i+1 < len(cmds) && cmds[i+1].Entry.Tool == "asm" && cmds[i+1].Entry.ImportPath == c.Entry.ImportPath {
+				continue
+			}
+			result = append(result, *p)
+			delete(pending, c.Entry.ImportPath)
+		}
+	}
+	return result
+}
+
+// pack は go コマンドと同じ形式でオブジェクトファイルをアーカイブに追加します
+func pack(archive string, objects []string) error {
+	f, err := os.OpenFile(archive, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, obj := range objects {
+		data, err := os.ReadFile(obj)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		name := filepath.Base(obj)
+		if len(name) > 16 {
+			name = name[:16]
+		}
+		fmt.Fprintf(w, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, 0, 0, 0, 0o644, len(data))
+		w.Write(data)
+		if len(data)%2 != 0 {
+			w.WriteByte(0)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Result は再実行の結果です
+type Result struct {
+	Command  *Command
+	ExitCode int
+	// Same は出力が記録したときと同じかどうかです
+	Same bool
+}
+
+// Run はコマンドを順に実行します。ツールが失敗しても残りのコマンドを実行します
+func Run(cmds []Command, stdout, stderr io.Writer) []Result {
+	var results []Result
+	for i := range cmds {
+		c := &cmds[i]
+		if len(c.Pack) > 0 {
+			r := Result{Command: c}
+			if err := pack(c.Output, c.Pack); err != nil {
+				fmt.Fprintln(stderr, err)
+				r.ExitCode = -1
+			}
+			results = append(results, r)
+			continue
+		}
+		if c.Output != "" {
+			os.MkdirAll(filepath.Dir(c.Output), 0o755)
+		}
+		cmd := exec.Command(c.Path, c.Args...)
+		cmd.Dir = c.Dir
+		cmd.Env = append(os.Environ(), c.Env...)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+
+		r := Result{Command: c}
+		if err := cmd.Run(); err != nil {
+			r.ExitCode = -1
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				r.ExitCode = exitErr.ExitCode()
+			} else {
+				fmt.Fprintln(stderr, err)
+			}
+		}
+		if c.Output != "" && c.Entry.Output != "" {
+			sum, _ := fileHash(c.Output)
+			r.Same = sum == c.Entry.Output
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// WriteScript はコマンドをシェルスクリプトとして書き出します
+func WriteScript(w io.Writer, cmds []Command) error {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\nset -e\n")
+	for _, c := range cmds {
+		fmt.Fprintf(&b, "\n# %s %s\n", c.Entry.Tool, c.Entry.ImportPath)
+		if len(c.Pack) > 0 {
+			b.WriteString("go tool pack r")
+			for _, arg := range append([]string{c.Output}, c.Pack...) {
+				fmt.Fprintf(&b, " %s", shellQuote(arg))
+			}
+			b.WriteString("\n")
+			continue
+		}
+		if c.Output != "" {
+			fmt.Fprintf(&b, "mkdir -p %s\n", shellQuote(filepath.Dir(c.Output)))
+		}
+		fmt.Fprintf(&b, "(cd %s && env", shellQuote(c.Dir))
+		for _, kv := range c.Env {
+			fmt.Fprintf(&b, " %s", shellQuote(kv))
+		}
+		for _, arg := range append([]string{c.Path}, c.Args...) {
+			fmt.Fprintf(&b, " %s", shellQuote(arg))
+		}
+		b.WriteString(")\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=./,:+@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// mapper は記録したときの絶対パスを、展開先のディレクトリの下のパスに対応させます
+type mapper struct {
+	root string
+	// known は保存したファイル、出力ファイルと、それらの親ディレクトリです
+	known map[string]bool
+}
+
+func newMapper(root string, entries []Entry) *mapper {
+	m := &mapper{root: root, known: make(map[string]bool)}
+	add := func(path string) {
+		for ; !m.known[path]; path = filepath.Dir(path) {
+			m.known[path] = true
+			if path == filepath.Dir(path) {
+				break
+			}
+		}
+	}
+	for _, e := range entries {
+		add(e.Dir)
+		for path := range e.Files {
+			add(path)
+		}
+		if output, ok := (&hook.Invocation{Args: e.Args}).Flag("o"); ok {
+			add(abs(e.Dir, output))
+		}
+	}
+	return m
+}
+
+// path は保存したファイル、またはそれらと同じディレクトリのファイル（go_asm.h などの出力）であれば
+// 展開先のパスを返し、保存していないディレクトリのパスはそのまま返します
+func (m *mapper) path(p string) string {
+	if filepath.IsAbs(p) && (m.known[filepath.Clean(p)] || m.known[filepath.Dir(p)]) {
+		return filepath.Join(m.root, p)
+	}
+	return p
+}
+
+// arg は引数に含まれる絶対パスを書き換えます。-trimpath の "from=>to;..." も書き換えます
+func (m *mapper) arg(arg string) string {
+	if !strings.Contains(arg, "=>") {
+		return m.path(arg)
+	}
+	rules := strings.Split(arg, ";")
+	for i, r := range rules {
+		from, to, _ := strings.Cut(r, "=>")
+		rules[i] = m.path(from) + "=>" + to
+	}
+	return strings.Join(rules, ";")
+}
+
+// restore は記録の入力を展開し、importcfg と embedcfg に書かれたパスを書き換えます
+func (m *mapper) restore(e *Entry) error {
+	for path, sum := range e.Files {
+		dst := m.path(path)
+		if _, err := os.Stat(dst); err == nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(e.Archive, "files", sum))
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(dst, data, 0o644); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(m.path(e.Dir), 0o755); err != nil {
+		return err
+	}
+
+	inv := &hook.Invocation{Args: e.Args}
+	if v, ok := inv.Flag("importcfg"); ok {
+		if err := m.rewriteImportCfg(m.path(abs(e.Dir, v))); err != nil {
+			return err
+		}
+	}
+	if v, ok := inv.Flag("embedcfg"); ok {
+		if err := m.rewriteEmbedCfg(m.path(abs(e.Dir, v))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mapper) rewriteImportCfg(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		if rest, ok := strings.CutPrefix(line, "packagefile "); ok {
+			if pkg, file, ok := strings.Cut(rest, "="); ok {
+				lines[i] = "packagefile " + pkg + "=" + m.path(file)
+			}
+		}
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644)
+}
+
+func (m *mapper) rewriteEmbedCfg(path string) error {
+	cfg, err := readEmbedCfg(path)
+	if err != nil {
+		return err
+	}
+	for name, file := range cfg.Files {
+		cfg.Files[name] = m.path(file)
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
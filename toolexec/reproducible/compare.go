@@ -0,0 +1,209 @@
+package reproducible
+
+import (
+	"bytes"
+	"debug/elf"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+// Mismatch は2回の出力の最初の違いです
+type Mismatch struct {
+	// Offset はファイル先頭からの最初に異なるバイトの位置です
+	Offset int `json:"offset"`
+	// Member はアーカイブ（.a）の場合の異なるメンバー名です
+	Member string `json:"member,omitempty"`
+	// Section は ELF の場合の異なるセクション名です
+	Section string `json:"section,omitempty"`
+	// Symbol は ELF の場合の異なる位置を含むシンボル名です
+	Symbol string `json:"symbol,omitempty"`
+	// Causes は異なるバイトの周辺から推測した原因です
+	Causes []Cause `json:"causes"`
+}
+
+// Cause は推測した原因の識別子です。レポートに書き出すため、表示する言語によらず変わりません
+type Cause string
+
+const (
+	// CauseAbsolutePath は絶対パスが埋め込まれていることを表します
+	CauseAbsolutePath Cause = "absolute-path"
+	// CauseTimestamp は時刻が埋め込まれていることを表します
+	CauseTimestamp Cause = "timestamp"
+	// CauseReordered は同じバイト列が異なる順序で並んでいることを表します
+	CauseReordered Cause = "reordered"
+	// CauseNondeterministic はコード生成が決定的ではないことを表します
+	CauseNondeterministic Cause = "nondeterministic"
+)
+
+var causeMessages = map[Cause]msg.Key{
+	CauseAbsolutePath:     msg.CauseAbsolutePath,
+	CauseTimestamp:        msg.CauseTimestamp,
+	CauseReordered:        msg.CauseReordered,
+	CauseNondeterministic: msg.CauseNondeterministic,
+}
+
+// String は原因の説明を選ばれた言語で返します
+func (c Cause) String() string {
+	if key, ok := causeMessages[c]; ok {
+		return msg.Sprintf(key)
+	}
+	return string(c)
+}
+
+func (m *Mismatch) String() string {
+	var b strings.Builder
+	msg.Fprintf(&b, msg.MismatchOffset, m.Offset)
+	if m.Member != "" {
+		msg.Fprintf(&b, msg.MismatchMember, m.Member)
+	}
+	if m.Section != "" {
+		msg.Fprintf(&b, msg.MismatchSection, m.Section)
+	}
+	if m.Symbol != "" {
+		msg.Fprintf(&b, msg.MismatchSymbol, m.Symbol)
+	}
+	for _, c := range m.Causes {
+		msg.Fprintf(&b, msg.MismatchCause, c)
+	}
+	return b.String()
+}
+
+// Compare は2つの出力を比べ、同じであれば nil を返します。
+// ELF ファイルではセクションとシンボル、アーカイブではメンバーを求めます。
+func Compare(a, b []byte) *Mismatch {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	n := min(len(a), len(b))
+	offset := n
+	for i := range n {
+		if a[i] != b[i] {
+			offset = i
+			break
+		}
+	}
+
+	m := &Mismatch{Offset: offset}
+	switch {
+	case bytes.HasPrefix(a, []byte("\x7fELF")):
+		m.Section, m.Symbol = elfLocation(a, offset)
+	case bytes.HasPrefix(a, []byte("!<arch>\n")):
+		m.Member = arMember(a, offset)
+	}
+	m.Causes = guessCauses(a, b, offset)
+	return m
+}
+
+// elfLocation は offset を含むセクションと、そのアドレスを含むシンボルを求めます
+func elfLocation(data []byte, offset int) (section, symbol string) {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+
+	var sec *elf.Section
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_NOBITS && uint64(offset) >= s.Offset && uint64(offset) < s.Offset+s.FileSize {
+			sec = s
+			break
+		}
+	}
+	if sec == nil {
+		// ELF ヘッダーやプログラムヘッダーなど、セクションの外側です
+		return "(headers)", ""
+	}
+
+	addr := sec.Addr + uint64(offset) - sec.Offset
+	syms, _ := f.Symbols()
+	for _, sym := range syms {
+		if int(sym.Section) < len(f.Sections) && f.Sections[sym.Section] == sec && addr >= sym.Value && addr < sym.Value+sym.Size {
+			return sec.Name, sym.Name
+		}
+	}
+	return sec.Name, ""
+}
+
+// arMember は Unix ar 形式のアーカイブで offset を含むメンバーの名前を返します
+func arMember(data []byte, offset int) string {
+	const header = 60
+	pos := len("!<arch>\n")
+	for pos+header <= len(data) {
+		name := strings.TrimRight(string(data[pos:pos+16]), " /")
+		size, err := strconv.Atoi(strings.TrimSpace(string(data[pos+48 : pos+58])))
+		if err != nil {
+			return ""
+		}
+		end := pos + header + size
+		if offset < end {
+			return name
+		}
+		pos = end + end%2
+	}
+	return ""
+}
+
+var (
+	stringRe = regexp.MustCompile(`[[:print:]]{4,}`)
+	timeRe   = regexp.MustCompile(`\d{4}-\d{2}-\d{2}|\d{2}:\d{2}:\d{2}|\b1\d{9}\b`)
+)
+
+// guessCauses は異なるバイトの周辺にある文字列から原因を推測します
+func guessCauses(a, b []byte, offset int) []Cause {
+	const before, after = 64, 256
+	window := func(data []byte) []byte {
+		return data[max(0, offset-before):min(len(data), offset+after)]
+	}
+	wa, wb := window(a), window(b)
+
+	var causes []Cause
+	sa, sb := stringRe.FindAll(wa, -1), stringRe.FindAll(wb, -1)
+	differs := func(match func([]byte) bool) bool {
+		var xa, xb [][]byte
+		for _, s := range sa {
+			if match(s) {
+				xa = append(xa, s)
+			}
+		}
+		for _, s := range sb {
+			if match(s) {
+				xb = append(xb, s)
+			}
+		}
+		return !bytes.Equal(bytes.Join(xa, nil), bytes.Join(xb, nil))
+	}
+	if differs(func(s []byte) bool { return bytes.Contains(s, []byte("/")) || bytes.Contains(s, []byte(`:\`)) }) {
+		causes = append(causes, CauseAbsolutePath)
+	}
+	if differs(timeRe.Match) {
+		causes = append(causes, CauseTimestamp)
+	}
+	if len(causes) == 0 {
+		if len(a) == len(b) && sameBytes(wa, wb) {
+			causes = append(causes, CauseReordered)
+		} else {
+			causes = append(causes, CauseNondeterministic)
+		}
+	}
+	return causes
+}
+
+// sameBytes は2つのバイト列が並び順だけ異なるかどうかを返します
+func sameBytes(a, b []byte) bool {
+	var count [256]int
+	for _, c := range a {
+		count[c]++
+	}
+	for _, c := range b {
+		count[c]--
+	}
+	for _, n := range count {
+		if n != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+// Package reproducible は compile と link を2回実行し、出力が同じになるかどうかを確かめます。
+//
+// 設定例:
+//
+//	{
+//	  "reproducible": {
+//	    "packages": ["example.com/app/..."],
+//	    "fail": true
+//	  }
+//	}
+//
+// 対象パッケージの compile と link を通常どおり実行した後、-o だけを一時ファイルに変えてもう一度実行し、
+// 2つの出力をバイト単位で比べます。異なる場合は最初に異なるセクションとシンボル（アーカイブの場合はメンバー）と、
+// 周辺のバイトから推測した原因（絶対パス、時刻、マップの反復順序など）を表示します。
+// ビルドの出力には1回目の結果を使います。fail が true の場合は違いがあるとビルドを失敗させます。
+package reproducible
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+// Config は再現性の確認の設定です
+type Config struct {
+	// Packages は確認するパッケージのパターンです
+	Packages []string `json:"packages"`
+	// Fail が true の場合は出力が異なるとビルドを失敗させます
+	Fail bool `json:"fail"`
+}
+
+// Hook は compile と link を2回実行して出力を比べます
+func Hook(c *Config) hook.Hook {
+	return hook.Hook{
+		Name: "reproducible",
+		Wrap: func(inv *hook.Invocation, run func() error) error {
+			if (inv.Tool != "compile" && inv.Tool != "link") || !hook.MatchAny(c.Packages, inv.Package()) {
+				return run()
+			}
+			if err := run(); err != nil {
+				return err
+			}
+
+			m, err := Check(inv)
+			if err != nil {
+				return fmt.Errorf("reproducible: %w", err)
+			}
+			if m == nil {
+				return nil
+			}
+			if c.Fail {
+				return fmt.Errorf("reproducible: %s", msg.Sprintf(msg.NotReproducible, inv.Tool, inv.ImportPath, m))
+			}
+			fmt.Fprintf(inv.Stderr, "[TOOLEXEC] reproducible: %s\n", msg.Sprintf(msg.NotReproducible, inv.Tool, inv.ImportPath, m))
+			return nil
+		},
+	}
+}
+
+// Check はツールを出力先だけ変えてもう一度実行し、既に出力されたファイルと比べます
+func Check(inv *hook.Invocation) (*Mismatch, error) {
+	// go コマンドは出力先を "-o path" の形式で渡します
+	o := indexOf(inv.Args, "-o")
+	if o < 0 || o+1 >= len(inv.Args) {
+		return nil, fmt.Errorf("%s: -o not found", inv.Tool)
+	}
+	first, err := os.ReadFile(inv.Args[o+1])
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp("", "reproducible")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	// 出力先と go_asm.h などの付随する出力ファイルを一時ディレクトリに変えます
+	args := append([]string(nil), inv.Args...)
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "-o", "-asmhdr", "-linkobj", "-dumpdep":
+			args[i+1] = filepath.Join(tmp, fmt.Sprintf("%d-%s", i, filepath.Base(args[i+1])))
+		}
+	}
+	secondPath := args[o+1]
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(inv.ToolPath, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("second %s failed: %w\n%s", inv.Tool, err, stderr.Bytes())
+	}
+	second, err := os.ReadFile(secondPath)
+	if err != nil {
+		return nil, err
+	}
+	return Compare(first, second), nil
+}
+
+func indexOf(args []string, s string) int {
+	for i, arg := range args {
+		if arg == s {
+			return i
+		}
+	}
+	return -1
+}
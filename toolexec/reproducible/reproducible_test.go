@@ -0,0 +1,82 @@
+package reproducible_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/reproducible"
+)
+
+func TestHook(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	env := []string{"TOOLEXEC_CONFIG=" + buildtest.WriteConfig(t, `{"reproducible": {"packages": ["example.com/app/..."], "fail": true}}`)}
+	dir := buildtest.WriteModule(t, map[string]string{
+		"main.go": `package main
+
+import "example.com/app/table"
+
+func main() { println(len(table.Names)) }
+`,
+		"table/table.go": `package table
+
+var Names = map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+`,
+	})
+
+	out, err := buildtest.GoBuild(t, dir, wrapper, env, "-a", "-o", "app", ".")
+	if err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+	if strings.Contains(out, "not reproducible") {
+		t.Errorf("unexpected report\n%s", out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app")); err != nil {
+		t.Errorf("normal output is not produced: %v", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping build test in short mode")
+	}
+	dir := buildtest.WriteModule(t, map[string]string{
+		"main.go": "package main\n\nvar stamp = \"\"\n\nfunc main() { println(stamp) }\n",
+	})
+	build := func(stamp string) []byte {
+		t.Helper()
+		// ビルドIDは -X の値によって変わるため、空にして値の違いだけを比べます
+		out, err := buildtest.GoBuild(t, dir, "", nil, "-o", "app", "-ldflags=-buildid= -X main.stamp="+stamp, ".")
+		if err != nil {
+			t.Fatalf("go build failed: %v\n%s", err, out)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "app"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	if m := reproducible.Compare(build("same"), build("same")); m != nil {
+		t.Errorf("same builds differ: %s", m)
+	}
+
+	for _, tt := range []struct {
+		a, b  string
+		cause reproducible.Cause
+	}{
+		{"2025-09-27T10:00:00Z", "2025-09-27T11:00:00Z", reproducible.CauseTimestamp},
+		{"/home/alice/src/app", "/home/bobby/src/app", reproducible.CauseAbsolutePath},
+	} {
+		m := reproducible.Compare(build(tt.a), build(tt.b))
+		if m == nil {
+			t.Fatalf("%s and %s are not different", tt.a, tt.b)
+		}
+		if m.Section != ".rodata" || !slices.Contains(m.Causes, tt.cause) {
+			t.Errorf("%s vs %s: unexpected mismatch: %s", tt.a, tt.b, m)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package sbom
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// goCommandArgs は link を起動した go コマンドの引数を返します。
+// -toolexec のラッパーは go コマンドから直接起動されるため、親プロセスのコマンドラインを読みます
+func goCommandArgs() []string {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(os.Getppid()) + "/cmdline")
+	if err != nil {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00")
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package sbom
+
+// goCommandArgs は親プロセスの引数を読めない OS では nil を返します
+func goCommandArgs() []string {
+	return nil
+}
@@ -0,0 +1,254 @@
+// Package sbom は link 時に実際にリンクされたモジュールから CycloneDX 形式の SBOM を作ります。
+//
+// 設定例:
+//
+//	{
+//	  "sbom": {
+//	    "enabled": true,
+//	    "dir": "/path/to/bin"
+//	  }
+//	}
+//
+// link の出力先は go コマンドの作業ディレクトリ（$WORK）の一時ファイルで、
+// go build -o で指定した最終的な出力先は link には渡されません。
+// そのため link を起動した go コマンドの引数から -o を読み、バイナリの隣に "<バイナリ名>.cdx.json" を書き出します。
+// -o がディレクトリの場合はそのディレクトリに、-o がない場合は go コマンドを実行したディレクトリに書き出します。
+// go コマンドの引数を読めるのは Linux だけで、ほかの OS では常に go コマンドを実行したディレクトリです。
+// dir を指定した場合は -o にかかわらず dir に書き出します。
+// go test がテストバイナリをリンクするときは SBOM を作りません。
+package sbom
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/atomicfile"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/linkdeps"
+)
+
+// Config は SBOM の生成の設定です
+type Config struct {
+	Enabled bool `json:"enabled"`
+	// Dir は SBOM を書き出すディレクトリです。省略時はバイナリの隣に書き出します
+	Dir string `json:"dir"`
+}
+
+// BOM は CycloneDX 1.5 の JSON 形式の SBOM です。このラッパーで使うフィールドだけを定義しています
+type BOM struct {
+	BOMFormat    string       `json:"bomFormat"`
+	SpecVersion  string       `json:"specVersion"`
+	SerialNumber string       `json:"serialNumber"`
+	Version      int          `json:"version"`
+	Metadata     Metadata     `json:"metadata"`
+	Components   []Component  `json:"components"`
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+type Metadata struct {
+	Timestamp string    `json:"timestamp"`
+	Tools     Tools     `json:"tools"`
+	Component Component `json:"component"`
+}
+
+type Tools struct {
+	Components []Component `json:"components"`
+}
+
+type Component struct {
+	Type       string     `json:"type"`
+	BOMRef     string     `json:"bom-ref,omitempty"`
+	Name       string     `json:"name"`
+	Version    string     `json:"version,omitempty"`
+	PURL       string     `json:"purl,omitempty"`
+	Properties []Property `json:"properties,omitempty"`
+}
+
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Dependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// Generate はリンクされたモジュールから SBOM を作ります。
+// now は SOURCE_DATE_EPOCH が設定されていない場合の生成時刻です。
+func Generate(r *linkdeps.Result, name string, now time.Time) *BOM {
+	mainComp := Component{Type: "application", Name: name}
+	if r.Main.Path != "" {
+		mainComp = moduleComponent("application", r.Main)
+	}
+	if mainComp.BOMRef == "" {
+		mainComp.BOMRef = "pkg:golang/" + name
+	}
+
+	bom := &BOM{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: Metadata{
+			Timestamp: timestamp(now).UTC().Format(time.RFC3339),
+			Tools: Tools{Components: []Component{{
+				Type: "application",
+				Name: "github.com/newmo-oss/gocon25-workshop/toolexec/cmd/wrapper",
+			}}},
+			Component: mainComp,
+		},
+	}
+
+	deps := Dependency{Ref: mainComp.BOMRef, DependsOn: []string{}}
+	if len(r.Std) > 0 {
+		std := Component{
+			Type:    "library",
+			BOMRef:  "pkg:golang/std@" + r.GoVersion,
+			Name:    "std",
+			Version: r.GoVersion,
+			PURL:    "pkg:golang/std@" + r.GoVersion,
+			Properties: []Property{
+				{Name: "go:packages", Value: strings.Join(r.Std, " ")},
+			},
+		}
+		bom.Components = append(bom.Components, std)
+		deps.DependsOn = append(deps.DependsOn, std.BOMRef)
+	}
+	for _, m := range r.Modules {
+		c := moduleComponent("library", m)
+		bom.Components = append(bom.Components, c)
+		deps.DependsOn = append(deps.DependsOn, c.BOMRef)
+	}
+	bom.Dependencies = []Dependency{deps}
+
+	// 同じ内容からは同じシリアル番号になるように、内容のハッシュから UUID を作ります
+	data, _ := json.Marshal(bom.Components)
+	sum := sha256.Sum256(append([]byte(mainComp.BOMRef), data...))
+	sum[6] = sum[6]&0x0f | 0x50 // version 5
+	sum[8] = sum[8]&0x3f | 0x80 // variant RFC 4122
+	bom.SerialNumber = fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+
+	return bom
+}
+
+func moduleComponent(typ string, m linkdeps.Module) Component {
+	path, version, sum := m.Path, m.Version, m.Sum
+	var props []Property
+	if m.Replace != nil {
+		props = append(props, Property{Name: "go:replace", Value: strings.TrimSpace(m.Replace.Path + " " + m.Replace.Version)})
+		if m.Replace.Version != "" {
+			path, version = m.Replace.Path, m.Replace.Version
+		}
+	}
+	// go.sum の h1 はモジュールのファイルの一覧から作ったハッシュ（dirhash）で、
+	// 配布物のハッシュではないため CycloneDX の hashes ではなくプロパティとして記録します
+	if sum != "" {
+		props = append(props, Property{Name: "go:sum", Value: sum})
+	}
+	if len(m.Packages) > 0 {
+		props = append(props, Property{Name: "go:packages", Value: strings.Join(m.Packages, " ")})
+	}
+
+	purl := "pkg:golang/" + path
+	if version != "" && version != "(devel)" {
+		purl += "@" + version
+	}
+	return Component{
+		Type:       typ,
+		BOMRef:     purl,
+		Name:       m.Path,
+		Version:    version,
+		PURL:       purl,
+		Properties: props,
+	}
+}
+
+// timestamp は再現可能なビルドのために SOURCE_DATE_EPOCH が設定されていればその時刻を使います
+func timestamp(now time.Time) time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0)
+	}
+	return now
+}
+
+var majorVersionRe = regexp.MustCompile(`^v[0-9]+$`)
+
+// BinaryName は go build がメインパッケージから付けるバイナリ名を返します。
+// example.com/cmd/server/v2 のようにメジャーバージョンで終わる場合はその前の要素を使います。
+func BinaryName(importPath string) string {
+	name := path.Base(importPath)
+	if majorVersionRe.MatchString(name) && path.Dir(importPath) != "." {
+		name = path.Base(path.Dir(importPath))
+	}
+	return name
+}
+
+// OutputPath は go コマンドの引数 args の -o から SBOM を書き出すパスを返します。
+// -o がファイルの場合はその隣の "<ファイル名>.cdx.json"、ディレクトリの場合はその中の "<name>.cdx.json" です。
+// go build 以外の場合や -o がない場合は作業ディレクトリの "<name>.cdx.json" です。
+func OutputPath(args []string, name string) string {
+	if len(args) < 2 || args[1] != "build" {
+		return name + ".cdx.json"
+	}
+	o := ""
+	for i := 2; i < len(args) && args[i] != "--"; i++ {
+		// go コマンドのフラグは -o と --o のどちらでも指定できます
+		arg := args[i]
+		if strings.HasPrefix(arg, "--") {
+			arg = arg[1:]
+		}
+		if v, ok := strings.CutPrefix(arg, "-o="); ok {
+			o = v
+		} else if arg == "-o" && i+1 < len(args) {
+			o = args[i+1]
+			i++
+		}
+	}
+	if o == "" {
+		return name + ".cdx.json"
+	}
+	// go build と同じく、末尾が区切り文字か既存のディレクトリならディレクトリとして扱います
+	if strings.HasSuffix(o, "/") || strings.HasSuffix(o, string(filepath.Separator)) {
+		return filepath.Join(o, name+".cdx.json")
+	}
+	if fi, err := os.Stat(o); err == nil && fi.IsDir() {
+		return filepath.Join(o, name+".cdx.json")
+	}
+	return o + ".cdx.json"
+}
+
+// Hook は link の後に SBOM を書き出します
+func Hook(c *Config) hook.Hook {
+	return hook.Hook{
+		Name: "sbom",
+		After: func(inv *hook.Invocation) error {
+			if !c.Enabled || inv.Tool != "link" || inv.Kind() == hook.KindTestLink {
+				return nil
+			}
+
+			r, err := linkdeps.Load(inv)
+			if err != nil {
+				return err
+			}
+			name := BinaryName(inv.ImportPath)
+			bom := Generate(r, name, time.Now())
+
+			file := filepath.Join(c.Dir, name+".cdx.json")
+			if c.Dir == "" {
+				file = OutputPath(goCommandArgs(), name)
+			}
+			if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+				return err
+			}
+			return atomicfile.WriteJSON(file, bom)
+		},
+	}
+}
@@ -0,0 +1,163 @@
+package sbom_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/sbom"
+)
+
+func TestHook(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	out := t.TempDir()
+	env := []string{
+		"TOOLEXEC_CONFIG=" + buildtest.WriteConfig(t, `{"sbom": {"enabled": true, "dir": "`+filepath.ToSlash(out)+`"}}`),
+		"SOURCE_DATE_EPOCH=1700000000",
+	}
+
+	dir := buildtest.WriteModule(t, map[string]string{
+		"go.mod": `module example.com/app
+
+go 1.25
+
+require (
+	golang.org/x/mod v0.28.0
+	golang.org/x/sync v0.17.0
+)
+`,
+		"go.sum": `golang.org/x/mod v0.28.0 h1:gQBtGhjxykdjY9YhZpSlZIsbnaE2+PgjfLWUQTnoZ1U=
+golang.org/x/mod v0.28.0/go.mod h1:yfB/L0NOf/kmEbXjzCPOx1iK1fRutOydrCMsqRhEBxI=
+golang.org/x/sync v0.17.0 h1:l60nONMj9l5drqw6jlhIELNv9I0A4OFgRsG9k2oT9Ug=
+golang.org/x/sync v0.17.0/go.mod h1:9KTHXmSnoGruLpwFjVSX0lNNA75CykiMECbovNTZqGI=
+`,
+		"main.go": `package main
+
+import "golang.org/x/mod/semver"
+
+func main() { println(semver.IsValid("v1.0.0")) }
+`,
+		// ビルドタグで除外されるファイルだけが x/sync をインポートします
+		"never.go": `//go:build never
+
+package main
+
+import _ "golang.org/x/sync/errgroup"
+`,
+	})
+	if out, err := buildtest.GoBuild(t, dir, wrapper, env, "-o", "app", "."); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+
+	data, err := os.ReadFile(filepath.Join(out, "app.cdx.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bom sbom.BOM
+	if err := json.Unmarshal(data, &bom); err != nil {
+		t.Fatal(err)
+	}
+
+	if bom.BOMFormat != "CycloneDX" || bom.Metadata.Component.Name != "example.com/app" {
+		t.Errorf("unexpected metadata: %+v", bom.Metadata)
+	}
+	if bom.Metadata.Timestamp != "2023-11-14T22:13:20Z" {
+		t.Errorf("timestamp = %s; want SOURCE_DATE_EPOCH", bom.Metadata.Timestamp)
+	}
+
+	comps := make(map[string]sbom.Component)
+	for _, c := range bom.Components {
+		comps[c.Name] = c
+	}
+	mod, ok := comps["golang.org/x/mod"]
+	if !ok {
+		t.Fatalf("golang.org/x/mod is not in SBOM: %+v", bom.Components)
+	}
+	if mod.PURL != "pkg:golang/golang.org/x/mod@v0.28.0" {
+		t.Errorf("purl = %s", mod.PURL)
+	}
+	// go.sum の h1 はアーティファクトのハッシュではないため、プロパティとして記録します
+	if !slices.Contains(mod.Properties, sbom.Property{Name: "go:sum", Value: "h1:gQBtGhjxykdjY9YhZpSlZIsbnaE2+PgjfLWUQTnoZ1U="}) {
+		t.Errorf("go:sum property is not recorded: %+v", mod.Properties)
+	}
+	if _, ok := comps["golang.org/x/sync"]; ok {
+		t.Errorf("golang.org/x/sync is excluded by build tag but in SBOM")
+	}
+	if std, ok := comps["std"]; !ok || !strings.HasPrefix(std.Version, "go") {
+		t.Errorf("std is not in SBOM with Go version: %+v", std)
+	}
+}
+
+func TestDefaultDir(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	env := []string{"TOOLEXEC_CONFIG=" + buildtest.WriteConfig(t, `{"sbom": {"enabled": true}}`)}
+	dir := buildtest.WriteModule(t, map[string]string{
+		"main.go":      "package main\n\nfunc main() {}\n",
+		"main_test.go": "package main\n\nimport \"testing\"\n\nfunc TestMain(t *testing.T) {}\n",
+	})
+
+	// dir を省略すると go コマンドを実行したディレクトリに書き出します
+	if out, err := buildtest.GoBuild(t, dir, wrapper, env, "-o", "app", "."); err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app.cdx.json")); err != nil {
+		t.Error(err)
+	}
+
+	// -o を指定するとバイナリの隣に書き出します
+	if runtime.GOOS == "linux" {
+		for _, tt := range []struct{ o, want string }{
+			{"bin/", "bin/app.cdx.json"},
+			{"bin/server", "bin/server.cdx.json"},
+		} {
+			if out, err := buildtest.GoBuild(t, dir, wrapper, env, "-o", tt.o, "."); err != nil {
+				t.Fatalf("go build -o %s failed: %v\n%s", tt.o, err, out)
+			}
+			if _, err := os.Stat(filepath.Join(dir, tt.want)); err != nil {
+				t.Errorf("go build -o %s: %v", tt.o, err)
+			}
+		}
+	}
+
+	// テストバイナリの SBOM は書き出しません
+	if out, err := buildtest.GoTest(t, dir, wrapper, env, "./..."); err != nil {
+		t.Fatalf("go test failed: %v\n%s", err, out)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.test.cdx.json")); len(files) > 0 {
+		t.Errorf("SBOM is written for test binaries: %v", files)
+	}
+}
+
+func TestBinaryName(t *testing.T) {
+	for path, want := range map[string]string{
+		"example.com/cmd/server":    "server",
+		"example.com/cmd/server/v2": "server",
+		"example.com/app":           "app",
+	} {
+		if got := sbom.BinaryName(path); got != want {
+			t.Errorf("BinaryName(%q) = %q; want %q", path, got, want)
+		}
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"go", "build", "."}, "app.cdx.json"},
+		{[]string{"go", "build", "-o", "bin/server", "."}, "bin/server.cdx.json"},
+		{[]string{"go", "build", "--o=bin/server", "."}, "bin/server.cdx.json"},
+		{[]string{"go", "build", "-o", "bin/", "./..."}, "bin/app.cdx.json"},
+		{[]string{"go", "test", "-c", "-o", "app.test", "."}, "app.cdx.json"},
+	} {
+		if got := sbom.OutputPath(tt.args, "app"); got != filepath.FromSlash(tt.want) {
+			t.Errorf("OutputPath(%q) = %q; want %q", tt.args, got, tt.want)
+		}
+	}
+}
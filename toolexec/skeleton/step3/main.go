@@ -48,15 +48,16 @@ func main() {
 			compileShown = true
 
 			// TODO: コンパイル中のプログレスバーを表示
-			// ヒント: showProgress("コンパイル中", 1*time.Second)
+			// ヒント: showProgress(msg.Sprintf(msg.Compiling), 1*time.Second)
 		}
 
 	case "link":
 		// TODO: リンク中のプログレスバーを表示
-		// ヒント: showProgress("リンク中", 500*time.Millisecond)
+		// ヒント: showProgress(msg.Sprintf(msg.Linking), 500*time.Millisecond)
 
 		// TODO: ビルド完了メッセージを表示
-		// ヒント: fmt.Fprintln(os.Stderr, "\n🎉 ビルド完了！")
+		// ヒント: fmt.Fprintln(os.Stderr, "\n"+msg.Sprintf(msg.BuildDone))
+		// msg は "github.com/newmo-oss/gocon25-workshop/toolexec/msg" で、LANG に合わせて "コンパイル中" や "Compiling" を選びます
 	}
 
 	// 元のツールの実行
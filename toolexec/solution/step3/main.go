@@ -6,6 +6,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
 )
 
 // Gopher のASCIIアート
@@ -31,6 +33,14 @@ $;jMN<;?|,WH3       $;:t.MM#       ,(;;jP;;?|
 var compileShown bool // compile時にGopherを表示したかどうかのフラグ
 
 func main() {
+	// -toolexec="mytoolexec -lang=en" のように表示する言語を指定できます
+	args, err := msg.ParseFlag(os.Args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	os.Args = args
+
 	if len(os.Args) < 2 {
 		os.Exit(1)
 	}
@@ -48,15 +58,15 @@ func main() {
 			compileShown = true
 
 			// コンパイル中のプログレスバーを表示
-			showProgress("コンパイル中", 1*time.Second)
+			showProgress(msg.Sprintf(msg.Compiling), 1*time.Second)
 		}
 
 	case "link":
 		// リンク中のプログレスバーを表示
-		showProgress("リンク中", 500*time.Millisecond)
+		showProgress(msg.Sprintf(msg.Linking), 500*time.Millisecond)
 
 		// ビルド完了メッセージを表示
-		fmt.Fprintln(os.Stderr, "\n🎉 ビルド完了！")
+		fmt.Fprintln(os.Stderr, "\n"+msg.Sprintf(msg.BuildDone))
 	}
 
 	// 元のツールの実行
@@ -64,8 +74,7 @@ func main() {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	err := cmd.Run()
-	if err != nil {
+	if err := cmd.Run(); err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			os.Exit(exitErr.ExitCode())
 		}
@@ -0,0 +1,182 @@
+// Package supervise はツールごとのタイムアウトとメモリの上限を設定し、
+// ツールを終了させた場合に診断レポートを書き出します。
+//
+// 設定例:
+//
+//	{
+//	  "supervise": {
+//	    "timeouts": {"compile": "2m", "link": "5m"},
+//	    "memory": {"compile": "4GiB", "link": "8GiB"},
+//	    "reportDir": "/tmp/toolexec-reports"
+//	  }
+//	}
+//
+// ツールは独立したプロセスグループで起動し、ラッパーが受け取った SIGINT と SIGTERM はそのグループに転送します（hook.Invocation.Run）。
+// タイムアウトを過ぎたツール、シグナルで終了したツールについては、引数と資源の使用量を
+// reportDir（省略時は一時ディレクトリの toolexec-reports）に JSON で書き出します。
+// memory は RLIMIT_AS による仮想メモリの上限で、Linux だけで使えます。
+// 上限はツールを exec する前に設定するため、ツールの起動直後から有効で、ツールが起動する子プロセスにも引き継がれます。
+package supervise
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/msg"
+)
+
+// Config はツールの監視の設定です
+type Config struct {
+	// Timeouts はツール名ごとのタイムアウト（time.ParseDuration の形式）です
+	Timeouts map[string]string `json:"timeouts"`
+	// Memory はツール名ごとの仮想メモリの上限（"512MiB", "4GiB" またはバイト数）です
+	Memory map[string]string `json:"memory"`
+	// ReportDir は診断レポートを書き出すディレクトリです
+	ReportDir string `json:"reportDir"`
+}
+
+// Report はラッパーが終了させた、またはシグナルで終了したツールの診断レポートです
+type Report struct {
+	Time       time.Time   `json:"time"`
+	Tool       string      `json:"tool"`
+	ImportPath string      `json:"importPath"`
+	Argv       []string    `json:"argv"`
+	Dir        string      `json:"dir"`
+	Reason     string      `json:"reason"`
+	Signal     string      `json:"signal,omitempty"`
+	ExitCode   int         `json:"exitCode"`
+	Limits     hook.Limits `json:"limits"`
+	Usage      hook.Usage  `json:"usage"`
+	// Error はフックやツールの起動のエラーです
+	Error string `json:"error,omitempty"`
+}
+
+// Limits は tool に適用する制限を返します
+func (c *Config) Limits(tool string) (hook.Limits, error) {
+	var l hook.Limits
+	if s, ok := c.Timeouts[tool]; ok {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return l, msg.Errorf(msg.SuperviseTimeout, tool, err)
+		}
+		l.Timeout = d
+	}
+	if s, ok := c.Memory[tool]; ok {
+		n, err := ParseSize(s)
+		if err != nil {
+			return l, msg.Errorf(msg.SuperviseMemory, tool, err)
+		}
+		l.Memory = n
+	}
+	return l, nil
+}
+
+var sizeUnits = []struct {
+	suffix string
+	n      uint64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"B", 1},
+}
+
+// ParseSize は "512MiB" や "4GB" のようなサイズをバイト数にします
+func ParseSize(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	mult := uint64(1)
+	for _, u := range sizeUnits {
+		if num, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, mult = strings.TrimSpace(num), u.n
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, msg.Errorf(msg.SuperviseInvalidSize, s)
+	}
+	return uint64(n * float64(mult)), nil
+}
+
+// Hook はツールの実行前に制限を設定し、終了させたツールの診断レポートを書き出します
+func Hook(c *Config) hook.Hook {
+	return hook.Hook{
+		Name: "supervise",
+		Before: func(inv *hook.Invocation) error {
+			l, err := c.Limits(inv.Tool)
+			if err != nil {
+				return err
+			}
+			inv.Limits = l
+			return nil
+		},
+		Finish: func(inv *hook.Invocation, err error) {
+			r := NewReport(inv, err)
+			if r == nil {
+				return
+			}
+			path, werr := c.write(r)
+			if werr != nil {
+				fmt.Fprintf(inv.Stderr, "[TOOLEXEC] supervise: %s\n", msg.Sprintf(msg.SuperviseReportFailed, inv.Tool, inv.ImportPath, r.Reason, werr))
+				return
+			}
+			fmt.Fprintf(inv.Stderr, "[TOOLEXEC] supervise: %s\n", msg.Sprintf(msg.SuperviseReport, inv.Tool, inv.ImportPath, r.Reason, path))
+		},
+	}
+}
+
+// NewReport はツールをラッパーが終了させたか、ツールがシグナルで終了した場合にレポートを作ります。それ以外は nil です
+func NewReport(inv *hook.Invocation, err error) *Report {
+	ps := inv.ProcessState
+	if ps == nil {
+		return nil
+	}
+	r := &Report{
+		Time:       time.Now(),
+		Tool:       inv.Tool,
+		ImportPath: inv.ImportPath,
+		Argv:       append([]string{inv.ToolPath}, inv.Args...),
+		Reason:     inv.Killed,
+		ExitCode:   ps.ExitCode(),
+		Limits:     inv.Limits,
+		Usage:      hook.ResourceUsage(ps),
+	}
+	r.Dir, _ = os.Getwd()
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		r.Signal = ws.Signal().String()
+		if r.Reason == "" {
+			r.Reason = msg.Sprintf(msg.SuperviseKilledBy, r.Signal)
+		}
+	}
+	if r.Reason == "" {
+		return nil
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// write はレポートを書き出してそのパスを返します
+func (c *Config) write(r *Report) (string, error) {
+	dir := c.ReportDir
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "toolexec-reports")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s-%s-%s.json", r.Tool, strings.NewReplacer("/", "_", " ", "_", "[", "", "]", "").Replace(r.ImportPath), r.Time.Format("20060102T150405.000000000"))
+	path := filepath.Join(dir, name)
+	return path, os.WriteFile(path, append(data, '\n'), 0o644)
+}
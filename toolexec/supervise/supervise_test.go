@@ -0,0 +1,202 @@
+package supervise_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/supervise"
+)
+
+// fakeTool は長時間動き続けるなどの振る舞いをする compile の代わりのツールです
+const fakeTool = `package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"time"
+)
+
+func main() {
+	switch os.Args[1] {
+	case "cat":
+		io.Copy(os.Stdout, os.Stdin)
+	case "sleep":
+		// 孫プロセスも同じプロセスグループで終了させられることを確かめます
+		child := exec.Command(os.Args[0], "sleep-only")
+		if err := child.Start(); err != nil {
+			panic(err)
+		}
+		fmt.Println("child", child.Process.Pid)
+		time.Sleep(time.Hour)
+	case "sleep-only":
+		time.Sleep(time.Hour)
+	case "trap":
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		fmt.Println("ready")
+		<-sig
+		fmt.Println("interrupted")
+		os.Exit(3)
+	case "alloc":
+		n, _ := strconv.Atoi(os.Args[2])
+		b := make([]byte, n<<20)
+		for i := 0; i < len(b); i += 4096 {
+			b[i] = 1
+		}
+		fmt.Println("allocated", len(b))
+	}
+}
+`
+
+type env struct {
+	wrapper, tool, reportDir, config string
+}
+
+func setup(t *testing.T, config string) *env {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("process groups, /proc and rlimits are tested on linux")
+	}
+	e := &env{wrapper: buildtest.BuildWrapper(t), reportDir: t.TempDir()}
+	dir := buildtest.WriteModule(t, map[string]string{"main.go": fakeTool})
+	e.tool = filepath.Join(t.TempDir(), "compile")
+	build := exec.Command("go", "build", "-o", e.tool, ".")
+	build.Dir = dir
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build fake tool: %v\n%s", err, out)
+	}
+	e.config = buildtest.WriteConfig(t, `{"supervise": {`+config+`"reportDir": "`+filepath.ToSlash(e.reportDir)+`"}}`)
+	return e
+}
+
+func (e *env) command(args ...string) *exec.Cmd {
+	cmd := exec.Command(e.wrapper, append([]string{e.tool}, args...)...)
+	cmd.Env = buildtest.Env("TOOLEXEC_CONFIG="+e.config, "TOOLEXEC_IMPORTPATH=example.com/app")
+	return cmd
+}
+
+func (e *env) report(t *testing.T) *supervise.Report {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(e.reportDir, "compile-example.com_app-*.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("reports = %v, %v; want one", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r supervise.Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal(err)
+	}
+	return &r
+}
+
+// alive は pid のプロセスが終了していないかどうかを返します。ゾンビは終了したものとみなします
+func alive(pid int) bool {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	_, rest, _ := strings.Cut(string(data), ") ")
+	return !strings.HasPrefix(rest, "Z")
+}
+
+func TestStdin(t *testing.T) {
+	e := setup(t, "")
+	cmd := e.command("cat")
+	cmd.Stdin = strings.NewReader("hello")
+	out, err := cmd.Output()
+	if err != nil || string(out) != "hello" {
+		t.Errorf("output = %q, %v; want stdin passed through", out, err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	e := setup(t, `"timeouts": {"compile": "500ms"}, `)
+	cmd := e.command("sleep")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	line, _ := bufio.NewReader(stdout).ReadString('\n')
+	childPID, _ := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "child ")))
+
+	err = cmd.Wait()
+	if elapsed := time.Since(start); err == nil || elapsed > 10*time.Second {
+		t.Fatalf("wrapper exited after %s: %v", elapsed, err)
+	}
+	if !strings.Contains(stderr.String(), "timed out after 500ms; report: ") {
+		t.Errorf("report is not shown\n%s", stderr.String())
+	}
+	for deadline := time.Now().Add(5 * time.Second); alive(childPID); time.Sleep(50 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			syscall.Kill(childPID, syscall.SIGKILL)
+			t.Fatalf("grandchild %d is left running", childPID)
+		}
+	}
+
+	r := e.report(t)
+	if r.Reason != "timed out after 500ms" || r.Signal != "terminated" || r.Argv[1] != "sleep" || r.Limits.Timeout != 500*time.Millisecond {
+		t.Errorf("unexpected report: %+v", r)
+	}
+}
+
+func TestSignal(t *testing.T) {
+	e := setup(t, "")
+	cmd := e.command("trap")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(stdout)
+	if line, _ := r.ReadString('\n'); line != "ready\n" {
+		t.Fatalf("unexpected output %q", line)
+	}
+	// ツールは別のプロセスグループなので、ラッパーだけに送ったシグナルが転送されることを確かめます
+	cmd.Process.Signal(os.Interrupt)
+	line, _ := r.ReadString('\n')
+	err = cmd.Wait()
+	var exitErr *exec.ExitError
+	if line != "interrupted\n" || !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("signal is not forwarded: %q, %v", line, err)
+	}
+	if rep := e.report(t); rep.Reason != "received interrupt" || rep.ExitCode != 3 {
+		t.Errorf("unexpected report: %+v", rep)
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	e := setup(t, `"memory": {"compile": "1GiB"}, `)
+	if out, err := e.command("alloc", "64").CombinedOutput(); err != nil {
+		t.Fatalf("allocation within the limit failed: %v\n%s", err, out)
+	}
+	out, err := e.command("alloc", "2048").CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "out of memory") {
+		t.Errorf("allocation over the limit succeeded: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,148 @@
+package testbuild
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/atomicfile"
+)
+
+// Entry はパッケージ1つ分の集計です
+type Entry struct {
+	Package string `json:"package"`
+	// Compiles はコンパイルしたパッケージの数です。
+	// テストではテスト対象、外部テストパッケージ、_testmain.go などの変種を含みます
+	Compiles    int           `json:"compiles"`
+	CompileTime time.Duration `json:"compileTime"`
+	VetTime     time.Duration `json:"vetTime,omitempty"`
+	LinkTime    time.Duration `json:"linkTime,omitempty"`
+	// BinarySize はリンクしたバイナリのサイズです。リンクしていない場合は 0 です
+	BinarySize int64 `json:"binarySize,omitempty"`
+}
+
+// Report は通常のビルドとテストのビルドを分けて集計したレポートです
+type Report struct {
+	Build []Entry `json:"build"`
+	Test  []Entry `json:"test"`
+	// Records は集計に使った記録です
+	Records []Record `json:"records"`
+}
+
+// Collect は dir/records に保存された記録を集計します
+func Collect(dir string) (*Report, error) {
+	paths, err := filepath.Glob(filepath.Join(recordsDir(dir), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Report{}
+	build := make(map[string]*Entry)
+	test := make(map[string]*Entry)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		r.Records = append(r.Records, rec)
+
+		m := build
+		if rec.Kind.IsTest() {
+			m = test
+		}
+		e, ok := m[rec.Package]
+		if !ok {
+			e = &Entry{Package: rec.Package}
+			m[rec.Package] = e
+		}
+		switch rec.Tool {
+		case "compile":
+			e.Compiles++
+			e.CompileTime += rec.Elapsed
+		case "vet":
+			e.VetTime += rec.Elapsed
+		case "link":
+			e.LinkTime += rec.Elapsed
+			e.BinarySize = rec.Size
+		}
+	}
+
+	sort.Slice(r.Records, func(i, j int) bool {
+		a, b := r.Records[i], r.Records[j]
+		if a.ImportPath != b.ImportPath {
+			return a.ImportPath < b.ImportPath
+		}
+		return a.Tool < b.Tool
+	})
+	r.Build, r.Test = sortEntries(build), sortEntries(test)
+	return r, nil
+}
+
+func sortEntries(m map[string]*Entry) []Entry {
+	list := make([]Entry, 0, len(m))
+	for _, e := range m {
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Package < list[j].Package
+	})
+	return list
+}
+
+// WriteFiles はレポートを dir/report.json と dir/report.txt に書き出します。
+// 並行して実行される他のラッパーが途中まで書かれたファイルを読まないように、一時ファイルから置き換えます。
+func (r *Report) WriteFiles(dir string) error {
+	if err := atomicfile.WriteJSON(filepath.Join(dir, "report.json"), r); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteTable(&buf); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(filepath.Join(dir, "report.txt"), buf.Bytes())
+}
+
+// WriteTable は通常のビルドとテストのビルドをそれぞれ表として書き出します
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, section := range []struct {
+		title   string
+		entries []Entry
+	}{
+		{"BUILD", r.Build},
+		{"TEST", r.Test},
+	} {
+		fmt.Fprintf(tw, "%s\tCOMPILES\tCOMPILE\tVET\tLINK\tSIZE\n", section.title)
+		for _, e := range section.entries {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", e.Package, e.Compiles,
+				formatDuration(e.CompileTime), formatDuration(e.VetTime), formatDuration(e.LinkTime), formatSize(e.BinarySize))
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+func formatSize(n int64) string {
+	if n == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+}
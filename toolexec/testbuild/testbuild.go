@@ -0,0 +1,132 @@
+// Package testbuild はテストバイナリのサイズとコンパイル時間を通常のビルドと分けて記録します。
+//
+// 設定例:
+//
+//	{
+//	  "testbuild": {
+//	    "dir": "/tmp/testbuild"
+//	  }
+//	}
+//
+// go test -toolexec では compile と link に加えて vet も呼び出され、テストの変種のパッケージや
+// _testmain.go のコンパイル、*.test バイナリのリンクも通常のビルドと同じように見えます。
+// このフックは hook.Invocation.Kind で呼び出しを分類し、compile, vet, link の時間と
+// link が出力したバイナリのサイズを1回ずつ dir/records に保存します。
+// テストのための呼び出しはテスト対象のパッケージごとにまとめて、link と vet の後に
+// dir/report.json と dir/report.txt を書き出します。
+// 標準ライブラリ（-std）のコンパイルは記録しません。
+package testbuild
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/atomicfile"
+)
+
+// Config はテストビルドの記録の設定です
+type Config struct {
+	// Dir は記録とレポートを書き出すディレクトリです
+	Dir string `json:"dir"`
+}
+
+// Record はツールの呼び出し1回分の記録です
+type Record struct {
+	// ImportPath は TOOLEXEC_IMPORTPATH の値です
+	ImportPath string `json:"importPath"`
+	// Package は集計に使うパッケージです。テストのための呼び出しではテスト対象のパッケージです
+	Package string    `json:"package"`
+	Tool    string    `json:"tool"`
+	Kind    hook.Kind `json:"kind"`
+	// Elapsed はツールの実行にかかった時間です
+	Elapsed time.Duration `json:"elapsed"`
+	// Size は link が出力したバイナリのサイズです
+	Size int64 `json:"size,omitempty"`
+}
+
+// NewRecord は呼び出しを分類して記録を作ります。記録しない呼び出しの場合は false を返します。
+func NewRecord(inv *hook.Invocation) (Record, bool) {
+	switch {
+	case inv.Tool != "compile" && inv.Tool != "vet" && inv.Tool != "link":
+		return Record{}, false
+	case inv.ImportPath == "" || inv.HasFlag("std"):
+		return Record{}, false
+	}
+
+	pkg, ok := inv.TestPackage()
+	if !ok {
+		pkg = inv.Package()
+	}
+	return Record{
+		ImportPath: inv.ImportPath,
+		Package:    pkg,
+		Tool:       inv.Tool,
+		Kind:       inv.Kind(),
+	}, true
+}
+
+// Hook は compile, vet, link の時間とバイナリのサイズを記録し、link と vet の後にレポートを書き出します
+func Hook(c *Config) hook.Hook {
+	var start time.Time
+	var elapsed time.Duration
+
+	return hook.Hook{
+		Name: "testbuild",
+		Wrap: func(inv *hook.Invocation, run func() error) error {
+			if c.Dir == "" {
+				return run()
+			}
+			start = time.Now()
+			err := run()
+			elapsed = time.Since(start)
+			return err
+		},
+		After: func(inv *hook.Invocation) error {
+			if c.Dir == "" {
+				return nil
+			}
+			rec, ok := NewRecord(inv)
+			if !ok {
+				return nil
+			}
+			rec.Elapsed = elapsed
+			if inv.Tool == "link" {
+				out, _ := inv.Flag("o")
+				fi, err := os.Stat(out)
+				if err != nil {
+					return err
+				}
+				rec.Size = fi.Size()
+			}
+			if err := WriteRecord(c.Dir, rec); err != nil {
+				return err
+			}
+
+			// go test では vet がリンクより後に終わることがあるため、どちらの後にもレポートを更新します
+			if inv.Tool == "compile" {
+				return nil
+			}
+			r, err := Collect(c.Dir)
+			if err != nil {
+				return err
+			}
+			return r.WriteFiles(c.Dir)
+		},
+	}
+}
+
+func recordsDir(dir string) string {
+	return filepath.Join(dir, "records")
+}
+
+// WriteRecord は記録を dir/records に保存します。同じツールとパッケージの記録は上書きします。
+func WriteRecord(dir string, rec Record) error {
+	if err := os.MkdirAll(recordsDir(dir), 0o755); err != nil {
+		return err
+	}
+	name := url.PathEscape(rec.Tool + "-" + rec.ImportPath)
+	return atomicfile.WriteJSON(filepath.Join(recordsDir(dir), name+".json"), rec)
+}
@@ -0,0 +1,123 @@
+package testbuild_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/testbuild"
+)
+
+func TestHook(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	dir := buildtest.WriteModule(t, map[string]string{
+		"lib/lib.go": `package lib
+
+func Max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+`,
+		"lib/lib_test.go": `package lib
+
+import "testing"
+
+func TestMax(t *testing.T) {
+	if Max(1, 2) != 2 {
+		t.Fatal("Max(1, 2) != 2")
+	}
+}
+`,
+		"lib/example_test.go": `package lib_test
+
+import (
+	"fmt"
+
+	"example.com/app/lib"
+)
+
+func ExampleMax() {
+	fmt.Println(lib.Max(3, 4))
+	// Output: 4
+}
+`,
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/app/lib"
+)
+
+func main() {
+	fmt.Println(lib.Max(1, 2))
+}
+`,
+	})
+	reportDir := t.TempDir()
+	config := buildtest.WriteConfig(t, `{"testbuild": {"dir": "`+filepath.ToSlash(reportDir)+`"}}`)
+	env := []string{"TOOLEXEC_CONFIG=" + config}
+
+	if out, err := buildtest.GoBuild(t, dir, wrapper, env, "-o", filepath.Join(t.TempDir(), "app"), "."); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	if out, err := buildtest.GoTest(t, dir, wrapper, env, "-count=1", "./lib"); err != nil {
+		t.Fatalf("go test: %v\n%s", err, out)
+	}
+
+	data, err := os.ReadFile(filepath.Join(reportDir, "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r testbuild.Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := make(map[string]hook.Kind)
+	for _, rec := range r.Records {
+		kinds[rec.Tool+" "+rec.ImportPath] = rec.Kind
+	}
+	for key, want := range map[string]hook.Kind{
+		"compile example.com/app/lib":                                 hook.KindBuild,
+		"link example.com/app":                                        hook.KindBuild,
+		"compile example.com/app/lib [example.com/app/lib.test]":      hook.KindTestCompile,
+		"compile example.com/app/lib_test [example.com/app/lib.test]": hook.KindTestCompile,
+		"compile example.com/app/lib.test":                            hook.KindTestMain,
+		"link example.com/app/lib.test":                               hook.KindTestLink,
+		"vet example.com/app/lib [example.com/app/lib.test]":          hook.KindVet,
+	} {
+		if kinds[key] != want {
+			t.Errorf("kind of %q = %q; want %q", key, kinds[key], want)
+		}
+	}
+
+	entries := func(list []testbuild.Entry) map[string]testbuild.Entry {
+		m := make(map[string]testbuild.Entry)
+		for _, e := range list {
+			m[e.Package] = e
+		}
+		return m
+	}
+	build, test := entries(r.Build), entries(r.Test)
+
+	if e := build["example.com/app/lib"]; e.Compiles != 1 || e.CompileTime <= 0 || e.BinarySize != 0 {
+		t.Errorf("build entry of lib = %+v; want one compile without binary", e)
+	}
+	if e := build["example.com/app"]; e.BinarySize <= 0 || e.LinkTime <= 0 {
+		t.Errorf("build entry of main = %+v; want binary size and link time", e)
+	}
+	// テスト対象、外部テストパッケージ、_testmain.go の3回です
+	e := test["example.com/app/lib"]
+	if e.Compiles != 3 || e.CompileTime <= 0 || e.VetTime <= 0 || e.LinkTime <= 0 || e.BinarySize <= 0 {
+		t.Errorf("test entry of lib = %+v; want 3 compiles, vet, link and binary size", e)
+	}
+	if _, ok := test["example.com/app"]; ok {
+		t.Errorf("test entries = %+v; want no entry for the untested main package", r.Test)
+	}
+}
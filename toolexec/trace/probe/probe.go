@@ -0,0 +1,21 @@
+// Package probe は trace フックがコンパイル時に関数へ差し込む呼び出し先です。
+//
+// link の importcfg にはプログラムが元々依存するパッケージしか含まれないため、
+// このパッケージは runtime 以外のパッケージに依存しないように、
+// 組み込みの println で標準エラー出力に書き出し、時刻は runtime.nanotime から取得します。
+package probe
+
+import _ "unsafe" // go:linkname
+
+//go:linkname nanotime runtime.nanotime
+func nanotime() int64
+
+// Enter は関数の開始を記録し、終了時に呼ぶ関数を返します。
+// trace フックは関数の先頭に defer probe.Enter("pkg.F")() を差し込みます。
+func Enter(name string) func() {
+	start := nanotime()
+	println("[trace] enter", name)
+	return func() {
+		println("[trace] exit", name, nanotime()-start, "ns")
+	}
+}
@@ -0,0 +1,157 @@
+// Package trace はソースを編集せずに、関数の開始と終了をトレースする呼び出しをコンパイル時に差し込みます。
+//
+// 設定例:
+//
+//	{
+//	  "trace": {
+//	    "packages": ["example.com/app/internal/parser"],
+//	    "functions": ["Parse*", "(*Parser).*"]
+//	  }
+//	}
+//
+// 対象パッケージの compile では、引数の .go ファイルを一時ディレクトリにコピーし、
+// 一致した関数の先頭に defer probe.Enter("pkg.F")() を差し込んだファイルをコンパイラに渡します。
+// 差し込む呼び出しは関数の { と同じ行に、import は package 句と同じ行に追加し、
+// ファイルの先頭に元のファイルを指す //line ディレクティブを付けるため、
+// コンパイルエラーやパニックの位置は元のソースのままになります。
+//
+// probe パッケージは go コマンドの依存関係に含まれないため、このフックが一度だけコンパイルして cacheDir に保存し、
+// compile と link の importcfg に追加します。functions を省略するとすべての関数が対象になります。
+package trace
+
+import (
+	_ "embed"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/hook"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/srcpos"
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/srcrewrite"
+)
+
+// ProbePath は差し込む呼び出し先のパッケージです
+const ProbePath = "github.com/newmo-oss/gocon25-workshop/toolexec/trace/probe"
+
+//go:embed probe/probe.go
+var probeSource []byte
+
+// Config はトレースの設定です
+type Config struct {
+	// Packages はトレースするパッケージのパターンです
+	Packages []string `json:"packages"`
+	// Functions はトレースする関数名（F, T.M, (*T).M）の path.Match 形式のパターンです
+	Functions []string `json:"functions"`
+	// CacheDir はコンパイルした probe パッケージを保存するディレクトリです。省略時はユーザーのキャッシュディレクトリです
+	CacheDir string `json:"cacheDir"`
+}
+
+// Hook は対象パッケージの compile でソースを書き換え、link で probe パッケージを追加します
+func Hook(c *Config) hook.Hook {
+	var tmpDir string
+	probe := &srcrewrite.Package{Path: ProbePath, Source: probeSource, CacheDir: c.CacheDir}
+
+	return hook.Hook{
+		Name: "trace",
+		Before: func(inv *hook.Invocation) error {
+			if len(c.Packages) == 0 {
+				return nil
+			}
+			switch {
+			case inv.Tool == "link":
+				return probe.Add(inv)
+			case inv.Tool == "compile" && hook.MatchAny(c.Packages, inv.Package()) && inv.Package() != ProbePath:
+				output, ok := inv.Flag("o")
+				if !ok {
+					return nil
+				}
+				dir, err := os.MkdirTemp(filepath.Dir(output), "trace")
+				if err != nil {
+					return err
+				}
+				tmpDir = dir
+
+				pkgPath, ok := inv.Flag("p")
+				if !ok {
+					pkgPath = inv.ImportPath
+				}
+				instrumented, err := srcrewrite.Files(inv, dir, func(filename string, src []byte) ([]byte, bool, error) {
+					return Instrument(filename, src, pkgPath, c.Functions)
+				})
+				if err != nil || !instrumented {
+					return err
+				}
+				return probe.Add(inv)
+			}
+			return nil
+		},
+		Finish: func(inv *hook.Invocation, err error) {
+			if tmpDir != "" {
+				os.RemoveAll(tmpDir)
+			}
+		},
+	}
+}
+
+// Instrument は src の一致した関数の先頭に probe.Enter の呼び出しを差し込みます。
+// 一致する関数がない場合は ok が false になります。
+func Instrument(filename string, src []byte, pkgPath string, funcs []string) (out []byte, ok bool, err error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var inserts []srcrewrite.Insertion
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Body == nil || hasDirective(fd, "//go:nosplit") {
+			continue
+		}
+		name := srcpos.FuncName(fd)
+		if !matchFunc(funcs, name) {
+			continue
+		}
+		inserts = append(inserts, srcrewrite.Insertion{
+			Offset: fset.Position(fd.Body.Lbrace).Offset + 1,
+			Text:   " defer __probe.Enter(" + strconv.Quote(pkgPath+"."+name) + ")();",
+		})
+	}
+	if len(inserts) == 0 {
+		return nil, false, nil
+	}
+	inserts = append(inserts, srcrewrite.Insertion{
+		Offset: fset.Position(f.Name.End()).Offset,
+		Text:   "; import __probe " + strconv.Quote(ProbePath),
+	})
+	return srcrewrite.Apply(filename, src, inserts), true, nil
+}
+
+func matchFunc(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasDirective(fd *ast.FuncDecl, directive string) bool {
+	if fd.Doc == nil {
+		return false
+	}
+	for _, c := range fd.Doc.List {
+		if strings.HasPrefix(c.Text, directive) {
+			return true
+		}
+	}
+	return false
+}
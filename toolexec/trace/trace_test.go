@@ -0,0 +1,144 @@
+package trace_test
+
+import (
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/newmo-oss/gocon25-workshop/toolexec/internal/buildtest"
+)
+
+func TestHook(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	config := buildtest.WriteConfig(t, `{"trace": {"packages": ["example.com/app/lib"], "functions": ["F", "(*T).*"], "cacheDir": "`+filepath.ToSlash(t.TempDir())+`"}}`)
+	dir := buildtest.WriteModule(t, map[string]string{
+		"lib/lib.go": `package lib
+
+type T struct{}
+
+func (*T) M() { G() }
+
+func F(n int) int {
+	if n == 0 {
+		panic("boom")
+	}
+	return n
+}
+
+func G() {}
+`,
+		"main.go": `package main
+
+import (
+	"os"
+
+	"example.com/app/lib"
+)
+
+func main() {
+	new(lib.T).M()
+	lib.F(len(os.Args) - 1)
+}
+`,
+	})
+
+	out, err := buildtest.GoBuild(t, dir, wrapper, []string{"TOOLEXEC_CONFIG=" + config}, "-o", "app", ".")
+	if err != nil {
+		t.Fatalf("go build failed: %v\n%s", err, out)
+	}
+
+	stderr, err := exec.Command(filepath.Join(dir, "app"), "x").CombinedOutput()
+	if err != nil {
+		t.Fatalf("app failed: %v\n%s", err, stderr)
+	}
+	for _, re := range []string{
+		`\[trace\] enter example.com/app/lib.\(\*T\).M\n`,
+		`\[trace\] exit example.com/app/lib.\(\*T\).M \d+ ns\n`,
+		`\[trace\] enter example.com/app/lib.F\n\[trace\] exit example.com/app/lib.F \d+ ns\n`,
+	} {
+		if !regexp.MustCompile(re).Match(stderr) {
+			t.Errorf("output does not match %s\n%s", re, stderr)
+		}
+	}
+	if strings.Contains(string(stderr), "lib.G") {
+		t.Errorf("G is traced\n%s", stderr)
+	}
+
+	// パニックの位置は書き換える前のソースの行を指します
+	stderr, err = exec.Command(filepath.Join(dir, "app")).CombinedOutput()
+	if err == nil {
+		t.Fatalf("app did not panic\n%s", stderr)
+	}
+	if want := filepath.Join(dir, "lib", "lib.go") + ":9 "; !strings.Contains(string(stderr), want) {
+		t.Errorf("panic does not point at %s\n%s", want, stderr)
+	}
+}
+
+func TestHookTestVariant(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	config := buildtest.WriteConfig(t, `{"trace": {"packages": ["example.com/app/lib"], "functions": ["F"], "cacheDir": "`+filepath.ToSlash(t.TempDir())+`"}}`)
+	dir := buildtest.WriteModule(t, map[string]string{
+		"lib/lib.go": `package lib
+
+func F(n int) int { return n }
+`,
+		"lib/lib_test.go": `package lib
+
+import "testing"
+
+func TestF(t *testing.T) {
+	if F(1) != 1 {
+		t.Fail()
+	}
+}
+`,
+	})
+
+	// go test ではテストの変種 "example.com/app/lib [example.com/app/lib.test]" がコンパイルされます
+	out, err := buildtest.GoTest(t, dir, wrapper, []string{"TOOLEXEC_CONFIG=" + config}, "-v", "./lib")
+	if err != nil {
+		t.Fatalf("go test failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "[trace] enter example.com/app/lib.F\n") {
+		t.Errorf("the test variant of lib is not traced\n%s", out)
+	}
+}
+
+func TestHookBuildFlags(t *testing.T) {
+	wrapper := buildtest.BuildWrapper(t)
+	cacheDir := t.TempDir()
+	config := buildtest.WriteConfig(t, `{"trace": {"packages": ["example.com/app/lib"], "functions": ["F"], "cacheDir": "`+filepath.ToSlash(cacheDir)+`"}}`)
+	dir := buildtest.WriteModule(t, map[string]string{
+		"lib/lib.go": `package lib
+
+func F(n int) int { return n }
+`,
+		"main.go": `package main
+
+import "example.com/app/lib"
+
+func main() { lib.F(1) }
+`,
+	})
+
+	// probe パッケージはビルドと同じ計測とコード生成のフラグでコンパイルします
+	for _, flags := range [][]string{{"-race"}, {"-buildmode=pie"}} {
+		args := append(flags, "-o", "app", ".")
+		out, err := buildtest.GoBuild(t, dir, wrapper, []string{"TOOLEXEC_CONFIG=" + config}, args...)
+		if err != nil {
+			t.Fatalf("go build %s failed: %v\n%s", flags, err, out)
+		}
+		stderr, err := exec.Command(filepath.Join(dir, "app")).CombinedOutput()
+		if err != nil {
+			t.Fatalf("app built with %s failed: %v\n%s", flags, err, stderr)
+		}
+		if !strings.Contains(string(stderr), "[trace] enter example.com/app/lib.F\n") {
+			t.Errorf("app built with %s is not traced\n%s", flags, stderr)
+		}
+	}
+	if archives, _ := filepath.Glob(filepath.Join(cacheDir, "*.a")); len(archives) != 2 {
+		t.Errorf("probe archives = %q; want one for each set of flags", archives)
+	}
+}